@@ -0,0 +1,115 @@
+// Package borsh implements the Borsh binary serialization used by NEAR
+// (https://borsh.io) for transactions, contract arguments and contract state.
+//
+// Go values map to Borsh types as follows:
+//
+//	bool                      bool (u8 0 or 1)
+//	uint8 ... uint64          u8 ... u64, little endian
+//	int8 ... int64            i8 ... i64, little endian
+//	float32, float64          f32, f64 (NaN is rejected)
+//	big.Int                   u128, rejected when negative or wider than 128 bits
+//	string                    u32 length + UTF-8 bytes
+//	[N]T                      N values of T, no length prefix
+//	[]T                       Vec<T>: u32 length + values of T
+//	map[K]V                   HashMap<K, V>: u32 length + entries sorted by key
+//	*T                        Option<T>: 0 for nil, 1 followed by T otherwise
+//	struct                    fields in declaration order
+//
+// Struct fields can be tagged:
+//
+//	`borsh:"skip"`   the field is not serialized
+//	`borsh:"enum"`   the field is the u8 discriminant of an enum, see below
+//
+// An enum is a struct whose first serialized field is a uint8 tagged
+// `borsh:"enum"`. The remaining fields are the variants in discriminant
+// order, only the variant selected by the discriminant is serialized.
+// Variant fields are usually pointers, nil unless selected.
+//
+// Types implementing Marshaler and Unmarshaler encode themselves, this takes
+// precedence over the Option rule for pointer types.
+//
+// Values without a Go type can be handled with an explicit Schema.
+package borsh
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Marshaler is the interface implemented by types that can serialize themselves
+type Marshaler interface {
+	MarshalBorsh(e *Encoder) error
+}
+
+// Unmarshaler is the interface implemented by types that can deserialize themselves
+type Unmarshaler interface {
+	UnmarshalBorsh(d *Decoder) error
+}
+
+var (
+	ErrUnexpectedEOF   = errors.New("borsh: unexpected end of data")
+	ErrTrailingBytes   = errors.New("borsh: unexpected trailing bytes")
+	ErrU128Overflow    = errors.New("borsh: value does not fit in u128")
+	ErrInvalidBool     = errors.New("borsh: invalid bool value")
+	ErrInvalidOption   = errors.New("borsh: invalid option tag")
+	ErrInvalidUTF8     = errors.New("borsh: string is not valid UTF-8")
+	ErrNaN             = errors.New("borsh: NaN is not allowed")
+	ErrUnsupportedType = errors.New("borsh: unsupported type")
+)
+
+// Serialize returns the Borsh encoding of v, a top-level pointer is dereferenced
+func Serialize(v interface{}) ([]byte, error) {
+	e := NewEncoder()
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// Deserialize decodes data into the value pointed to by v, all of data must be consumed
+func Deserialize(data []byte, v interface{}) error {
+	d := NewDecoder(data)
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if d.Remaining() != 0 {
+		return ErrTrailingBytes
+	}
+	return nil
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+type fieldInfo struct {
+	index  int
+	name   string
+	isEnum bool
+}
+
+// structFields returns the serialized fields of a struct type in order
+func structFields(t reflect.Type) ([]fieldInfo, bool, error) {
+	fields := make([]fieldInfo, 0, t.NumField())
+	isEnum := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("borsh")
+		if tag == "skip" || tag == "-" {
+			continue
+		}
+		if tag == "enum" {
+			if len(fields) != 0 || f.Type.Kind() != reflect.Uint8 {
+				return nil, false, fmt.Errorf("borsh: enum discriminant %s.%s must be the first field and a uint8", t.Name(), f.Name)
+			}
+			isEnum = true
+		}
+		if f.PkgPath != "" {
+			return nil, false, fmt.Errorf("borsh: unexported field %s.%s must be tagged skip", t.Name(), f.Name)
+		}
+		fields = append(fields, fieldInfo{index: i, name: f.Name, isEnum: tag == "enum"})
+	}
+	return fields, isEnum, nil
+}
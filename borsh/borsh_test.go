@@ -0,0 +1,213 @@
+package borsh
+
+import (
+	"encoding/hex"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+type testVariantA struct {
+	X uint16
+}
+
+type testEnum struct {
+	Kind uint8 `borsh:"enum"`
+	Unit *struct{}
+	A    *testVariantA
+	B    *string
+}
+
+type testStruct struct {
+	U8      uint8
+	U16     uint16
+	U32     uint32
+	U64     uint64
+	I32     int32
+	Amount  big.Int
+	Name    string
+	Hash    [4]byte
+	Data    []byte
+	List    []uint32
+	Opt     *uint64
+	None    *string
+	Flag    bool
+	Enum    testEnum
+	Table   map[string]uint8
+	Ignored string `borsh:"skip"`
+}
+
+type testMarshaler struct {
+	Value string
+}
+
+func (m *testMarshaler) MarshalBorsh(e *Encoder) error {
+	e.WriteU8(uint8(len(m.Value)))
+	e.WriteFixedBytes([]byte(m.Value))
+	return nil
+}
+
+func (m *testMarshaler) UnmarshalBorsh(d *Decoder) error {
+	n, err := d.ReadU8()
+	if err != nil {
+		return err
+	}
+	b, err := d.ReadFixedBytes(int(n))
+	if err != nil {
+		return err
+	}
+	m.Value = string(b)
+	return nil
+}
+
+func TestSerializeStruct(t *testing.T) {
+	opt := uint64(9)
+	name := "b"
+	v := testStruct{
+		U8:      1,
+		U16:     2,
+		U32:     3,
+		U64:     4,
+		I32:     -1,
+		Name:    "near",
+		Hash:    [4]byte{0xde, 0xad, 0xbe, 0xef},
+		Data:    []byte{0x01, 0x02},
+		List:    []uint32{7, 8},
+		Opt:     &opt,
+		Flag:    true,
+		Enum:    testEnum{Kind: 2, B: &name},
+		Table:   map[string]uint8{"z": 1, "a": 2},
+		Ignored: "not serialized",
+	}
+	v.Amount.SetString("1000000000000000000000000", 10)
+
+	data, err := Serialize(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "01" + "0200" + "03000000" + "0400000000000000" + "ffffffff" +
+		"000000a1edccce1bc2d3000000000000" +
+		"040000006e656172" + "deadbeef" + "020000000102" + "020000000700000008000000" +
+		"010900000000000000" + "00" + "01" +
+		"020100000062" +
+		"02000000" + "010000006102" + "010000007a01"
+	if hex.EncodeToString(data) != expect {
+		t.Fatalf("expect %s\ngot    %s", expect, hex.EncodeToString(data))
+	}
+
+	var decoded testStruct
+	if err := Deserialize(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	v.Ignored = ""
+	if decoded.Amount.Cmp(&v.Amount) != 0 {
+		t.Error("amount mismatch")
+	}
+	decoded.Amount, v.Amount = big.Int{}, big.Int{}
+	if !reflect.DeepEqual(decoded, v) {
+		t.Errorf("round trip mismatch:\n%+v\n%+v", decoded, v)
+	}
+
+	if err := Deserialize(append(data, 0), &decoded); err != ErrTrailingBytes {
+		t.Errorf("expect trailing bytes error, got %v", err)
+	}
+	if err := Deserialize(data[:len(data)-1], &decoded); err == nil {
+		t.Error("expect error on truncated data")
+	}
+}
+
+func TestU128(t *testing.T) {
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+	data, err := Serialize(max)
+	if err != nil || hex.EncodeToString(data) != "ffffffffffffffffffffffffffffffff" {
+		t.Errorf("max u128 encode failed: %x %v", data, err)
+	}
+
+	if _, err := Serialize(new(big.Int).Add(max, big.NewInt(1))); err != ErrU128Overflow {
+		t.Errorf("expect overflow, got %v", err)
+	}
+	if _, err := Serialize(big.NewInt(-1)); err != ErrU128Overflow {
+		t.Errorf("expect overflow on negative, got %v", err)
+	}
+}
+
+func TestEnum(t *testing.T) {
+	data, err := Serialize(testEnum{Kind: 0})
+	if err != nil || hex.EncodeToString(data) != "00" {
+		t.Errorf("unit variant encode failed: %x %v", data, err)
+	}
+	data, err = Serialize(testEnum{Kind: 1, A: &testVariantA{X: 5}})
+	if err != nil || hex.EncodeToString(data) != "010500" {
+		t.Errorf("struct variant encode failed: %x %v", data, err)
+	}
+
+	var e testEnum
+	if err := Deserialize(data, &e); err != nil || e.Kind != 1 || e.A == nil || e.A.X != 5 {
+		t.Errorf("enum decode failed: %+v %v", e, err)
+	}
+	if _, err := Serialize(testEnum{Kind: 1}); err == nil {
+		t.Error("expect error on nil variant")
+	}
+	if _, err := Serialize(testEnum{Kind: 3}); err == nil {
+		t.Error("expect error on unknown variant")
+	}
+	if err := Deserialize([]byte{0x05}, &e); err == nil {
+		t.Error("expect error on unknown discriminant")
+	}
+}
+
+func TestMarshaler(t *testing.T) {
+	v := struct {
+		M *testMarshaler
+		N testMarshaler
+	}{M: &testMarshaler{Value: "ab"}, N: testMarshaler{Value: "c"}}
+
+	data, err := Serialize(v)
+	if err != nil || hex.EncodeToString(data) != "0261620163" {
+		t.Fatalf("marshaler encode failed: %x %v", data, err)
+	}
+
+	v.M, v.N = nil, testMarshaler{}
+	if err := Deserialize(data, &v); err != nil || v.M == nil || v.M.Value != "ab" || v.N.Value != "c" {
+		t.Errorf("marshaler decode failed: %+v %v", v, err)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema := Struct(
+		NewField("owner", String),
+		NewField("balance", U128),
+		NewField("nonce", U64),
+		NewField("keys", Vec(Array(U8, 2))),
+		NewField("memo", Option(String)),
+		NewField("status", Enum(NewField("Active", Unit), NewField("Locked", U32))),
+	)
+
+	value := map[string]interface{}{
+		"owner":   "alice.near",
+		"balance": "340282366920938463463374607431768211455",
+		"nonce":   uint64(3),
+		"keys":    []interface{}{"0102", "0304"},
+		"memo":    nil,
+		"status":  map[string]interface{}{"Locked": uint64(10)},
+	}
+
+	data, err := schema.Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := schema.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("schema round trip mismatch:\n%v\n%v", decoded, value)
+	}
+
+	value["balance"] = "340282366920938463463374607431768211456"
+	if _, err := schema.Encode(value); err == nil {
+		t.Error("expect u128 overflow")
+	}
+}
@@ -0,0 +1,345 @@
+package borsh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Decoder reads Borsh encoded values from a byte slice
+type Decoder struct {
+	data   []byte
+	offset int
+}
+
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Remaining returns the number of bytes not read yet
+func (d *Decoder) Remaining() int {
+	return len(d.data) - d.offset
+}
+
+// ReadFixedBytes reads n raw bytes, the result aliases the decoder input
+func (d *Decoder) ReadFixedBytes(n int) ([]byte, error) {
+	if n < 0 || n > d.Remaining() {
+		return nil, ErrUnexpectedEOF
+	}
+	b := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return b, nil
+}
+
+func (d *Decoder) ReadU8() (uint8, error) {
+	b, err := d.ReadFixedBytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *Decoder) ReadBool() (bool, error) {
+	b, err := d.ReadU8()
+	if err != nil {
+		return false, err
+	}
+	switch b {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	}
+	return false, ErrInvalidBool
+}
+
+func (d *Decoder) ReadU16() (uint16, error) {
+	b, err := d.ReadFixedBytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+func (d *Decoder) ReadU32() (uint32, error) {
+	b, err := d.ReadFixedBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (d *Decoder) ReadU64() (uint64, error) {
+	b, err := d.ReadFixedBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (d *Decoder) ReadU128() (*big.Int, error) {
+	b, err := d.ReadFixedBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	be := make([]byte, 16)
+	for i := 0; i < 16; i++ {
+		be[i] = b[15-i]
+	}
+	return new(big.Int).SetBytes(be), nil
+}
+
+// ReadBytes reads a Vec<u8> into a new slice
+func (d *Decoder) ReadBytes() ([]byte, error) {
+	length, err := d.ReadU32()
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.ReadFixedBytes(int(length))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, b...), nil
+}
+
+func (d *Decoder) ReadString() (string, error) {
+	length, err := d.ReadU32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.ReadFixedBytes(int(length))
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", ErrInvalidUTF8
+	}
+	return string(b), nil
+}
+
+// Decode reads a value into the non-nil pointer v
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("borsh: decode target must be a non-nil pointer")
+	}
+	return d.decodeValue(rv.Elem())
+}
+
+func (d *Decoder) decodeValue(v reflect.Value) error {
+	t := v.Type()
+
+	if t.Kind() == reflect.Ptr && t.Implements(unmarshalerType) {
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return v.Interface().(Unmarshaler).UnmarshalBorsh(d)
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return v.Addr().Interface().(Unmarshaler).UnmarshalBorsh(d)
+	}
+
+	if t == bigIntType {
+		i, err := d.ReadU128()
+		if err != nil {
+			return err
+		}
+		v.Addr().Interface().(*big.Int).Set(i)
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, err := d.ReadBool()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Uint8:
+		n, err := d.ReadU8()
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(n))
+	case reflect.Uint16:
+		n, err := d.ReadU16()
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(n))
+	case reflect.Uint32:
+		n, err := d.ReadU32()
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(n))
+	case reflect.Uint64:
+		n, err := d.ReadU64()
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Int8:
+		n, err := d.ReadU8()
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(int8(n)))
+	case reflect.Int16:
+		n, err := d.ReadU16()
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(int16(n)))
+	case reflect.Int32:
+		n, err := d.ReadU32()
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(int32(n)))
+	case reflect.Int64:
+		n, err := d.ReadU64()
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Float32:
+		n, err := d.ReadU32()
+		if err != nil {
+			return err
+		}
+		f := math.Float32frombits(n)
+		if f != f {
+			return ErrNaN
+		}
+		v.SetFloat(float64(f))
+	case reflect.Float64:
+		n, err := d.ReadU64()
+		if err != nil {
+			return err
+		}
+		f := math.Float64frombits(n)
+		if math.IsNaN(f) {
+			return ErrNaN
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		s, err := d.ReadString()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.decodeValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && !reflect.PtrTo(t.Elem()).Implements(unmarshalerType) {
+			b, err := d.ReadBytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		length, err := d.ReadU32()
+		if err != nil {
+			return err
+		}
+		// every element takes at least one byte, except zero sized ones
+		if int(length) > d.Remaining() && t.Elem().Size() > 0 {
+			return ErrUnexpectedEOF
+		}
+		s := reflect.MakeSlice(t, int(length), int(length))
+		for i := 0; i < int(length); i++ {
+			if err := d.decodeValue(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Map:
+		length, err := d.ReadU32()
+		if err != nil {
+			return err
+		}
+		if int(length) > d.Remaining() {
+			return ErrUnexpectedEOF
+		}
+		m := reflect.MakeMapWithSize(t, int(length))
+		for i := 0; i < int(length); i++ {
+			key := reflect.New(t.Key()).Elem()
+			if err := d.decodeValue(key); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := d.decodeValue(value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	case reflect.Ptr:
+		tag, err := d.ReadU8()
+		if err != nil {
+			return err
+		}
+		switch tag {
+		case 0:
+			v.Set(reflect.Zero(t))
+		case 1:
+			p := reflect.New(t.Elem())
+			if err := d.decodeValue(p.Elem()); err != nil {
+				return err
+			}
+			v.Set(p)
+		default:
+			return ErrInvalidOption
+		}
+	case reflect.Struct:
+		return d.decodeStruct(v)
+	default:
+		return fmt.Errorf("%v: %s", ErrUnsupportedType, t)
+	}
+	return nil
+}
+
+func (d *Decoder) decodeStruct(v reflect.Value) error {
+	t := v.Type()
+	fields, isEnum, err := structFields(t)
+	if err != nil {
+		return err
+	}
+
+	if isEnum {
+		variant, err := d.ReadU8()
+		if err != nil {
+			return err
+		}
+		if int(variant)+1 >= len(fields) {
+			return fmt.Errorf("borsh: %s has no variant %d", t.Name(), variant)
+		}
+		v.Field(fields[0].index).SetUint(uint64(variant))
+		fv := v.Field(fields[variant+1].index)
+		if fv.Kind() == reflect.Ptr && !fv.Type().Implements(unmarshalerType) {
+			p := reflect.New(fv.Type().Elem())
+			if err := d.decodeValue(p.Elem()); err != nil {
+				return err
+			}
+			fv.Set(p)
+			return nil
+		}
+		return d.decodeValue(fv)
+	}
+
+	for _, f := range fields {
+		if err := d.decodeValue(v.Field(f.index)); err != nil {
+			return fmt.Errorf("%s.%s: %v", t.Name(), f.name, err)
+		}
+	}
+	return nil
+}
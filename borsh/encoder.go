@@ -0,0 +1,282 @@
+package borsh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+// Encoder writes Borsh encoded values to an in-memory buffer
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// Bytes returns the encoded data
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+func (e *Encoder) WriteU8(v uint8) {
+	e.buf.WriteByte(v)
+}
+
+func (e *Encoder) WriteBool(v bool) {
+	if v {
+		e.WriteU8(1)
+	} else {
+		e.WriteU8(0)
+	}
+}
+
+func (e *Encoder) WriteU16(v uint16) {
+	var tmp [2]byte
+	binary.LittleEndian.PutUint16(tmp[:], v)
+	e.buf.Write(tmp[:])
+}
+
+func (e *Encoder) WriteU32(v uint32) {
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], v)
+	e.buf.Write(tmp[:])
+}
+
+func (e *Encoder) WriteU64(v uint64) {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	e.buf.Write(tmp[:])
+}
+
+// WriteU128 writes v as a little endian u128
+func (e *Encoder) WriteU128(v *big.Int) error {
+	if v == nil || v.Sign() < 0 || v.BitLen() > 128 {
+		return ErrU128Overflow
+	}
+	var tmp [16]byte
+	b := v.Bytes()
+	for i := 0; i < len(b); i++ {
+		tmp[i] = b[len(b)-1-i]
+	}
+	e.buf.Write(tmp[:])
+	return nil
+}
+
+// WriteFixedBytes writes raw bytes without a length prefix
+func (e *Encoder) WriteFixedBytes(b []byte) {
+	e.buf.Write(b)
+}
+
+// WriteBytes writes a Vec<u8>
+func (e *Encoder) WriteBytes(b []byte) {
+	e.WriteU32(uint32(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *Encoder) WriteString(s string) {
+	e.WriteU32(uint32(len(s)))
+	e.buf.WriteString(s)
+}
+
+// Encode writes the Borsh encoding of v, a top-level pointer is dereferenced
+func (e *Encoder) Encode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return fmt.Errorf("borsh: cannot encode nil")
+	}
+	if rv.Kind() == reflect.Ptr && !rv.Type().Implements(marshalerType) {
+		if rv.IsNil() {
+			return fmt.Errorf("borsh: cannot encode nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+	if !rv.CanAddr() {
+		// make pointer receiver marshalers reachable
+		p := reflect.New(rv.Type())
+		p.Elem().Set(rv)
+		rv = p.Elem()
+	}
+	return e.encodeValue(rv)
+}
+
+func (e *Encoder) encodeValue(v reflect.Value) error {
+	t := v.Type()
+
+	if t.Implements(marshalerType) {
+		if t.Kind() == reflect.Ptr && v.IsNil() {
+			return fmt.Errorf("borsh: cannot encode nil %s", t)
+		}
+		return v.Interface().(Marshaler).MarshalBorsh(e)
+	}
+	if v.CanAddr() && reflect.PtrTo(t).Implements(marshalerType) {
+		return v.Addr().Interface().(Marshaler).MarshalBorsh(e)
+	}
+
+	if t == bigIntType {
+		if v.CanAddr() {
+			return e.WriteU128(v.Addr().Interface().(*big.Int))
+		}
+		i := v.Interface().(big.Int)
+		return e.WriteU128(&i)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		e.WriteBool(v.Bool())
+	case reflect.Uint8:
+		e.WriteU8(uint8(v.Uint()))
+	case reflect.Uint16:
+		e.WriteU16(uint16(v.Uint()))
+	case reflect.Uint32:
+		e.WriteU32(uint32(v.Uint()))
+	case reflect.Uint64:
+		e.WriteU64(v.Uint())
+	case reflect.Int8:
+		e.WriteU8(uint8(v.Int()))
+	case reflect.Int16:
+		e.WriteU16(uint16(v.Int()))
+	case reflect.Int32:
+		e.WriteU32(uint32(v.Int()))
+	case reflect.Int64:
+		e.WriteU64(uint64(v.Int()))
+	case reflect.Float32:
+		f := float32(v.Float())
+		if f != f {
+			return ErrNaN
+		}
+		e.WriteU32(math.Float32bits(f))
+	case reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) {
+			return ErrNaN
+		}
+		e.WriteU64(math.Float64bits(f))
+	case reflect.String:
+		e.WriteString(v.String())
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			for i := 0; i < v.Len(); i++ {
+				e.WriteU8(uint8(v.Index(i).Uint()))
+			}
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && !reflect.PtrTo(t.Elem()).Implements(marshalerType) {
+			e.WriteBytes(v.Bytes())
+			return nil
+		}
+		e.WriteU32(uint32(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		return e.encodeMap(v)
+	case reflect.Ptr:
+		if v.IsNil() {
+			e.WriteU8(0)
+			return nil
+		}
+		e.WriteU8(1)
+		return e.encodeValue(v.Elem())
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("%v: %s", ErrUnsupportedType, t)
+	}
+	return nil
+}
+
+func (e *Encoder) encodeStruct(v reflect.Value) error {
+	t := v.Type()
+	fields, isEnum, err := structFields(t)
+	if err != nil {
+		return err
+	}
+
+	if isEnum {
+		variant := int(v.Field(fields[0].index).Uint())
+		if variant+1 >= len(fields) {
+			return fmt.Errorf("borsh: %s has no variant %d", t.Name(), variant)
+		}
+		e.WriteU8(uint8(variant))
+		fv := v.Field(fields[variant+1].index)
+		if fv.Kind() == reflect.Ptr && !fv.Type().Implements(marshalerType) {
+			if fv.IsNil() {
+				if fv.Type().Elem().Kind() == reflect.Struct && fv.Type().Elem().NumField() == 0 {
+					return nil
+				}
+				return fmt.Errorf("borsh: %s variant %s is nil", t.Name(), fields[variant+1].name)
+			}
+			fv = fv.Elem()
+		}
+		return e.encodeValue(fv)
+	}
+
+	for _, f := range fields {
+		if err := e.encodeValue(v.Field(f.index)); err != nil {
+			return fmt.Errorf("%s.%s: %v", t.Name(), f.name, err)
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeMap(v reflect.Value) error {
+	keys := v.MapKeys()
+	less, err := keyLess(v.Type().Key())
+	if err != nil {
+		return err
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+
+	e.WriteU32(uint32(len(keys)))
+	for _, k := range keys {
+		if err := e.encodeValue(k); err != nil {
+			return err
+		}
+		if err := e.encodeValue(v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyLess orders map keys the way the Rust implementation does
+func keyLess(t reflect.Type) (func(a, b reflect.Value) bool, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return func(a, b reflect.Value) bool { return a.String() < b.String() }, nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(a, b reflect.Value) bool { return a.Int() < b.Int() }, nil
+	case reflect.Bool:
+		return func(a, b reflect.Value) bool { return !a.Bool() && b.Bool() }, nil
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return func(a, b reflect.Value) bool {
+				for i := 0; i < a.Len(); i++ {
+					if a.Index(i).Uint() != b.Index(i).Uint() {
+						return a.Index(i).Uint() < b.Index(i).Uint()
+					}
+				}
+				return false
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("%v: map key %s", ErrUnsupportedType, t)
+}
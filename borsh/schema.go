@@ -0,0 +1,485 @@
+package borsh
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+type Kind int
+
+const (
+	KindBool Kind = iota
+	KindU8
+	KindU16
+	KindU32
+	KindU64
+	KindU128
+	KindI8
+	KindI16
+	KindI32
+	KindI64
+	KindString
+	KindBytes
+	KindArray
+	KindVec
+	KindOption
+	KindStruct
+	KindEnum
+	KindMap
+	KindUnit
+)
+
+// Schema describes a Borsh type explicitly, for data that has no Go type.
+// Decoded values are plain Go values that marshal cleanly to JSON:
+//
+//	bool                      bool
+//	u8 ... u64, i8 ... i64    uint64, int64
+//	u128                      decimal string
+//	string                    string
+//	bytes (Vec<u8>)           hex string
+//	array, vec                []interface{}, or a hex string for u8 elements
+//	option                    nil or the value
+//	struct                    map[string]interface{}
+//	enum                      map[string]interface{} with the variant name as only key
+//	map                       map[string]interface{} keyed by fmt.Sprint of the key
+//	unit                      nil
+//
+// Encode accepts the same shapes, and also native Go integers and *big.Int.
+type Schema struct {
+	Kind   Kind
+	Len    int      // array length
+	Elem   *Schema  // element of array, vec and option, value of map
+	Key    *Schema  // key of map
+	Fields []*Field // fields of struct, variants of enum
+}
+
+type Field struct {
+	Name   string
+	Schema *Schema
+}
+
+var (
+	Bool   = &Schema{Kind: KindBool}
+	U8     = &Schema{Kind: KindU8}
+	U16    = &Schema{Kind: KindU16}
+	U32    = &Schema{Kind: KindU32}
+	U64    = &Schema{Kind: KindU64}
+	U128   = &Schema{Kind: KindU128}
+	I8     = &Schema{Kind: KindI8}
+	I16    = &Schema{Kind: KindI16}
+	I32    = &Schema{Kind: KindI32}
+	I64    = &Schema{Kind: KindI64}
+	String = &Schema{Kind: KindString}
+	Bytes  = &Schema{Kind: KindBytes}
+	Unit   = &Schema{Kind: KindUnit}
+)
+
+func Array(elem *Schema, length int) *Schema {
+	return &Schema{Kind: KindArray, Elem: elem, Len: length}
+}
+
+func Vec(elem *Schema) *Schema {
+	return &Schema{Kind: KindVec, Elem: elem}
+}
+
+func Option(elem *Schema) *Schema {
+	return &Schema{Kind: KindOption, Elem: elem}
+}
+
+func Map(key, value *Schema) *Schema {
+	return &Schema{Kind: KindMap, Key: key, Elem: value}
+}
+
+func Struct(fields ...*Field) *Schema {
+	return &Schema{Kind: KindStruct, Fields: fields}
+}
+
+// Enum builds an enum schema, variants are given in discriminant order
+func Enum(variants ...*Field) *Schema {
+	return &Schema{Kind: KindEnum, Fields: variants}
+}
+
+func NewField(name string, schema *Schema) *Field {
+	return &Field{Name: name, Schema: schema}
+}
+
+// Decode decodes data, which must be consumed entirely
+func (s *Schema) Decode(data []byte) (interface{}, error) {
+	d := NewDecoder(data)
+	v, err := d.DecodeSchema(s)
+	if err != nil {
+		return nil, err
+	}
+	if d.Remaining() != 0 {
+		return nil, ErrTrailingBytes
+	}
+	return v, nil
+}
+
+// Encode encodes v according to the schema
+func (s *Schema) Encode(v interface{}) ([]byte, error) {
+	e := NewEncoder()
+	if err := e.EncodeSchema(s, v); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// DecodeSchema reads one value described by s
+func (d *Decoder) DecodeSchema(s *Schema) (interface{}, error) {
+	switch s.Kind {
+	case KindBool:
+		return d.ReadBool()
+	case KindU8:
+		n, err := d.ReadU8()
+		return uint64(n), err
+	case KindU16:
+		n, err := d.ReadU16()
+		return uint64(n), err
+	case KindU32:
+		n, err := d.ReadU32()
+		return uint64(n), err
+	case KindU64:
+		return d.ReadU64()
+	case KindU128:
+		n, err := d.ReadU128()
+		if err != nil {
+			return nil, err
+		}
+		return n.String(), nil
+	case KindI8:
+		n, err := d.ReadU8()
+		return int64(int8(n)), err
+	case KindI16:
+		n, err := d.ReadU16()
+		return int64(int16(n)), err
+	case KindI32:
+		n, err := d.ReadU32()
+		return int64(int32(n)), err
+	case KindI64:
+		n, err := d.ReadU64()
+		return int64(n), err
+	case KindString:
+		return d.ReadString()
+	case KindBytes:
+		b, err := d.ReadBytes()
+		if err != nil {
+			return nil, err
+		}
+		return hex.EncodeToString(b), nil
+	case KindArray:
+		if s.Elem.Kind == KindU8 {
+			b, err := d.ReadFixedBytes(s.Len)
+			if err != nil {
+				return nil, err
+			}
+			return hex.EncodeToString(b), nil
+		}
+		return d.decodeSchemaList(s.Elem, s.Len)
+	case KindVec:
+		length, err := d.ReadU32()
+		if err != nil {
+			return nil, err
+		}
+		if s.Elem.Kind == KindU8 {
+			b, err := d.ReadFixedBytes(int(length))
+			if err != nil {
+				return nil, err
+			}
+			return hex.EncodeToString(b), nil
+		}
+		if int(length) > d.Remaining() && s.Elem.Kind != KindUnit {
+			return nil, ErrUnexpectedEOF
+		}
+		return d.decodeSchemaList(s.Elem, int(length))
+	case KindOption:
+		tag, err := d.ReadU8()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case 0:
+			return nil, nil
+		case 1:
+			return d.DecodeSchema(s.Elem)
+		}
+		return nil, ErrInvalidOption
+	case KindStruct:
+		obj := make(map[string]interface{}, len(s.Fields))
+		for _, f := range s.Fields {
+			v, err := d.DecodeSchema(f.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+			obj[f.Name] = v
+		}
+		return obj, nil
+	case KindEnum:
+		variant, err := d.ReadU8()
+		if err != nil {
+			return nil, err
+		}
+		if int(variant) >= len(s.Fields) {
+			return nil, fmt.Errorf("borsh: enum has no variant %d", variant)
+		}
+		f := s.Fields[variant]
+		v, err := d.DecodeSchema(f.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		return map[string]interface{}{f.Name: v}, nil
+	case KindMap:
+		length, err := d.ReadU32()
+		if err != nil {
+			return nil, err
+		}
+		if int(length) > d.Remaining() {
+			return nil, ErrUnexpectedEOF
+		}
+		obj := make(map[string]interface{}, length)
+		for i := 0; i < int(length); i++ {
+			k, err := d.DecodeSchema(s.Key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.DecodeSchema(s.Elem)
+			if err != nil {
+				return nil, err
+			}
+			obj[fmt.Sprint(k)] = v
+		}
+		return obj, nil
+	case KindUnit:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%v: schema kind %d", ErrUnsupportedType, s.Kind)
+}
+
+func (d *Decoder) decodeSchemaList(elem *Schema, length int) ([]interface{}, error) {
+	list := make([]interface{}, 0, length)
+	for i := 0; i < length; i++ {
+		v, err := d.DecodeSchema(elem)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// EncodeSchema writes v as the type described by s
+func (e *Encoder) EncodeSchema(s *Schema, v interface{}) error {
+	switch s.Kind {
+	case KindBool:
+		b, ok := v.(bool)
+		if !ok {
+			return schemaTypeError(s, v)
+		}
+		e.WriteBool(b)
+	case KindU8, KindU16, KindU32, KindU64, KindU128, KindI8, KindI16, KindI32, KindI64:
+		return e.encodeSchemaInteger(s, v)
+	case KindString:
+		str, ok := v.(string)
+		if !ok {
+			return schemaTypeError(s, v)
+		}
+		e.WriteString(str)
+	case KindBytes:
+		b, err := schemaBytes(v)
+		if err != nil {
+			return err
+		}
+		e.WriteBytes(b)
+	case KindArray, KindVec:
+		if s.Elem.Kind == KindU8 {
+			if b, err := schemaBytes(v); err == nil {
+				if s.Kind == KindArray {
+					if len(b) != s.Len {
+						return fmt.Errorf("borsh: expect %d bytes, got %d", s.Len, len(b))
+					}
+					e.WriteFixedBytes(b)
+				} else {
+					e.WriteBytes(b)
+				}
+				return nil
+			}
+		}
+		list, ok := v.([]interface{})
+		if !ok {
+			return schemaTypeError(s, v)
+		}
+		if s.Kind == KindArray {
+			if len(list) != s.Len {
+				return fmt.Errorf("borsh: expect %d elements, got %d", s.Len, len(list))
+			}
+		} else {
+			e.WriteU32(uint32(len(list)))
+		}
+		for _, item := range list {
+			if err := e.EncodeSchema(s.Elem, item); err != nil {
+				return err
+			}
+		}
+	case KindOption:
+		if v == nil {
+			e.WriteU8(0)
+			return nil
+		}
+		e.WriteU8(1)
+		return e.EncodeSchema(s.Elem, v)
+	case KindStruct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return schemaTypeError(s, v)
+		}
+		for _, f := range s.Fields {
+			fv, exist := obj[f.Name]
+			if !exist && f.Schema.Kind != KindOption && f.Schema.Kind != KindUnit {
+				return fmt.Errorf("borsh: missing field %s", f.Name)
+			}
+			if err := e.EncodeSchema(f.Schema, fv); err != nil {
+				return fmt.Errorf("%s: %v", f.Name, err)
+			}
+		}
+	case KindEnum:
+		obj, ok := v.(map[string]interface{})
+		if !ok || len(obj) != 1 {
+			return schemaTypeError(s, v)
+		}
+		for i, f := range s.Fields {
+			if fv, exist := obj[f.Name]; exist {
+				e.WriteU8(uint8(i))
+				return e.EncodeSchema(f.Schema, fv)
+			}
+		}
+		return fmt.Errorf("borsh: unknown enum variant in %v", v)
+	case KindMap:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return schemaTypeError(s, v)
+		}
+		if s.Key.Kind != KindString {
+			return fmt.Errorf("%v: schema map key must be string", ErrUnsupportedType)
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.WriteU32(uint32(len(keys)))
+		for _, k := range keys {
+			e.WriteString(k)
+			if err := e.EncodeSchema(s.Elem, obj[k]); err != nil {
+				return err
+			}
+		}
+	case KindUnit:
+	default:
+		return fmt.Errorf("%v: schema kind %d", ErrUnsupportedType, s.Kind)
+	}
+	return nil
+}
+
+var integerBits = map[Kind]struct {
+	bits   int
+	signed bool
+}{
+	KindU8: {8, false}, KindU16: {16, false}, KindU32: {32, false}, KindU64: {64, false}, KindU128: {128, false},
+	KindI8: {8, true}, KindI16: {16, true}, KindI32: {32, true}, KindI64: {64, true},
+}
+
+func (e *Encoder) encodeSchemaInteger(s *Schema, v interface{}) error {
+	n := new(big.Int)
+	switch x := v.(type) {
+	case int:
+		n.SetInt64(int64(x))
+	case int8:
+		n.SetInt64(int64(x))
+	case int16:
+		n.SetInt64(int64(x))
+	case int32:
+		n.SetInt64(int64(x))
+	case int64:
+		n.SetInt64(x)
+	case uint:
+		n.SetUint64(uint64(x))
+	case uint8:
+		n.SetUint64(uint64(x))
+	case uint16:
+		n.SetUint64(uint64(x))
+	case uint32:
+		n.SetUint64(uint64(x))
+	case uint64:
+		n.SetUint64(x)
+	case float64:
+		// numbers decoded by encoding/json
+		if x != float64(int64(x)) {
+			return schemaTypeError(s, v)
+		}
+		n.SetInt64(int64(x))
+	case string:
+		if _, ok := n.SetString(x, 10); !ok {
+			return schemaTypeError(s, v)
+		}
+	case *big.Int:
+		if x == nil {
+			return schemaTypeError(s, v)
+		}
+		n.Set(x)
+	default:
+		return schemaTypeError(s, v)
+	}
+
+	info := integerBits[s.Kind]
+	if info.signed {
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(info.bits-1))
+		if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return fmt.Errorf("borsh: %s overflows i%d", n, info.bits)
+		}
+		u := n.Int64()
+		switch info.bits {
+		case 8:
+			e.WriteU8(uint8(u))
+		case 16:
+			e.WriteU16(uint16(u))
+		case 32:
+			e.WriteU32(uint32(u))
+		default:
+			e.WriteU64(uint64(u))
+		}
+		return nil
+	}
+
+	if n.Sign() < 0 || n.BitLen() > info.bits {
+		return fmt.Errorf("borsh: %s overflows u%d", n, info.bits)
+	}
+	switch info.bits {
+	case 8:
+		e.WriteU8(uint8(n.Uint64()))
+	case 16:
+		e.WriteU16(uint16(n.Uint64()))
+	case 32:
+		e.WriteU32(uint32(n.Uint64()))
+	case 64:
+		e.WriteU64(n.Uint64())
+	default:
+		return e.WriteU128(n)
+	}
+	return nil
+}
+
+func schemaBytes(v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case []byte:
+		return x, nil
+	case string:
+		return hex.DecodeString(x)
+	}
+	return nil, fmt.Errorf("%v: expect bytes, got %T", ErrUnsupportedType, v)
+}
+
+func schemaTypeError(s *Schema, v interface{}) error {
+	return fmt.Errorf("borsh: cannot encode %T as schema kind %d", v, s.Kind)
+}
@@ -1,6 +1,6 @@
 module github.com/blocktree/near-adapter
 
-go 1.12
+go 1.13
 
 require (
 	github.com/asdine/storm v2.1.2+incompatible
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+// AccessKeyInfo view_access_key_list 返回的一个access key，
+// nonce、权限、剩余额度和可调用的方法见 nearTransaction.AccessKey
+type AccessKeyInfo struct {
+	PublicKey *nearKey.PublicKey
+	AccessKey *nearTransaction.AccessKey
+}
+
+// AccessKeyAudit 托管账户上的一个access key的审计结果
+type AccessKeyAudit struct {
+	AccountID string
+	AccessKeyInfo
+	//链上的key不是本钱包秘钥派生的公钥
+	Unknown bool
+	//本钱包派生的公钥已不在链上，AccessKey 为nil
+	Missing bool
+}
+
+// AuditAccessKeys 列出资产账户下所有地址在链上的access key，按地址的HDPath从钱包秘钥派生公钥，
+// 标记不是本钱包派生的key，以及已被删除的本钱包key，未激活的隐式账户跳过。
+// wrapper 的钱包需要已解锁，地址记录中的公钥与派生的公钥不一致时返回错误
+func (wm *WalletManager) AuditAccessKeys(wrapper openwallet.WalletDAI, accountID string) ([]*AccessKeyAudit, error) {
+	hdKey, err := wrapper.HDKey()
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	audits := make([]*AccessKeyAudit, 0)
+	for _, addr := range addresses {
+		childKey, err := hdKey.DerivedKeyWithPath(addr.HDPath, wm.Config.CurveType)
+		if err != nil {
+			return nil, fmt.Errorf("derive key of %s failed: %v", addr.Address, err)
+		}
+		owned, err := nearKey.NewPublicKey(hex.EncodeToString(childKey.GetPublicKeyBytes()))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key of %s: %v", addr.Address, err)
+		}
+		if recorded, err := nearKey.ParsePublicKey(addr.PublicKey); err != nil || !recorded.Equal(owned) {
+			return nil, fmt.Errorf("public key of %s does not match the keystore", addr.Address)
+		}
+
+		keys, err := wm.Client.GetAccessKeyList(context.Background(), addr.Address)
+		if err != nil {
+			return nil, err
+		}
+		if keys == nil {
+			continue
+		}
+
+		found := false
+		for _, key := range keys {
+			unknown := !key.PublicKey.Equal(owned)
+			if unknown {
+				wm.Log.Std.Warning("%s has access key %s which is not in the keystore", addr.Address, key.PublicKey)
+			} else {
+				found = true
+			}
+			audits = append(audits, &AccessKeyAudit{AccountID: addr.Address, AccessKeyInfo: *key, Unknown: unknown})
+		}
+		if !found {
+			wm.Log.Std.Warning("access key %s of %s has been deleted", owned, addr.Address)
+			audits = append(audits, &AccessKeyAudit{AccountID: addr.Address, AccessKeyInfo: AccessKeyInfo{PublicKey: owned}, Missing: true})
+		}
+	}
+	return audits, nil
+}
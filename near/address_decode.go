@@ -19,32 +19,33 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
 	"github.com/blocktree/openwallet/v2/openwallet"
-	"regexp"
 )
 
 
 type AddressDecoderV2 struct {
 	openwallet.AddressDecoderV2Base
+	wm *WalletManager
 }
 
 //NewAddressDecoder 地址解析器
 func NewAddressDecoderV2(wm *WalletManager) *AddressDecoderV2 {
-	decoder := AddressDecoderV2{}
+	decoder := AddressDecoderV2{wm: wm}
 	return &decoder
 }
 
-//AddressDecode 地址解析
+//AddressDecode 地址解析，隐式账户解析为ed25519公钥
 func (dec *AddressDecoderV2) AddressDecode(addr string, opts ...interface{}) ([]byte, error) {
 	if len(addr) != 64 {
 		return nil, errors.New("cannot decode account id")
 	}
-	pub, err := hex.DecodeString(addr)
-
-	if err != nil || len(pub) != 32 {
+	pub, err := nearKey.NewPublicKey(addr)
+	if err != nil {
 		return nil, err
 	}
-	return pub, nil
+	return pub.Key, nil
 }
 
 //AddressEncode 地址编码
@@ -54,52 +55,50 @@ func (dec *AddressDecoderV2) AddressEncode(hash []byte, opts ...interface{}) (st
 		return "", errors.New("invalid hash input")
 	}
 
-	return hex.EncodeToString(hash), nil
+	return (&nearKey.PublicKey{KeyType: nearKey.KeyTypeED25519, Key: hash}).ImplicitAccountID()
 }
 
 // AddressVerify 地址校验
 func (dec *AddressDecoderV2) AddressVerify(address string, opts ...interface{}) bool {
-	pattern := `^(([a-z\d]+[\-_])*[a-z\d]+\.)*([a-z\d]+[\-_])*[a-z\d]+$`
-
-	if len(address) < 2 || len(address) > 64 {
-		return false
-	}
-
-	if len(address) == 64 {
-		pub, err := hex.DecodeString(address)
+	return nearTransaction.ValidateAccountID(address) == nil
+}
 
-		if err != nil || len(pub) != 32 {
-			return false
+//PrivateKeyToWIF 私钥转为NEAR密钥字符串，如 ed25519:<base58>
+func (dec *AddressDecoderV2) PrivateKeyToWIF(priv []byte, isTestnet bool) (string, error) {
+	keyType := nearKey.KeyTypeED25519
+	if dec.wm != nil && dec.wm.Config != nil {
+		t, err := nearTransaction.KeyTypeByCurve(dec.wm.Config.CurveType)
+		if err != nil {
+			return "", err
 		}
-		return true
+		keyType = t
 	}
 
-	matched, err := regexp.MatchString(pattern, address)
-	if err != nil && matched == true {
-		return true
+	secretKey, err := nearKey.NewSecretKey(keyType, priv)
+	if err != nil {
+		return "", err
 	}
-
-	return false
-}
-
-//PrivateKeyToWIF 私钥转WIF
-func (dec *AddressDecoderV2) PrivateKeyToWIF(priv []byte, isTestnet bool) (string, error) {
-	return "", fmt.Errorf("PrivateKeyToWIF not implement")
+	return secretKey.String(), nil
 }
 
-//PublicKeyToAddress 公钥转地址
+//PublicKeyToAddress 公钥转地址，即隐式账户
 func (dec *AddressDecoderV2) PublicKeyToAddress(pub []byte, isTestnet bool) (string, error) {
 
-	if len(pub) != 32 {
+	publicKey, err := nearKey.NewPublicKey(hex.EncodeToString(pub))
+	if err != nil {
 		return "", errors.New("invalid pub input")
 	}
 
-	return hex.EncodeToString(pub), nil
+	return publicKey.ImplicitAccountID()
 }
 
-//WIFToPrivateKey WIF转私钥
+//WIFToPrivateKey NEAR密钥字符串转为32字节私钥
 func (dec *AddressDecoderV2) WIFToPrivateKey(wif string, isTestnet bool) ([]byte, error) {
-	return nil, fmt.Errorf("WIFToPrivateKey not implement")
+	secretKey, err := nearKey.ParseSecretKey(wif)
+	if err != nil {
+		return nil, err
+	}
+	return secretKey.PrivateKey(), nil
 }
 
 //RedeemScriptToAddress 多重签名赎回脚本转地址
@@ -16,21 +16,25 @@
 package near
 
 import (
-	"fmt"
 	"testing"
 
+	"github.com/blocktree/near-adapter/nearTransaction"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/pborman/uuid"
 )
 
 func TestGetBTCBlockHeight(t *testing.T) {
+	tw, node := testNewWalletManager(t)
+	node.ProduceBlocks(2)
 	height, err := tw.GetBlockHeight()
 	if err != nil {
 		t.Errorf("GetBlockHeight failed unexpected error: %v\n", err)
 		return
 	}
-	t.Logf("GetBlockHeight height = %d \n", height)
+	if height != node.Head().Height {
+		t.Errorf("GetBlockHeight height = %d, expected %d", height, node.Head().Height)
+	}
 }
 
 // func TestONTBlockScanner_GetCurrentBlockHeight(t *testing.T) {
@@ -41,13 +45,23 @@ func TestGetBTCBlockHeight(t *testing.T) {
 // }
 
 func TestGetCurrentBlockHeight(t *testing.T) {
-	header, _ := tw.Blockscanner.GetCurrentBlockHeader()
-	fmt.Println(header)
+	tw, node := testNewWalletManager(t)
+	node.ProduceBlock()
+	header, err := tw.Blockscanner.GetCurrentBlockHeader()
+	if err != nil || header.Height != node.Head().Height || header.Hash != node.Head().Hash {
+		t.Errorf("GetCurrentBlockHeader = %+v, %v", header, err)
+	}
 }
 
 func TestGetBlockHeight(t *testing.T) {
-	height, _ := tw.GetBlockHeight()
-	t.Logf("GetBlockHeight height = %d \n", height)
+	tw, node := testNewWalletManager(t)
+	for i := 0; i < 3; i++ {
+		node.ProduceBlock()
+		height, err := tw.GetBlockHeight()
+		if err != nil || height != node.Head().Height {
+			t.Errorf("GetBlockHeight height = %d, %v, expected %d", height, err, node.Head().Height)
+		}
+	}
 }
 
 //func TestGetLocalNewBlock(t *testing.T) {
@@ -65,21 +79,31 @@ func TestGetBlockHeight(t *testing.T) {
 // }
 
 func TestGetBlockHash(t *testing.T) {
-	hash, err := tw.GetBlockHash(94573)
+	tw, node := testNewWalletManager(t)
+	block := node.ProduceBlock()
+	node.ProduceBlocks(2)
+	hash, err := tw.GetBlockHash(block.Height)
 	if err != nil {
 		t.Errorf("GetBlockHash failed unexpected error: %v\n", err)
 		return
 	}
-	t.Logf("GetBlockHash hash = %s \n", hash)
+	if hash != block.Hash {
+		t.Errorf("GetBlockHash hash = %s, expected %s", hash, block.Hash)
+	}
 }
 
 func TestGetBlock(t *testing.T) {
-	raw, err := tw.GetBlock("000000000000000127454a8c91e74cf93ad76752cceb7eb3bcff0c398ba84b1f")
+	tw, node := testNewWalletManager(t)
+	parent := node.ProduceBlock()
+	block := node.ProduceBlock()
+	raw, err := tw.GetBlock(block.Hash)
 	if err != nil {
 		t.Errorf("GetBlock failed unexpected error: %v\n", err)
 		return
 	}
-	t.Logf("GetBlock = %v \n", raw)
+	if raw.Height != block.Height || raw.PrevBlockHash != parent.Hash {
+		t.Errorf("GetBlock = %+v", raw)
+	}
 }
 
 func TestGetTransaction(t *testing.T) {
@@ -113,6 +137,7 @@ func TestGetTransaction(t *testing.T) {
 }
 
 func TestGetTxIDsInMemPool(t *testing.T) {
+	tw, _ := testNewWalletManager(t)
 	txids, err := tw.GetTxIDsInMemPool()
 	if err != nil {
 		t.Errorf("GetTxIDsInMemPool failed unexpected error: %v\n", err)
@@ -178,9 +203,13 @@ func TestONTBlockScanner_ScanBlock(t *testing.T) {
 	//accountID := "WDHupMjR3cR2wm97iDtKajxSPCYEEddoek"
 	//address := "msnYsBdBXQZqYYqNNJZsjShzwCx9fJVSin"
 
+	tw, node := testNewWalletManager(t)
+	block := node.ProduceBlock()
 	bs := tw.Blockscanner
 	//bs.AddAddress(address, accountID)
-	bs.ScanBlock(1384961)
+	if err := bs.ScanBlock(block.Height); err != nil {
+		t.Error(err)
+	}
 }
 
 func TestONTBlockScanner_ExtractTransaction(t *testing.T) {
@@ -198,6 +227,8 @@ func TestONTBlockScanner_ExtractTransaction(t *testing.T) {
 }
 
 func TestWallet_GetRecharges(t *testing.T) {
+	//需要本地钱包数据 data/near/key
+	tw := testIntegrationWalletManager(t)
 	accountID := "WFvvr5q83WxWp1neUMiTaNuH7ZbaxJFpWu"
 	wallet, err := tw.GetWalletInfo(accountID)
 	if err != nil {
@@ -249,6 +280,7 @@ func TestFullAddress(t *testing.T) {
 }
 
 func TestONTBlockScanner_GetTransactionsByAddress(t *testing.T) {
+	tw := testIntegrationWalletManager(t)
 	coin := openwallet.Coin{
 		Symbol:     "BTC",
 		IsContract: false,
@@ -282,6 +314,7 @@ func TestONTBlockScanner_GetTransactionsByAddress(t *testing.T) {
 //}
 
 func Test_GetTransaction(t *testing.T) {
+	tw := testIntegrationWalletManager(t)
 	txid := "dc55118ac9442af38a0ec85bcce54a8f8d68ba65de0120a8739d90b9d93b6ca2"
 
 	trans, err := tw.GetTransaction(txid)
@@ -304,3 +337,40 @@ func Test_GetTransaction(t *testing.T) {
 // 	}
 // 	fmt.Println(string(txid))
 // }
+
+func TestMockClient_Scanner(t *testing.T) {
+	wm := NewWalletManager()
+	client := newMockClient(100)
+	wm.Client = client
+	bs := wm.Blockscanner
+
+	client.blocks[100] = &Block{Hash: "h100", PrevBlockHash: "h99", Height: 100}
+	header, err := bs.GetCurrentBlockHeader()
+	if err != nil || header.Height != 100 || header.Hash != "h100" {
+		t.Fatalf("wrong block header %+v %v", header, err)
+	}
+
+	amount, _ := nearTransaction.ParseNEAR("1.5")
+	fee, _ := nearTransaction.ParseYocto("42455506250000000000")
+	client.transactions["tx1"] = &Transaction{TxType: "transfer", TxID: "tx1", From: "alice.near", To: "bob.near",
+		Amount: amount, Fee: fee, BlockHeight: 98, BlockHash: "h98"}
+	bs.SetBlockScanTargetFuncV2(func(target openwallet.ScanTargetParam) openwallet.ScanTargetResult {
+		return openwallet.ScanTargetResult{SourceKey: "account", Exist: target.ScanTarget == "alice.near"}
+	})
+
+	result := bs.ExtractTransaction(0, "", "tx1", nil, false)
+	inputs := result.extractData["account"].TxInputs
+	if !result.Success || len(inputs) != 2 || inputs[0].Amount != "1.5" || inputs[0].Confirm != 2 ||
+		inputs[1].Amount != "0.00004245550625" {
+		t.Fatalf("wrong extracted inputs %+v", result)
+	}
+	if result := bs.ExtractTransaction(0, "", "tx2", nil, false); result.Success {
+		t.Error("unknown transaction should fail")
+	}
+
+	client.balances["alice.near"] = amount.BigInt()
+	balances, err := bs.GetBalanceByAddress("alice.near", "carol.near")
+	if err != nil || balances[0].Balance != "1.5" || balances[1].Balance != "0" {
+		t.Errorf("wrong balances %+v %v", balances, err)
+	}
+}
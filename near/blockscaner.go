@@ -16,18 +16,21 @@
 package near
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
 	"net/url"
 
 	"github.com/asdine/storm"
+	"github.com/blocktree/near-adapter/nearTransaction"
 	"github.com/blocktree/openwallet/v2/common"
 	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/graarh/golang-socketio"
 	"github.com/graarh/golang-socketio/transport"
 	"github.com/shopspring/decimal"
 	"strings"
+	"sync"
 	"time"
 	//"github.com/blocktree/go-owcdrivers/rippleTransaction"
 )
@@ -48,6 +51,10 @@ type NBlockScanner struct {
 	RescanLastBlockCount uint64             //重扫上N个区块数量
 	socketIO             *gosocketio.Client //socketIO客户端
 	RPCServer            int
+
+	ctxMu  sync.Mutex
+	ctx    context.Context    //扫描任务的ctx，停止或暂停时取消，正在进行的请求立即返回
+	cancel context.CancelFunc
 }
 
 //ExtractResult 扫描完成的提取结果
@@ -102,6 +109,14 @@ func (bs *NBlockScanner) SetRescanBlockHeight(height uint64) error {
 //ScanBlockTask 扫描任务
 func (bs *NBlockScanner) ScanBlockTask() {
 
+	ctx := bs.scanContext()
+
+	//节点未同步或网络不一致时不扫块
+	if err := bs.wm.CheckNode(); err != nil {
+		bs.wm.Log.Std.Error("block scanner refused the node: %v", err)
+		return
+	}
+
 	//获取本地区块高度
 	blockHeader, err := bs.GetScannedBlockHeader()
 	if err != nil {
@@ -115,13 +130,13 @@ func (bs *NBlockScanner) ScanBlockTask() {
 
 	for {
 
-		if !bs.Scanning {
+		if !bs.Scanning || ctx.Err() != nil {
 			//区块扫描器已暂停，马上结束本次任务
 			return
 		}
 
 		//获取最大高度
-		maxHeight, err := bs.wm.GetBlockHeight()
+		maxHeight, err := bs.wm.Client.GetBlockHeight(ctx)
 		if err != nil {
 			//下一个高度找不到会报异常
 			bs.wm.Log.Std.Info("block scanner can not get rpc-server block height; unexpected error: %v", err)
@@ -141,16 +156,13 @@ func (bs *NBlockScanner) ScanBlockTask() {
 
 		var localBlock *Block
 
-		localBlock, err = bs.wm.Client.getBlockByHeight(currentHeight)
+		localBlock, err = bs.wm.Client.GetBlockByHeight(ctx, currentHeight)
 
 		if err != nil {
 			//if strings.Contains(err.Error(), "{\"code\":-32000,\"message\":\"Server error\",\"data\":\"DB Not Found Error: BLOCK HEIGHT") {
 			//if strings.Contains(err.Error(), "[-32000]{\"name\":\"HANDLER_ERROR\",\"cause\":{\"info\":{},\"name\":\"UNKNOWN_BLOCK\"}") {
-			errResp := err.Error()
-			if strings.Contains(errResp, "[-32000]") &&
-				strings.Contains(errResp, "HANDLER_ERROR") &&
-				strings.Contains(errResp, "UNKNOWN_BLOCK") &&
-				strings.Contains(errResp, "DB Not Found Error: BLOCK HEIGHT") {
+			//该高度没有出块
+			if errors.Is(err, ErrUnknownBlock) {
 				continue
 			} else {
 				bs.wm.Log.Std.Info("getBlockByHeight failed; unexpected error: %v", err)
@@ -187,7 +199,7 @@ func (bs *NBlockScanner) ScanBlockTask() {
 				//查找core钱包的RPC
 				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
 
-				localBlock, err = bs.wm.Client.getBlockByHeight(currentHeight)
+				localBlock, err = bs.wm.Client.GetBlockByHeight(ctx, currentHeight)
 
 				if err != nil {
 					//if strings.Contains(err.Error(), "{\"code\":-32000,\"message\":\"Server error\",\"data\":\"DB Not Found Error: BLOCK HEIGHT") {
@@ -236,9 +248,13 @@ func (bs *NBlockScanner) ScanBlockTask() {
 		bs.newBlockNotify(localBlock, isFork)
 	}
 
+	if ctx.Err() != nil {
+		return
+	}
+
 	//重扫前N个块，为保证记录找到
-	for i := currentHeight - bs.RescanLastBlockCount; i < currentHeight; i++ {
-		bs.scanBlock(i)
+	for i := currentHeight - bs.RescanLastBlockCount; i < currentHeight && ctx.Err() == nil; i++ {
+		bs.scanBlock(ctx, i)
 	}
 
 	if bs.IsScanMemPool {
@@ -254,7 +270,7 @@ func (bs *NBlockScanner) ScanBlockTask() {
 //ScanBlock 扫描指定高度区块
 func (bs *NBlockScanner) ScanBlock(height uint64) error {
 
-	block, err := bs.scanBlock(height)
+	block, err := bs.scanBlock(context.Background(), height)
 	if err != nil {
 		return err
 	}
@@ -264,14 +280,18 @@ func (bs *NBlockScanner) ScanBlock(height uint64) error {
 	return nil
 }
 
-func (bs *NBlockScanner) scanBlock(height uint64) (*Block, error) {
+func (bs *NBlockScanner) scanBlock(ctx context.Context, height uint64) (*Block, error) {
 	var (
 		block *Block
 		err   error
 	)
-	block, err = bs.wm.Client.getBlockByHeight(height)
+	block, err = bs.wm.Client.GetBlockByHeight(ctx, height)
 
 	if err != nil {
+		if ctx.Err() != nil {
+			//扫描器已停止，不记录未扫区块
+			return nil, err
+		}
 		bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
 
 		//记录未扫区块
@@ -353,7 +373,7 @@ func (bs *NBlockScanner) RescanFailedRecord() {
 
 				var block *Block
 
-				block, err = bs.wm.Client.getBlockByHeight(height)
+				block, err = bs.wm.Client.GetBlockByHeight(context.Background(), height)
 
 				if err != nil {
 					bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
@@ -536,8 +556,8 @@ func (bs *NBlockScanner) ExtractTransaction(blockHeight uint64, blockHash string
 		if err != nil {
 			fmt.Println(err.Error())
 			fmt.Println(txid)
-			if err.Error() == "txnNotFound" {
-				trx, err = bs.wm.Client.getTransaction(txid)
+			if errors.Is(err, ErrUnknownTransaction) {
+				trx, err = bs.wm.Client.GetTransaction(context.Background(), txid)
 				if err != nil {
 					bs.wm.Log.Std.Info("block scanner can not extract transaction data; unexpected error: %v", err)
 					result.Success = false
@@ -563,21 +583,19 @@ func (bs *NBlockScanner) ExtractTransaction(blockHeight uint64, blockHash string
 
 }
 
-// 从最小单位的 amount 转为带小数点的表示
+// 从最小单位的 amount 转为带小数点的表示，不丢失精度
 func convertToAmount(amount *big.Int) string {
-	d := decimal.NewFromBigInt(amount, 0)
-	w, _ := decimal.NewFromString("1000000000000000000000000")
-	d = d.Div(w)
-	return d.String()
+	a, err := nearTransaction.NewYoctoAmount(amount)
+	if err != nil {
+		// 超出 u128 范围（如负数余额）时按精确小数输出
+		return decimal.NewFromBigInt(amount, -nearTransaction.NEARDecimals).String()
+	}
+	return a.String()
 }
 
-// amount 字符串转为最小单位的表示
-func convertFromAmount(amountStr string) *big.Int {
-	d, _ := decimal.NewFromString(amountStr)
-	w, _ := decimal.NewFromString("1000000000000000000000000")
-	d = d.Mul(w)
-	r, _ := new(big.Int).SetString(d.String(), 10)
-	return r
+// amount 字符串转为最小单位的表示，格式错误、超过24位小数或超出 u128 范围时返回错误
+func convertFromAmount(amountStr string) (nearTransaction.YoctoAmount, error) {
+	return nearTransaction.ParseNEAR(amountStr)
 }
 
 //ExtractTransactionData 提取交易单
@@ -591,7 +609,7 @@ func (bs *NBlockScanner) extractTransaction(trx *Transaction, result *ExtractRes
 		err           error
 	)
 
-	currentHeight, err = bs.wm.Client.getBlockHeight()
+	currentHeight, err = bs.wm.Client.GetBlockHeight(context.Background())
 
 	if trx == nil || err != nil {
 		//记录哪个区块哪个交易单没有完成扫描
@@ -633,7 +651,7 @@ func (bs *NBlockScanner) extractTransaction(trx *Transaction, result *ExtractRes
 				input := openwallet.TxInput{}
 				input.TxID = trx.TxID
 				input.Address = trx.From
-				input.Amount = convertToAmount(trx.Amount)
+				input.Amount = trx.Amount.String()
 				input.Coin = openwallet.Coin{
 					Symbol:     bs.wm.Symbol(),
 					IsContract: false,
@@ -656,7 +674,7 @@ func (bs *NBlockScanner) extractTransaction(trx *Transaction, result *ExtractRes
 				feeCharge := &tmp
 				feeCharge.Index = 1
 				feeCharge.Sid = openwallet.GenTxInputSID(trx.TxID, bs.wm.Symbol(), "", uint64(1))
-				feeCharge.Amount = convertToAmount(trx.Fee)
+				feeCharge.Amount = trx.Fee.String()
 				ed.TxInputs = append(ed.TxInputs, feeCharge)
 
 				//}
@@ -708,7 +726,7 @@ func (bs *NBlockScanner) extractTransaction(trx *Transaction, result *ExtractRes
 					output := openwallet.TxOutPut{}
 					output.TxID = trx.TxID
 					output.Address = trx.To
-					output.Amount = convertToAmount(trx.Amount)
+					output.Amount = trx.Amount.String()
 					output.Coin = openwallet.Coin{
 						Symbol:     bs.wm.Symbol(),
 						IsContract: false,
@@ -740,10 +758,10 @@ func (bs *NBlockScanner) extractTransaction(trx *Transaction, result *ExtractRes
 					//fmt.Println("[M:wrong_status] txid-", trx.TxID, " status-", trx.Status)
 				}
 				tx := &openwallet.Transaction{
-					From:   []string{trx.From + ":" + convertToAmount(trx.Amount)},
-					To:     []string{trx.To + ":" + convertToAmount(trx.Amount)},
-					Amount: convertToAmount(trx.Amount),
-					Fees:   convertToAmount(trx.Fee),
+					From:   []string{trx.From + ":" + trx.Amount.String()},
+					To:     []string{trx.To + ":" + trx.Amount.String()},
+					Amount: trx.Amount.String(),
+					Fees:   trx.Fee.String(),
 					Coin: openwallet.Coin{
 						Symbol:     bs.wm.Symbol(),
 						IsContract: false,
@@ -878,7 +896,7 @@ func (bs *NBlockScanner) GetCurrentBlockHeader() (*openwallet.BlockHeader, error
 	}
 	var block *Block
 
-	block, err = bs.wm.Client.getBlockByHeight(blockHeight)
+	block, err = bs.wm.Client.GetBlockByHeight(context.Background(), blockHeight)
 
 	if err != nil {
 		bs.wm.Log.Errorf("get block spec by block number failed, err=%v", err)
@@ -915,7 +933,7 @@ func (bs *NBlockScanner) GetScannedBlockHeader() (*openwallet.BlockHeader, error
 		blockHeight = blockHeight - 1
 		var block *Block
 
-		block, err = bs.wm.Client.getBlockByHeight(blockHeight)
+		block, err = bs.wm.Client.GetBlockByHeight(context.Background(), blockHeight)
 
 		if err != nil {
 			bs.wm.Log.Errorf("get block spec by block number failed, err=%v", err)
@@ -1039,7 +1057,7 @@ func (bs *NBlockScanner) GetSourceKeyByAddress(address string) (string, bool) {
 
 //GetBlockHeight 获取区块链高度
 func (wm *WalletManager) GetBlockHeight() (uint64, error) {
-	return wm.Client.getBlockHeight()
+	return wm.Client.GetBlockHeight(context.Background())
 }
 
 //GetLocalNewBlock 获取本地记录的区块高度和hash
@@ -1076,12 +1094,12 @@ func (bs *NBlockScanner) SaveLocalNewBlock(blockHeight uint64, blockHash string)
 
 //GetBlockHash 根据区块高度获得区块hash
 func (wm *WalletManager) GetBlockHash(height uint64) (string, error) {
-	return wm.Client.getBlockHash(height)
+	return wm.Client.GetBlockHash(context.Background(), height)
 }
 
 //GetBlock 获取区块数据
 func (wm *WalletManager) GetBlock(hash string) (*Block, error) {
-	return wm.Client.getBlock(hash)
+	return wm.Client.GetBlock(context.Background(), hash)
 }
 
 //GetTxIDsInMemPool 获取待处理的交易池中的交易单IDs
@@ -1095,7 +1113,7 @@ func (wm *WalletManager) GetTransactionInMemPool(txid string) (*Transaction, err
 
 //GetTransaction 获取交易单
 func (wm *WalletManager) GetTransaction(txid string) (*Transaction, error) {
-	return wm.Client.getTransaction(txid)
+	return wm.Client.GetTransaction(context.Background(), txid)
 }
 
 //GetAssetsAccountBalanceByAddress 查询账户相关地址的交易记录
@@ -1109,7 +1127,7 @@ func (bs *NBlockScanner) GetBalanceByAddress(address ...string) ([]*openwallet.B
 			err     error
 		)
 
-		balance, err = bs.wm.Client.getBalance(addr)
+		balance, err = bs.wm.Client.GetBalance(context.Background(), addr)
 
 		if err != nil {
 			return nil, err
@@ -1126,6 +1144,10 @@ func (bs *NBlockScanner) GetBalanceByAddress(address ...string) ([]*openwallet.B
 }
 
 func (c *Client) getMultiAddrTransactions(memoScan string, offset, limit int, addresses ...string) ([]*Transaction, error) {
+	return c.getMultiAddrTransactionsContext(context.Background(), memoScan, offset, limit, addresses...)
+}
+
+func (c *Client) getMultiAddrTransactionsContext(ctx context.Context, memoScan string, offset, limit int, addresses ...string) ([]*Transaction, error) {
 	var (
 		trxs      = make([]*Transaction, 0)
 		respLimit = "/limit/10000"
@@ -1134,14 +1156,18 @@ func (c *Client) getMultiAddrTransactions(memoScan string, offset, limit int, ad
 	for _, addr := range addresses {
 		path := "transactions/address/" + addr + respLimit
 
-		resp, err := c.Call(path, nil)
+		resp, err := c.CallContext(ctx, path, nil)
 		if err != nil {
 			return nil, err
 		}
 		txArray := resp.Array()[0].Array()
 
 		for _, txDetail := range txArray {
-			trxs = append(trxs, c.NewTransaction(&txDetail))
+			trx, err := c.newTransaction(ctx, &txDetail)
+			if err != nil {
+				return nil, err
+			}
+			trxs = append(trxs, trx)
 		}
 	}
 
@@ -1199,6 +1225,7 @@ func (bs *NBlockScanner) GetTransactionsByAddress(offset, limit int, coin openwa
 //Run 运行
 func (bs *NBlockScanner) Run() error {
 
+	bs.resetContext()
 	bs.BlockScannerBase.Run()
 
 	return nil
@@ -1207,6 +1234,7 @@ func (bs *NBlockScanner) Run() error {
 ////Stop 停止扫描
 func (bs *NBlockScanner) Stop() error {
 
+	bs.cancelContext()
 	bs.BlockScannerBase.Stop()
 
 	return nil
@@ -1215,6 +1243,7 @@ func (bs *NBlockScanner) Stop() error {
 //Pause 暂停扫描
 func (bs *NBlockScanner) Pause() error {
 
+	bs.cancelContext()
 	bs.BlockScannerBase.Pause()
 
 	return nil
@@ -1223,11 +1252,41 @@ func (bs *NBlockScanner) Pause() error {
 //Restart 继续扫描
 func (bs *NBlockScanner) Restart() error {
 
+	bs.resetContext()
 	bs.BlockScannerBase.Restart()
 
 	return nil
 }
 
+//scanContext 当前扫描任务的ctx
+func (bs *NBlockScanner) scanContext() context.Context {
+	bs.ctxMu.Lock()
+	defer bs.ctxMu.Unlock()
+	if bs.ctx == nil {
+		bs.ctx, bs.cancel = context.WithCancel(context.Background())
+	}
+	return bs.ctx
+}
+
+//resetContext 开始扫描时创建新的ctx
+func (bs *NBlockScanner) resetContext() {
+	bs.ctxMu.Lock()
+	defer bs.ctxMu.Unlock()
+	if bs.cancel != nil {
+		bs.cancel()
+	}
+	bs.ctx, bs.cancel = context.WithCancel(context.Background())
+}
+
+//cancelContext 取消正在进行的节点请求
+func (bs *NBlockScanner) cancelContext() {
+	bs.ctxMu.Lock()
+	defer bs.ctxMu.Unlock()
+	if bs.cancel != nil {
+		bs.cancel()
+	}
+}
+
 /******************* 使用insight socket.io 监听区块 *******************/
 
 //setupSocketIO 配置socketIO监听新区块
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
+	"github.com/tidwall/gjson"
+)
+
+// 状态变化的类型
+const (
+	ChangeAccountUpdate     = "account_update"
+	ChangeAccountDeletion   = "account_deletion"
+	ChangeAccessKeyUpdate   = "access_key_update"
+	ChangeAccessKeyDeletion = "access_key_deletion"
+	ChangeDataUpdate        = "data_update"
+	ChangeDataDeletion      = "data_deletion"
+)
+
+// 状态变化的原因，不经过交易的余额变化来自收据、gas退款和验证人奖励
+const (
+	CauseNotWritableToDisk              = "not_writable_to_disk"
+	CauseInitialState                   = "initial_state"
+	CauseTransactionProcessing          = "transaction_processing"
+	CauseActionReceiptProcessingStarted = "action_receipt_processing_started"
+	CauseActionReceiptGasReward         = "action_receipt_gas_reward"
+	CauseReceiptProcessing              = "receipt_processing"
+	CausePostponedReceipt               = "postponed_receipt"
+	CauseUpdatedDelayedReceipts         = "updated_delayed_receipts"
+	CauseValidatorAccountsUpdate        = "validator_accounts_update"
+	CauseMigration                      = "migration"
+	CauseResharding                     = "resharding"
+)
+
+// ChangeCause 状态变化的原因，TxHash 和 ReceiptHash 视类型而定
+type ChangeCause struct {
+	Type        string
+	TxHash      string
+	ReceiptHash string
+}
+
+// StateChange EXPERIMENTAL_changes 返回的一条状态变化，按 Type 填写对应字段
+type StateChange struct {
+	Cause     ChangeCause
+	Type      string
+	AccountID string
+
+	//account_update 变化后的账户
+	Amount       nearTransaction.YoctoAmount
+	Locked       nearTransaction.YoctoAmount
+	StorageUsage uint64
+	CodeHash     string
+
+	//access_key_update、access_key_deletion，删除时 AccessKey 为nil
+	PublicKey *nearKey.PublicKey
+	AccessKey *nearTransaction.AccessKey
+
+	//data_update、data_deletion，删除时 Value 为nil
+	Key   []byte
+	Value []byte
+}
+
+// StateChanges 一个区块中的状态变化，按执行顺序排列
+type StateChanges struct {
+	BlockHash string
+	Changes   []*StateChange
+}
+
+// TouchedAccount EXPERIMENTAL_changes_in_block 返回的有变化的账户
+type TouchedAccount struct {
+	//account_touched、access_key_touched、data_touched 或 contract_code_touched
+	Type      string
+	AccountID string
+}
+
+// GetChangesInBlock 区块中有状态变化的账户
+func (c *Client) GetChangesInBlock(ctx context.Context, blockRef BlockRef) (string, []*TouchedAccount, error) {
+	request := map[string]interface{}{}
+	blockRef.apply(request)
+
+	r, err := c.CallContext(ctx, "EXPERIMENTAL_changes_in_block", request)
+	if err != nil {
+		return "", nil, err
+	}
+
+	touched := make([]*TouchedAccount, 0)
+	for _, item := range r.Get("changes").Array() {
+		touched = append(touched, &TouchedAccount{
+			Type:      item.Get("type").String(),
+			AccountID: item.Get("account_id").String(),
+		})
+	}
+	return r.Get("block_hash").String(), touched, nil
+}
+
+// GetAccountChanges 账户余额等状态的变化
+func (c *Client) GetAccountChanges(ctx context.Context, accountIDs []string, blockRef BlockRef) (*StateChanges, error) {
+	return c.getChanges(ctx, "account_changes", map[string]interface{}{"account_ids": accountIDs}, blockRef)
+}
+
+// GetAccessKeyChanges 账户access key的变化
+func (c *Client) GetAccessKeyChanges(ctx context.Context, accountIDs []string, blockRef BlockRef) (*StateChanges, error) {
+	return c.getChanges(ctx, "all_access_key_changes", map[string]interface{}{"account_ids": accountIDs}, blockRef)
+}
+
+// GetDataChanges 合约状态中以keyPrefix开头的key的变化
+func (c *Client) GetDataChanges(ctx context.Context, accountIDs []string, keyPrefix []byte, blockRef BlockRef) (*StateChanges, error) {
+	request := map[string]interface{}{
+		"account_ids":       accountIDs,
+		"key_prefix_base64": base64.StdEncoding.EncodeToString(keyPrefix),
+	}
+	return c.getChanges(ctx, "data_changes", request, blockRef)
+}
+
+// getChanges 查询 EXPERIMENTAL_changes
+func (c *Client) getChanges(ctx context.Context, changesType string, request map[string]interface{}, blockRef BlockRef) (*StateChanges, error) {
+	request["changes_type"] = changesType
+	blockRef.apply(request)
+
+	r, err := c.CallContext(ctx, "EXPERIMENTAL_changes", request)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &StateChanges{
+		BlockHash: r.Get("block_hash").String(),
+		Changes:   make([]*StateChange, 0),
+	}
+	for _, item := range r.Get("changes").Array() {
+		change, err := newStateChange(item)
+		if err != nil {
+			return nil, err
+		}
+		changes.Changes = append(changes.Changes, change)
+	}
+	return changes, nil
+}
+
+// newStateChange 解析一条状态变化
+func newStateChange(item gjson.Result) (*StateChange, error) {
+	change := item.Get("change")
+	sc := &StateChange{
+		Cause: ChangeCause{
+			Type:        item.Get("cause.type").String(),
+			TxHash:      item.Get("cause.tx_hash").String(),
+			ReceiptHash: item.Get("cause.receipt_hash").String(),
+		},
+		Type:      item.Get("type").String(),
+		AccountID: change.Get("account_id").String(),
+	}
+
+	switch sc.Type {
+	case ChangeAccountUpdate:
+		var err error
+		if sc.Amount, err = nearTransaction.ParseYocto(change.Get("amount").String()); err != nil {
+			return nil, fmt.Errorf("invalid amount of %s: %v", sc.AccountID, err)
+		}
+		if sc.Locked, err = nearTransaction.ParseYocto(change.Get("locked").String()); err != nil {
+			return nil, fmt.Errorf("invalid locked of %s: %v", sc.AccountID, err)
+		}
+		sc.StorageUsage = change.Get("storage_usage").Uint()
+		sc.CodeHash = change.Get("code_hash").String()
+	case ChangeAccessKeyUpdate, ChangeAccessKeyDeletion:
+		publicKey, err := nearKey.ParsePublicKey(change.Get("public_key").String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid access key change of %s: %v", sc.AccountID, err)
+		}
+		sc.PublicKey = publicKey
+		if sc.Type == ChangeAccessKeyUpdate {
+			if sc.AccessKey, err = nearTransaction.ParseAccessKey([]byte(change.Get("access_key").Raw)); err != nil {
+				return nil, fmt.Errorf("invalid access key change of %s: %v", sc.AccountID, err)
+			}
+		}
+	case ChangeDataUpdate, ChangeDataDeletion:
+		key, err := base64.StdEncoding.DecodeString(change.Get("key_base64").String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid data change of %s: %v", sc.AccountID, err)
+		}
+		sc.Key = key
+		if sc.Type == ChangeDataUpdate {
+			if sc.Value, err = base64.StdEncoding.DecodeString(change.Get("value_base64").String()); err != nil {
+				return nil, fmt.Errorf("invalid data change of %s: %v", sc.AccountID, err)
+			}
+		}
+	}
+	return sc, nil
+}
@@ -17,7 +17,6 @@ package near
 
 import (
 	"fmt"
-	"math/big"
 	"path/filepath"
 	"strings"
 	"time"
@@ -32,6 +31,10 @@ const (
 	Symbol    = "NEAR"
 	MasterKey = "Near seed"
 	CurveType = owcrypt.ECC_CURVE_ED25519
+
+	//主网和测试网的 chain_id
+	MainNetChainID = "mainnet"
+	TestNetChainID = "testnet"
 )
 
 type WalletConfig struct {
@@ -60,6 +63,8 @@ type WalletConfig struct {
 	//BlockchainFile string
 	//是否测试网络
 	IsTestNet bool
+	//节点必须返回的 chain_id，不一致时不扫块、不创建和签名交易
+	ChainID string
 	// 核心钱包是否只做监听
 	CoreWalletWatchOnly bool
 	//最大的输入数量
@@ -90,10 +95,14 @@ type WalletConfig struct {
 	CoinDecimal decimal.Decimal
 	//核心钱包密码，配置有值用于自动解锁钱包
 	WalletPassword string
-	// smallest unit
-	TransferFee *big.Int
+	//交易费用配置文件，为空时从节点获取
+	RuntimeFeesConfigFile string
 	// data directory
 	DataDir string
+	//WaitTransaction 等待交易达到的状态，wait_until 等级，NONE 为不等待
+	BroadcastWaitUntil string
+	//WaitTransaction 轮询的最长时间
+	BroadcastTimeout time.Duration
 }
 
 func NewConfig(symbol string, masterKey string) *WalletConfig {
@@ -127,6 +136,7 @@ func NewConfig(symbol string, masterKey string) *WalletConfig {
 	//c.BlockchainFile = "blockchain.db"
 	//是否测试网络
 	c.IsTestNet = false
+	c.ChainID = MainNetChainID
 	// 核心钱包是否只做监听
 	c.CoreWalletWatchOnly = true
 	//最大的输入数量
@@ -151,6 +161,9 @@ func NewConfig(symbol string, masterKey string) *WalletConfig {
 	c.CoinDecimal = decimal.NewFromFloat(100000000)
 	//核心钱包密码，配置有值用于自动解锁钱包
 	c.WalletPassword = ""
+	//WaitTransaction 等待交易打包
+	c.BroadcastWaitUntil = WaitUntilIncluded
+	c.BroadcastTimeout = time.Minute
 
 	//默认配置内容
 	c.DefaultConfig = `
@@ -174,6 +187,24 @@ rpcUser = ""
 rpcPassword = ""
 # Is network test?
 isTestNet = false
+# chain_id the node must report, default = mainnet, or testnet when isTestNet = true
+chainID = ""
+# node api url, several nodes are separated by commas, sample: url1, url2|priority, smaller priority first
+nodeAPI = ""
+# nodes lagging the best known head by more blocks are only used as a last resort, default = 10
+maxHeadLag = 10
+# timeout of a single node request in seconds, 0 = no timeout, default = 30
+rpcTimeout = 30
+# retries of timeouts, 429 and 5xx responses, broadcasts are only retried when never sent, default = 3
+rpcMaxRetries = 3
+# wait_until level of WaitTransaction: NONE, INCLUDED, EXECUTED_OPTIMISTIC, INCLUDED_FINAL, EXECUTED or FINAL
+broadcastWaitUntil = "INCLUDED"
+# max seconds WaitTransaction polls the transaction status, default = 60
+broadcastTimeout = 60
+# runtime fees config file of the fee estimator, empty: fetch from the node
+runtimeFeesConfig = ""
+# cache data file directory, empty: ./data
+dataDir = ""
 # the safe address that wallet send money to.
 sumAddress = ""
 # when wallet's balance is over this value, the wallet willl send money to [sumAddress]
@@ -1,7 +1,9 @@
 package near
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math/big"
 	"strconv"
 
@@ -77,6 +79,46 @@ func NewContractDecoder(wm *WalletManager) *ContractDecoder {
 	return &decoder
 }
 
+//GetTokenBalanceByAddress 通过 NEP-141 合约的 ft_balance_of 查询地址的代币余额
 func (decoder *ContractDecoder) GetTokenBalanceByAddress(contract openwallet.SmartContract, address ...string) ([]*openwallet.TokenBalance, error) {
-	return nil, nil
+	tokenBalanceList := make([]*openwallet.TokenBalance, 0, len(address))
+	for _, addr := range address {
+		balance, err := decoder.ftBalanceOf(contract.Address, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		amount := decimal.NewFromBigInt(balance, -int32(contract.Decimals)).String()
+		tokenBalanceList = append(tokenBalanceList, &openwallet.TokenBalance{
+			Contract: &contract,
+			Balance: &openwallet.Balance{
+				Address:          addr,
+				Symbol:           contract.Symbol,
+				Balance:          amount,
+				ConfirmBalance:   amount,
+				UnconfirmBalance: "0",
+			},
+		})
+	}
+	return tokenBalanceList, nil
+}
+
+// ftBalanceOf 查询最小单位的代币余额
+func (decoder *ContractDecoder) ftBalanceOf(contractID, accountID string) (*big.Int, error) {
+	r, err := decoder.wm.Client.ViewFunction(context.Background(), contractID, "ft_balance_of",
+		map[string]interface{}{"account_id": accountID}, FinalBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	//余额为json字符串，如 "1000"
+	var amount string
+	if err := r.JSON(&amount); err != nil {
+		return nil, err
+	}
+	balance, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid ft_balance_of of %s: %s", accountID, amount)
+	}
+	return balance, nil
 }
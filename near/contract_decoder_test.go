@@ -1,36 +1,55 @@
 package near
 
 import (
+	"encoding/json"
 	"testing"
+
+	"github.com/blocktree/near-adapter/nearTransaction"
+	"github.com/blocktree/near-adapter/neartest"
+	"github.com/blocktree/openwallet/v2/openwallet"
 )
 
 func Test_GetTokenBalanceByAddress(t *testing.T) {
-	// tm := NewWalletManager()
-	// rpc := NewRpcClient("http://192.168.27.124:20336")
-	// tm.RPCClient = rpc
-
-	// contract := openwallet.SmartContract{
-	// 	Symbol:     "ONT",
-	// 	ContractID: ontologyTransaction.ONTContractAddress,
-	// }
-
-	// address1 := "AYmuoVvtCojm1F3ATMf2fNww3wBNvAxbi5"
-	// address2 := "AaCe8nVkMRABnp5YgEjYZ9E5KYCxks2uce"
-
-	// ret, err := tm.ContractDecoder.GetTokenBalanceByAddress(contract, address1, address2)
-
-	// if err != nil {
-	// 	t.Error(err)
-	// } else {
-	// 	fmt.Println(ret)
-	// }
-
-	// contract.ContractID = ontologyTransaction.ONGContractAddress
-	// ret, err = tm.ContractDecoder.GetTokenBalanceByAddress(contract, address1, address2)
-
-	// if err != nil {
-	// 	t.Error(err)
-	// } else {
-	// 	fmt.Println(ret)
-	// }
+	node := neartest.NewServer()
+	defer node.Close()
+	node.AddAccount("usdt.tether-token.near", nearTransaction.YoctoAmount{})
+	balances := map[string]string{"alice.near": "1234567"}
+	node.SetViewFunction("usdt.tether-token.near", "ft_balance_of", func(args []byte) ([]byte, []string, error) {
+		var req struct {
+			AccountID string `json:"account_id"`
+		}
+		if err := json.Unmarshal(args, &req); err != nil {
+			return nil, nil, err
+		}
+		balance, ok := balances[req.AccountID]
+		if !ok {
+			balance = "0"
+		}
+		result, _ := json.Marshal(balance)
+		return result, nil, nil
+	})
+
+	tm := NewWalletManager()
+	tm.Client = newRetryClient(node.URL)
+
+	contract := openwallet.SmartContract{
+		Symbol:   "NEAR",
+		Address:  "usdt.tether-token.near",
+		Token:    "USDT",
+		Decimals: 6,
+	}
+
+	ret, err := tm.ContractDecoder.GetTokenBalanceByAddress(contract, "alice.near", "bob.near")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ret) != 2 || ret[0].Balance.Balance != "1.234567" || ret[0].Balance.Address != "alice.near" ||
+		ret[1].Balance.Balance != "0" {
+		t.Errorf("wrong token balances: %+v %+v", ret[0].Balance, ret[1].Balance)
+	}
+
+	contract.Address = "missing.near"
+	if _, err := tm.ContractDecoder.GetTokenBalanceByAddress(contract, "alice.near"); err == nil {
+		t.Error("missing contract should fail")
+	}
 }
@@ -0,0 +1,249 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//默认允许落后最佳高度的区块数
+	DefaultMaxHeadLag = uint64(10)
+	//默认节点健康信息刷新间隔
+	DefaultHealthCheckInterval = 30 * time.Second
+	//连续失败该次数后暂停使用节点
+	endpointMaxFailures = 3
+	//暂停使用的时长，之后重新尝试
+	endpointCooldown = 30 * time.Second
+	//延迟和错误率的滑动平均系数
+	endpointEWMAAlpha = 0.2
+)
+
+// Endpoint 节点地址，Priority 越小越优先
+type Endpoint struct {
+	URL      string
+	Priority int
+
+	mu          sync.Mutex
+	latency     time.Duration
+	errorRate   float64
+	failures    int
+	lastFailure time.Time
+	head        uint64
+	headUpdated time.Time
+	probing     bool
+}
+
+// EndpointStatus 节点健康状态
+type EndpointStatus struct {
+	URL        string
+	Priority   int
+	Latency    time.Duration
+	ErrorRate  float64
+	HeadHeight uint64
+	//落后最佳高度超过 MaxHeadLag
+	Lagging bool
+	//连续失败，暂停使用中
+	Suspended bool
+}
+
+func NewEndpoint(url string, priority int) *Endpoint {
+	return &Endpoint{URL: url, Priority: priority}
+}
+
+// ParseEndpoints 解析逗号分隔的节点列表，每项为 url 或 url|priority，未指定优先级时按顺序
+func ParseEndpoints(nodeAPI string) ([]*Endpoint, error) {
+	endpoints := make([]*Endpoint, 0)
+	for i, item := range strings.Split(nodeAPI, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		url, priority := item, i
+		if sep := strings.LastIndex(item, "|"); sep >= 0 {
+			p, err := strconv.Atoi(strings.TrimSpace(item[sep+1:]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid priority of node api %s", item)
+			}
+			url, priority = strings.TrimSpace(item[:sep]), p
+		}
+		endpoints = append(endpoints, NewEndpoint(url, priority))
+	}
+
+	if len(endpoints) == 0 {
+		return nil, errors.New("node api is empty")
+	}
+	return endpoints, nil
+}
+
+func (ep *Endpoint) recordSuccess(latency time.Duration) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.latency == 0 {
+		ep.latency = latency
+	} else {
+		ep.latency = time.Duration(float64(ep.latency)*(1-endpointEWMAAlpha) + float64(latency)*endpointEWMAAlpha)
+	}
+	ep.errorRate *= 1 - endpointEWMAAlpha
+	ep.failures = 0
+}
+
+func (ep *Endpoint) recordFailure() {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.errorRate = ep.errorRate*(1-endpointEWMAAlpha) + endpointEWMAAlpha
+	ep.failures++
+	ep.lastFailure = time.Now()
+}
+
+func (ep *Endpoint) recordHead(height uint64) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.head = height
+	ep.headUpdated = time.Now()
+}
+
+func (ep *Endpoint) status(bestHead, maxHeadLag uint64) EndpointStatus {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return EndpointStatus{
+		URL:        ep.URL,
+		Priority:   ep.Priority,
+		Latency:    ep.latency,
+		ErrorRate:  ep.errorRate,
+		HeadHeight: ep.head,
+		Lagging:    ep.head > 0 && bestHead > ep.head+maxHeadLag,
+		Suspended:  ep.failures >= endpointMaxFailures && time.Since(ep.lastFailure) < endpointCooldown,
+	}
+}
+
+// score 越小越好，延迟按错误率加权
+func (s EndpointStatus) score() float64 {
+	return float64(s.Latency) * (1 + 4*s.ErrorRate)
+}
+
+// Endpoints 返回各节点的健康状态
+func (c *Client) Endpoints() []EndpointStatus {
+	bestHead := c.bestHead()
+	status := make([]EndpointStatus, 0, len(c.endpoints))
+	for _, ep := range c.endpoints {
+		status = append(status, ep.status(bestHead, c.MaxHeadLag))
+	}
+	return status
+}
+
+func (c *Client) bestHead() uint64 {
+	best := uint64(0)
+	for _, ep := range c.endpoints {
+		ep.mu.Lock()
+		if ep.head > best {
+			best = ep.head
+		}
+		ep.mu.Unlock()
+	}
+	return best
+}
+
+// orderedEndpoints 返回本次请求尝试节点的顺序：
+// 可用节点按优先级、延迟和错误率排序，落后或暂停的节点排在最后作为兜底
+func (c *Client) orderedEndpoints() []*Endpoint {
+	if len(c.endpoints) > 1 {
+		c.refreshStaleEndpoints()
+	}
+
+	type candidate struct {
+		ep     *Endpoint
+		status EndpointStatus
+	}
+	bestHead := c.bestHead()
+	healthy := make([]candidate, 0, len(c.endpoints))
+	fallback := make([]candidate, 0)
+	for _, ep := range c.endpoints {
+		s := ep.status(bestHead, c.MaxHeadLag)
+		if s.Lagging || s.Suspended {
+			fallback = append(fallback, candidate{ep, s})
+		} else {
+			healthy = append(healthy, candidate{ep, s})
+		}
+	}
+
+	sort.SliceStable(healthy, func(i, j int) bool {
+		if healthy[i].status.Priority != healthy[j].status.Priority {
+			return healthy[i].status.Priority < healthy[j].status.Priority
+		}
+		return healthy[i].status.score() < healthy[j].status.score()
+	})
+	sort.SliceStable(fallback, func(i, j int) bool {
+		return fallback[i].status.HeadHeight > fallback[j].status.HeadHeight
+	})
+
+	ordered := make([]*Endpoint, 0, len(c.endpoints))
+	for _, cand := range append(healthy, fallback...) {
+		ordered = append(ordered, cand.ep)
+	}
+	return ordered
+}
+
+// refreshStaleEndpoints 后台刷新超过 HealthCheckInterval 未更新高度的节点
+func (c *Client) refreshStaleEndpoints() {
+	if c.HealthCheckInterval <= 0 {
+		return
+	}
+	for _, ep := range c.endpoints {
+		ep.mu.Lock()
+		stale := !ep.probing && time.Since(ep.headUpdated) > c.HealthCheckInterval
+		if stale {
+			ep.probing = true
+		}
+		ep.mu.Unlock()
+
+		if stale {
+			go func(ep *Endpoint) {
+				c.probe(ep)
+				ep.mu.Lock()
+				ep.probing = false
+				ep.mu.Unlock()
+			}(ep)
+		}
+	}
+}
+
+// probe 通过 status 接口更新节点的延迟和最新高度
+func (c *Client) probe(ep *Endpoint) error {
+	_, err := c.callEndpoint(context.Background(), ep, "status", map[string]interface{}{})
+	return err
+}
+
+// CheckEndpoints 立即刷新所有节点的健康信息
+func (c *Client) CheckEndpoints() {
+	var wg sync.WaitGroup
+	for _, ep := range c.endpoints {
+		wg.Add(1)
+		go func(ep *Endpoint) {
+			defer wg.Done()
+			c.probe(ep)
+		}(ep)
+	}
+	wg.Wait()
+}
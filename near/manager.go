@@ -16,10 +16,12 @@
 package near
 
 import (
+	"context"
 	"errors"
+	"math/big"
 	"path/filepath"
-	"strings"
 
+	"github.com/blocktree/near-adapter/nearTransaction"
 	"github.com/blocktree/openwallet/v2/hdkeystore"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
@@ -29,7 +31,7 @@ type WalletManager struct {
 	openwallet.AssetsAdapterBase
 
 	Storage         *hdkeystore.HDKeystore        //秘钥存取
-	Client          *Client                       // rpc API
+	Client          ClientInterface               // rpc API，可注入模拟实现
 	Config          *WalletConfig                 //钱包管理配置
 	WalletsInSum    map[string]*openwallet.Wallet //参与汇总的钱包
 	Blockscanner    *NBlockScanner              //区块扫描器
@@ -37,6 +39,8 @@ type WalletManager struct {
 	TxDecoder       openwallet.TransactionDecoder //交易单编码器
 	Log             *log.OWLogger                 //日志工具
 	ContractDecoder *ContractDecoder              //智能合约解析器
+	//runtimeFeesConfig 文件中的交易费用，加载配置时读取一次，为nil时从节点获取
+	RuntimeFeesConfig *nearTransaction.RuntimeFeesConfig
 }
 
 func NewWalletManager() *WalletManager {
@@ -92,22 +96,102 @@ func (wm *WalletManager) GetWallets() ([]*openwallet.Wallet, error) {
 
 }
 
-//SendRawTransaction 广播交易
+//GetRuntimeFeesConfig 获取交易费用配置，优先使用配置文件，否则从节点获取当前epoch的配置
+func (wm *WalletManager) GetRuntimeFeesConfig() (*nearTransaction.RuntimeFeesConfig, error) {
+	if wm.RuntimeFeesConfig != nil {
+		return wm.RuntimeFeesConfig, nil
+	}
+	config, err := wm.Client.GetProtocolConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return config.TransactionCosts, nil
+}
+
+//EstimateFee 估算交易在签名前需要的gas
+func (wm *WalletManager) EstimateFee(ts *nearTransaction.TxStruct) (*nearTransaction.FeeEstimate, error) {
+	cfg, err := wm.GetRuntimeFeesConfig()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.EstimateFee(ts)
+}
+
+//EstimateTransferFee 按当前epoch的gas价格估算from向to转账燃烧的费用，to为隐式账户时包括创建账户的费用
+func (wm *WalletManager) EstimateTransferFee(from, to string) (*big.Int, error) {
+	cfg, err := wm.GetRuntimeFeesConfig()
+	if err != nil {
+		return nil, err
+	}
+	estimate, err := cfg.EstimateActionsFee(from, to, nearTransaction.NewTransferAction(nearTransaction.YoctoAmount{}))
+	if err != nil {
+		return nil, err
+	}
+	gasPrice, err := wm.Client.GetGasPrice(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return estimate.Burnt(gasPrice), nil
+}
+
+//SendRawTransaction 通过 broadcast_tx_async 广播交易，不等待执行，返回本地计算的交易哈希
 func (wm *WalletManager) SendRawTransaction(txHex string) (string, error) {
 
-	return wm.sendRawTransactionByNode(txHex)
+	return wm.sendRawTransactionByNode(context.Background(), txHex)
 }
 
-func (wm *WalletManager) sendRawTransactionByNode(txHex string) (string, error) {
+func (wm *WalletManager) sendRawTransactionByNode(ctx context.Context, txHex string) (string, error) {
 	var (
 		txid string
 		err  error
 	)
 
-	txid, err = wm.Client.sendTransaction(strings.Split(txHex, ":")[0])
+	signed, err := nearTransaction.ParseSignedTransaction(txHex)
+	if err != nil {
+		return "", err
+	}
+
+	txid, err = signed.TxID()
+	if err != nil {
+		return "", err
+	}
+
+	rawTx, err := signed.Base64()
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := wm.Client.BroadcastTransactionAsync(ctx, rawTx)
 
 	if err != nil {
 		return "", err
 	}
+	if hash != txid {
+		wm.Log.Std.Warning("node returned tx hash %s, expected %s", hash, txid)
+	}
 	return txid, nil
 }
+
+//CheckTransaction 查询一次交易的当前状态，不等待，节点未收到交易时为 TxPending
+func (wm *WalletManager) CheckTransaction(txid, senderID string) (*TxOutcome, error) {
+	outcome, err := wm.Client.GetTxStatus(context.Background(), txid, senderID, WaitUntilNone)
+	switch {
+	case err == nil:
+		return outcome, nil
+	case errors.Is(err, ErrUnknownTransaction):
+		return &TxOutcome{TxID: txid, SenderID: senderID, State: TxPending}, nil
+	}
+	return txFailedOutcome(txid, senderID, err)
+}
+
+//WaitTransaction 按 broadcastWaitUntil 配置轮询交易状态，超过 broadcastTimeout 时返回 ctx 错误和最后查到的状态，
+//会阻塞调用方，提现流程应使用 CheckTransaction 定期确认
+func (wm *WalletManager) WaitTransaction(txid, senderID string) (*TxOutcome, error) {
+	ctx := context.Background()
+	if wm.Config.BroadcastTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wm.Config.BroadcastTimeout)
+		defer cancel()
+	}
+	return waitTransaction(ctx, wm.Client, txid, senderID, wm.Config.BroadcastWaitUntil, DefaultTxPollInterval)
+}
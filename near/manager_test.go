@@ -16,33 +16,67 @@
 package near
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
 	"github.com/astaxie/beego/config"
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
+	"github.com/blocktree/near-adapter/neartest"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
 	"github.com/blocktree/openwallet/v2/log"
-	"path/filepath"
+	"github.com/blocktree/openwallet/v2/openwallet"
 )
 
+//默认只运行离线测试，-integration 时运行依赖主网节点和本地钱包数据的测试
+var integration = flag.Bool("integration", false, "run the tests against mainnet and ../openwtester/conf/NEAR.ini")
 
-var (
-	tw *WalletManager
-)
+func skipUnlessIntegration(t *testing.T) {
+	t.Helper()
+	if !*integration {
+		t.Skip("requires -integration")
+	}
+}
 
-func init() {
+// testNewWalletManager 连接本地模拟节点，测试结束时关闭节点
+func testNewWalletManager(t *testing.T) (*WalletManager, *neartest.Server) {
+	t.Helper()
+	node := neartest.NewServer()
+	t.Cleanup(node.Close)
 
-	tw = testNewWalletManager()
+	wm := NewWalletManager()
+	c, _ := config.NewConfigData("ini", []byte("nodeAPI = "+node.URL+"\nchainID = neartest"))
+	if err := wm.LoadAssetsConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	return wm, node
 }
 
-func testNewWalletManager() *WalletManager {
-	wm := NewWalletManager()
+// testIntegrationWalletManager 读取配置文件连接真实节点，只在 -integration 时运行
+func testIntegrationWalletManager(t *testing.T) *WalletManager {
+	t.Helper()
+	skipUnlessIntegration(t)
 
-	//读取配置
+	wm := NewWalletManager()
 	absFile := filepath.Join("../openwtester/conf", "NEAR.ini")
 	log.Debug("absFile:", absFile)
 	c, err := config.NewConfig("ini", absFile)
 	if err != nil {
-		panic(err)
+		t.Fatalf("load config failed: %v", err)
+	}
+	if err := wm.LoadAssetsConfig(c); err != nil {
+		t.Fatal(err)
 	}
-	wm.LoadAssetsConfig(c)
-	//wm.WSClient.debug = true
 	return wm
 }
 
@@ -52,3 +86,488 @@ func testNewWalletManager() *WalletManager {
 //	tw.Config.RpcPassword = ""
 //	tw.Client = NewClient("", true)
 //}
+
+// mockProtocolConfig 模拟的协议配置，转账费用与主网相同
+const mockProtocolConfig = `{"protocol_version":63,"chain_id":"mock","epoch_length":43200,"min_gas_price":"100000000",
+	"runtime_config":{"storage_amount_per_byte":"10000000000000000000","transaction_costs":{
+		"action_receipt_creation_config":{"send_sir":108059500000,"send_not_sir":108059500000,"execution":108059500000},
+		"action_creation_config":{
+			"create_account_cost":{"send_sir":3850000000000,"send_not_sir":3850000000000,"execution":3850000000000},
+			"transfer_cost":{"send_sir":115123062500,"send_not_sir":115123062500,"execution":115123062500},
+			"add_key_cost":{"full_access_cost":{"send_sir":101765125000,"send_not_sir":101765125000,"execution":101765125000}}
+		}
+	}}}`
+
+// unimplementedClient 所有查询都返回 errNotImplemented，嵌入模拟实现后只需实现用到的查询
+type unimplementedClient struct{}
+
+var errNotImplemented = errors.New("not implemented by the mock client")
+
+func (unimplementedClient) GetBlockHeight(ctx context.Context) (uint64, error) {
+	return 0, errNotImplemented
+}
+
+func (unimplementedClient) GetRecentBlockHeader(ctx context.Context) (string, uint64, error) {
+	return "", 0, errNotImplemented
+}
+
+func (unimplementedClient) GetBlockHash(ctx context.Context, height uint64) (string, error) {
+	return "", errNotImplemented
+}
+
+func (unimplementedClient) GetBlock(ctx context.Context, hash string) (*Block, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetBlockByHeight(ctx context.Context, height uint64) (*Block, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetChunkTransactions(ctx context.Context, chunkHash string) ([]string, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetTransaction(ctx context.Context, txid string) (*Transaction, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) BroadcastTransactionAsync(ctx context.Context, rawTx string) (string, error) {
+	return "", errNotImplemented
+}
+
+func (unimplementedClient) GetTxStatus(ctx context.Context, txid, senderID, waitUntil string) (*TxOutcome, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetBalance(ctx context.Context, address string) (*AddrBalance, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetAccessKey(ctx context.Context, accountID string, publicKey *nearKey.PublicKey) (*nearTransaction.AccessKey, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetAccessKeyList(ctx context.Context, accountID string) ([]*AccessKeyInfo, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetNonce(ctx context.Context, address string) (uint64, error) {
+	return 0, errNotImplemented
+}
+
+func (unimplementedClient) GetGasPrice(ctx context.Context) (*big.Int, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetGasPriceByHeight(ctx context.Context, height uint64) (*big.Int, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetGasPriceByHash(ctx context.Context, hash string) (*big.Int, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetProtocolConfig(ctx context.Context) (*nearTransaction.ProtocolConfig, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) ViewFunction(ctx context.Context, contractID, method string, args interface{}, blockRef BlockRef) (*ViewResult, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) ViewState(ctx context.Context, contractID string, prefix []byte, blockRef BlockRef) (*StateResult, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetStatus(ctx context.Context) (*NodeStatus, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetNetworkInfo(ctx context.Context) (*NetworkInfo, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetChangesInBlock(ctx context.Context, blockRef BlockRef) (string, []*TouchedAccount, error) {
+	return "", nil, errNotImplemented
+}
+
+func (unimplementedClient) GetAccountChanges(ctx context.Context, accountIDs []string, blockRef BlockRef) (*StateChanges, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetAccessKeyChanges(ctx context.Context, accountIDs []string, blockRef BlockRef) (*StateChanges, error) {
+	return nil, errNotImplemented
+}
+
+func (unimplementedClient) GetDataChanges(ctx context.Context, accountIDs []string, keyPrefix []byte, blockRef BlockRef) (*StateChanges, error) {
+	return nil, errNotImplemented
+}
+
+var _ ClientInterface = unimplementedClient{}
+
+// mockClient 不依赖节点的 ClientInterface 实现，未设置的区块和交易返回 ErrUnknownBlock 等错误，
+// 合约和状态变化等其余查询返回 errNotImplemented
+type mockClient struct {
+	unimplementedClient
+	height       uint64
+	heightErr    error
+	blocks       map[uint64]*Block
+	transactions map[string]*Transaction
+	balances     map[string]*big.Int
+	accessKeys   map[string]*nearTransaction.AccessKey
+	outcomes     map[string]*TxOutcome
+	broadcasts   []string
+}
+
+func newMockClient(height uint64) *mockClient {
+	return &mockClient{
+		height:       height,
+		blocks:       make(map[uint64]*Block),
+		transactions: make(map[string]*Transaction),
+		balances:     make(map[string]*big.Int),
+		accessKeys:   make(map[string]*nearTransaction.AccessKey),
+		outcomes:     make(map[string]*TxOutcome),
+	}
+}
+
+func (m *mockClient) GetBlockHeight(ctx context.Context) (uint64, error) {
+	return m.height, m.heightErr
+}
+
+func (m *mockClient) GetRecentBlockHeader(ctx context.Context) (string, uint64, error) {
+	block, err := m.GetBlockByHeight(ctx, m.height)
+	if err != nil {
+		return "", 0, err
+	}
+	return block.Hash, block.Height, nil
+}
+
+func (m *mockClient) GetBlockHash(ctx context.Context, height uint64) (string, error) {
+	block, err := m.GetBlockByHeight(ctx, height)
+	if err != nil {
+		return "", err
+	}
+	return block.Hash, nil
+}
+
+func (m *mockClient) GetBlock(ctx context.Context, hash string) (*Block, error) {
+	for _, block := range m.blocks {
+		if block.Hash == hash {
+			return block, nil
+		}
+	}
+	return nil, ErrUnknownBlock
+}
+
+func (m *mockClient) GetBlockByHeight(ctx context.Context, height uint64) (*Block, error) {
+	if block, ok := m.blocks[height]; ok {
+		return block, nil
+	}
+	return nil, ErrUnknownBlock
+}
+
+func (m *mockClient) GetChunkTransactions(ctx context.Context, chunkHash string) ([]string, error) {
+	return nil, ErrUnknownChunk
+}
+
+func (m *mockClient) GetTransaction(ctx context.Context, txid string) (*Transaction, error) {
+	if trx, ok := m.transactions[txid]; ok {
+		return trx, nil
+	}
+	return nil, ErrUnknownTransaction
+}
+
+func (m *mockClient) GetTxStatus(ctx context.Context, txid, senderID, waitUntil string) (*TxOutcome, error) {
+	if outcome, ok := m.outcomes[txid]; ok {
+		return outcome, nil
+	}
+	return nil, ErrUnknownTransaction
+}
+
+func (m *mockClient) GetBalance(ctx context.Context, address string) (*AddrBalance, error) {
+	if balance, ok := m.balances[address]; ok {
+		return &AddrBalance{Address: address, Balance: balance, Actived: true}, nil
+	}
+	return &AddrBalance{Address: address, Balance: big.NewInt(0)}, nil
+}
+
+func (m *mockClient) GetAccessKey(ctx context.Context, accountID string, publicKey *nearKey.PublicKey) (*nearTransaction.AccessKey, error) {
+	return m.accessKeys[accountID+"/"+publicKey.String()], nil
+}
+
+func (m *mockClient) GetAccessKeyList(ctx context.Context, accountID string) ([]*AccessKeyInfo, error) {
+	keys := make([]*AccessKeyInfo, 0)
+	for id, accessKey := range m.accessKeys {
+		if !strings.HasPrefix(id, accountID+"/") {
+			continue
+		}
+		publicKey, err := nearKey.ParsePublicKey(strings.TrimPrefix(id, accountID+"/"))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &AccessKeyInfo{PublicKey: publicKey, AccessKey: accessKey})
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+func (m *mockClient) GetStatus(ctx context.Context) (*NodeStatus, error) {
+	return &NodeStatus{ChainID: MainNetChainID, LatestBlockHeight: m.height}, nil
+}
+
+func (m *mockClient) GetNonce(ctx context.Context, address string) (uint64, error) {
+	publicKey, err := nearKey.NewPublicKey(address)
+	if err != nil {
+		return 0, err
+	}
+	accessKey, _ := m.GetAccessKey(ctx, address, publicKey)
+	if accessKey == nil {
+		return 0, ErrUnknownAccessKey
+	}
+	return accessKey.Nonce, nil
+}
+
+func (m *mockClient) GetGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(100000000), nil
+}
+
+func (m *mockClient) GetGasPriceByHeight(ctx context.Context, height uint64) (*big.Int, error) {
+	return m.GetGasPrice(ctx)
+}
+
+func (m *mockClient) GetGasPriceByHash(ctx context.Context, hash string) (*big.Int, error) {
+	return m.GetGasPrice(ctx)
+}
+
+func (m *mockClient) GetProtocolConfig(ctx context.Context) (*nearTransaction.ProtocolConfig, error) {
+	return nearTransaction.ParseProtocolConfig([]byte(mockProtocolConfig))
+}
+
+func (m *mockClient) BroadcastTransactionAsync(ctx context.Context, rawTx string) (string, error) {
+	m.broadcasts = append(m.broadcasts, rawTx)
+	return "", nil
+}
+
+func TestMockClient_SubmitRawTransaction(t *testing.T) {
+	wm := NewWalletManager()
+	client := newMockClient(100)
+	wm.Client = client
+
+	signerPublicKey := "bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e"
+	privateKey, _ := hex.DecodeString("e0c0c1a43f521f32c05a647a3595304c4992c9344f03eb66b61c796052001775")
+	ts, _ := nearTransaction.NewTxStruct(signerPublicKey, signerPublicKey, 7, "bob.near", "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu",
+		nearTransaction.NewTransferAction(nearTransaction.YoctoFromUint64(1)))
+	unsigned, _ := ts.NewUnsignedTransaction(200)
+	emptyTrans, _ := unsigned.Hex()
+	sig, _ := nearTransaction.SignTransaction(unsigned.Hash, privateKey)
+	signedTrans, _ := nearTransaction.VerifyAndCombineTransaction(emptyTrans, unsigned.Hash, signerPublicKey, hex.EncodeToString(sig))
+	txid, _ := unsigned.TxID()
+
+	submit := func() (*openwallet.Transaction, error) {
+		rawTx := &openwallet.RawTransaction{RawHex: signedTrans, IsCompleted: true, Account: &openwallet.AssetsAccount{}}
+		return wm.TxDecoder.SubmitRawTransaction(&openwallet.WalletDAIBase{}, rawTx)
+	}
+
+	//广播后立即返回，不查询交易状态
+	tx, err := submit()
+	if err != nil || tx.TxID != txid || len(client.broadcasts) != 1 {
+		t.Fatalf("submit failed: %+v %v", tx, err)
+	}
+	if outcome, err := wm.CheckTransaction(txid, signerPublicKey); err != nil || outcome.State != TxPending {
+		t.Errorf("unknown transaction should be pending: %+v %v", outcome, err)
+	}
+
+	//执行结果由 CheckTransaction 单独确认
+	client.outcomes[txid] = &TxOutcome{TxID: txid, State: TxFailed, FailureKind: "NotEnoughBalance"}
+	if _, err := submit(); err != nil {
+		t.Error(err)
+	}
+	if outcome, err := wm.CheckTransaction(txid, signerPublicKey); err != nil || outcome.Err() == nil {
+		t.Errorf("failed transaction should be reported: %+v %v", outcome, err)
+	}
+
+	//无法确认过期高度时不广播
+	client.heightErr = ErrUnknownBlock
+	if _, err := submit(); err == nil || len(client.broadcasts) != 2 {
+		t.Error("transaction should not be broadcast without the current height")
+	}
+	client.heightErr = nil
+
+	client.height = 201
+	if _, err := submit(); err == nil || len(client.broadcasts) != 2 {
+		t.Error("expired transaction should not be broadcast")
+	}
+}
+
+func TestWalletManager_RuntimeFeesConfigFile(t *testing.T) {
+	node := neartest.NewServer()
+	defer node.Close()
+	dir, err := ioutil.TempDir("", "near")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "runtime_fees.json")
+	if err := ioutil.WriteFile(file, []byte(mockProtocolConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	//配置文件只在加载配置时读取一次
+	wm := NewWalletManager()
+	c, _ := config.NewConfigData("ini", []byte("nodeAPI = "+node.URL+"\nchainID = neartest\nruntimeFeesConfig = "+file))
+	if err := wm.LoadAssetsConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(file)
+	for i := 0; i < 2; i++ {
+		cfg, err := wm.GetRuntimeFeesConfig()
+		if err != nil || cfg != wm.RuntimeFeesConfig || cfg.ActionReceiptCreationConfig.Execution != 108059500000 {
+			t.Fatalf("runtime fees config: %+v, %v", cfg, err)
+		}
+	}
+	if node.Calls("EXPERIMENTAL_protocol_config") != 0 {
+		t.Error("runtime fees should not be read from the node")
+	}
+
+	c, _ = config.NewConfigData("ini", []byte("nodeAPI = "+node.URL+"\nruntimeFeesConfig = "+file))
+	if err := wm.LoadAssetsConfig(c); err == nil {
+		t.Error("missing runtime fees config file should fail")
+	}
+}
+
+func TestWalletManager_DefaultConfig(t *testing.T) {
+	node := neartest.NewServer()
+	defer node.Close()
+	dir, err := ioutil.TempDir("", "near")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//默认配置模板只需填写节点
+	wm := NewWalletManager()
+	c, err := wm.InitAssetsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("nodeAPI", node.URL)
+	c.Set("chainID", "neartest")
+	c.Set("dataDir", dir)
+	if err := wm.LoadAssetsConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	client := wm.Client.(*Client)
+	if client.MaxHeadLag != 10 || client.Timeout != 30*time.Second || client.MaxRetries != 3 {
+		t.Errorf("wrong client config: %d, %v, %d", client.MaxHeadLag, client.Timeout, client.MaxRetries)
+	}
+	if wm.Config.BroadcastWaitUntil != WaitUntilIncluded || wm.Config.BroadcastTimeout != time.Minute || wm.RuntimeFeesConfig != nil {
+		t.Errorf("wrong broadcast config: %v, %v", wm.Config.BroadcastWaitUntil, wm.Config.BroadcastTimeout)
+	}
+}
+
+func TestMockClient_EstimateTransferFee(t *testing.T) {
+	wm := NewWalletManager()
+	wm.Client = newMockClient(100)
+
+	gasPrice := big.NewInt(100000000)
+	named := new(big.Int).Mul(big.NewInt(108059500000*2+115123062500*2), gasPrice)
+	implicit := new(big.Int).Add(named, new(big.Int).Mul(big.NewInt(3850000000000*2+101765125000*2), gasPrice))
+
+	fee, err := wm.EstimateTransferFee("alice.near", "bob.near")
+	if err != nil || fee.Cmp(named) != 0 {
+		t.Errorf("transfer fee = %v, %v", fee, err)
+	}
+	//转到隐式账户需要支付创建账户和添加key的费用
+	fee, err = wm.EstimateTransferFee("alice.near", "bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e")
+	if err != nil || fee.Cmp(implicit) != 0 {
+		t.Errorf("implicit transfer fee = %v, %v", fee, err)
+	}
+	feeRate, unit, err := wm.TxDecoder.GetRawTransactionFeeRate()
+	if err != nil || feeRate != convertToAmount(implicit) || unit != "TX" {
+		t.Errorf("fee rate = %s %s, %v", feeRate, unit, err)
+	}
+}
+
+// auditWrapper 只实现 HDKey 和 GetAddressList 的钱包数据接口
+type auditWrapper struct {
+	openwallet.WalletDAIBase
+	key       *hdkeystore.HDKey
+	addresses []*openwallet.Address
+}
+
+func (w *auditWrapper) HDKey(password ...string) (*hdkeystore.HDKey, error) {
+	return w.key, nil
+}
+
+func (w *auditWrapper) GetAddressList(offset, limit int, cols ...interface{}) ([]*openwallet.Address, error) {
+	return w.addresses, nil
+}
+
+func TestWalletManager_AuditAccessKeys(t *testing.T) {
+	node := neartest.NewServer()
+	defer node.Close()
+
+	wm := NewWalletManager()
+	wm.Client = newRetryClient(node.URL)
+
+	key, _ := hdkeystore.NewHDKey(bytes.Repeat([]byte{1}, 32), "audit", "m/44'/88'")
+	wrapper := &auditWrapper{key: key}
+	publicKey := func(path string) *nearKey.PublicKey {
+		child, err := key.DerivedKeyWithPath(path, wm.Config.CurveType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, _ := nearKey.NewPublicKey(hex.EncodeToString(child.GetPublicKeyBytes()))
+		address := hex.EncodeToString(pub.Key)
+		wrapper.addresses = append(wrapper.addresses, &openwallet.Address{AccountID: "account", Address: address, PublicKey: address, HDPath: path})
+		return pub
+	}
+	//第三个地址未激活，不在审计结果中
+	owned, rotated := publicKey("m/44'/88'/0'/0/0"), publicKey("m/44'/88'/0'/0/1")
+	publicKey("m/44'/88'/0'/0/2")
+	foreign, _ := nearKey.NewPublicKey(hex.EncodeToString(bytes.Repeat([]byte{9}, 32)))
+	limited, _ := nearTransaction.NewFunctionCallAccessKey(5, nil, "token.near", "ft_transfer")
+
+	//第一个地址多了一个外部的key，第二个地址的key已被删除，第三个地址未激活
+	node.AddAccount(hex.EncodeToString(owned.Key), nearTransaction.YoctoFromUint64(1), owned)
+	node.AddAccessKey(hex.EncodeToString(owned.Key), foreign, limited)
+	node.AddAccount(hex.EncodeToString(rotated.Key), nearTransaction.YoctoFromUint64(1), foreign)
+
+	audits, err := wm.AuditAccessKeys(wrapper, "account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) != 4 {
+		t.Fatalf("audits = %d", len(audits))
+	}
+	found := make(map[string]*AccessKeyAudit)
+	for _, audit := range audits {
+		found[audit.AccountID+"/"+audit.PublicKey.String()] = audit
+	}
+
+	a := found[hex.EncodeToString(owned.Key)+"/"+owned.String()]
+	if a == nil || a.Unknown || a.Missing || !a.AccessKey.IsFullAccess() {
+		t.Errorf("wrong owned key: %+v", a)
+	}
+	a = found[hex.EncodeToString(owned.Key)+"/"+foreign.String()]
+	if a == nil || !a.Unknown || a.AccessKey.Nonce != 5 || a.AccessKey.ReceiverID() != "token.near" ||
+		a.AccessKey.Allowance() != nil || len(a.AccessKey.MethodNames()) != 1 {
+		t.Errorf("wrong foreign key: %+v", a)
+	}
+	a = found[hex.EncodeToString(rotated.Key)+"/"+foreign.String()]
+	if a == nil || !a.Unknown {
+		t.Errorf("wrong replaced key: %+v", a)
+	}
+	a = found[hex.EncodeToString(rotated.Key)+"/"+rotated.String()]
+	if a == nil || !a.Missing || a.AccessKey != nil {
+		t.Errorf("deleted key not flagged: %+v", a)
+	}
+
+	//地址记录中的公钥不是钱包秘钥派生的
+	wrapper.addresses[2].HDPath = "m/44'/88'/1'/0/2"
+	if _, err := wm.AuditAccessKeys(wrapper, "account"); err == nil {
+		t.Error("address record not derived from the keystore should fail")
+	}
+}
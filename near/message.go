@@ -0,0 +1,53 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
+)
+
+// VerifySignedMessage 验证NEP-413签名消息，checkOnChain为true时同时确认公钥是该账户的full access key
+func (wm *WalletManager) VerifySignedMessage(payload *nearTransaction.MessagePayload, signed *nearTransaction.SignedMessage, checkOnChain bool) error {
+	if err := nearTransaction.VerifyMessage(payload, signed); err != nil {
+		return err
+	}
+
+	if !checkOnChain {
+		return nil
+	}
+
+	publicKey, err := nearKey.ParsePublicKey(signed.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	accessKey, err := wm.Client.GetAccessKey(context.Background(), signed.AccountID, publicKey)
+	if err != nil {
+		return err
+	}
+	if accessKey == nil {
+		return fmt.Errorf("%s is not an access key of %s", signed.PublicKey, signed.AccountID)
+	}
+	if accessKey.Permission.PermissionType != nearTransaction.PermissionFullAccess {
+		return fmt.Errorf("%s is not a full access key of %s", signed.PublicKey, signed.AccountID)
+	}
+
+	return nil
+}
@@ -16,12 +16,13 @@
 package near
 
 import (
+	"context"
 	"fmt"
+	"github.com/blocktree/near-adapter/nearTransaction"
 	"github.com/blocktree/openwallet/v2/crypto"
 	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/tidwall/gjson"
-	"math/big"
 )
 
 // type Vin struct {
@@ -53,17 +54,21 @@ type Block struct {
 type Transaction struct {
 	TxType         string
 	TxID           string
-	Fee            *big.Int
+	Fee            nearTransaction.YoctoAmount
 	From           string
 	To             string
 	TimeStamp      uint64
-	Amount         *big.Int
+	Amount         nearTransaction.YoctoAmount
 	BlockHeight    uint64
 	BlockHash      string
 	Status         string
 }
 
-func (c *Client) NewTransaction(json *gjson.Result) *Transaction {
+func (c *Client) NewTransaction(json *gjson.Result) (*Transaction, error) {
+	return c.newTransaction(context.Background(), json)
+}
+
+func (c *Client) newTransaction(ctx context.Context, json *gjson.Result) (*Transaction, error) {
 
 	obj := &Transaction{}
 	actions := gjson.Get(json.Raw, "transaction").Get("actions").Array()
@@ -79,53 +84,63 @@ func (c *Client) NewTransaction(json *gjson.Result) *Transaction {
 	}
 
 	if obj.TxType == "" {
-		return obj
+		return obj, nil
 	}
 
 	obj.TxID = gjson.Get(json.Raw, "transaction").Get("hash").String()
-	fee := new(big.Int)
-	if gjson.Get(json.Raw, "transaction_outcome").Get("outcome").Get("tokens_burnt").String() != "" {
-		outcomeFee, _ := new(big.Int).SetString(gjson.Get(json.Raw, "transaction_outcome").Get("outcome").Get("tokens_burnt").String(), 10)
-		fee.Add(fee, outcomeFee)
-	}
-
-	receipts_outcome := gjson.Get(json.Raw, "receipts_outcome").Array()
-
-	for _, receipt := range receipts_outcome {
-		if receipt.Get("outcome").Get("tokens_burnt").String() != "" {
-			outcomeFee, _ := new(big.Int).SetString(receipt.Get("outcome").Get("tokens_burnt").String(), 10)
-			fee.Add(fee, outcomeFee)
+	outcomes := []gjson.Result{gjson.Get(json.Raw, "transaction_outcome")}
+	outcomes = append(outcomes, gjson.Get(json.Raw, "receipts_outcome").Array()...)
+
+	for _, outcome := range outcomes {
+		if outcome.Get("outcome").Get("tokens_burnt").String() != "" {
+			err := addAmount(&obj.Fee, outcome.Get("outcome").Get("tokens_burnt").String())
+			if err != nil {
+				return nil, fmt.Errorf("tx %s: invalid tokens_burnt: %v", obj.TxID, err)
+			}
 		}
 	}
-	obj.Fee = fee
 
 	obj.From = gjson.Get(json.Raw, "transaction").Get("signer_id").String()
 	obj.BlockHash = gjson.Get(json.Raw, "transaction_outcome").Get("block_hash").String()
-	block, err := c.getBlock(obj.BlockHash)
+	block, err := c.GetBlock(ctx, obj.BlockHash)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	obj.BlockHeight = block.Height
 	obj.TimeStamp = block.Timestamp
-	amount := new(big.Int)
 	for _, action := range actions {
 		if action.Get("Transfer").String() != "" {
 			if action.Get("Transfer").Get("deposit").String() != "" {
-				deposit, _ := new(big.Int).SetString(action.Get("Transfer").Get("deposit").String(), 10)
-				amount.Add(amount, deposit)
+				err := addAmount(&obj.Amount, action.Get("Transfer").Get("deposit").String())
+				if err != nil {
+					return nil, fmt.Errorf("tx %s: invalid deposit: %v", obj.TxID, err)
+				}
 			}
 		}
 	}
 
-	obj.Amount = amount
 	obj.To = gjson.Get(json.Raw, "transaction").Get("receiver_id").String()
 	obj.Status = gjson.Get(json.Raw, "status").Get("SuccessValue").String()
 
-	return obj
+	return obj, nil
+}
+
+// addAmount 累加 yoctoNEAR 字符串，格式错误或溢出时返回错误
+func addAmount(sum *nearTransaction.YoctoAmount, yocto string) error {
+	amount, err := nearTransaction.ParseYocto(yocto)
+	if err != nil {
+		return err
+	}
+	*sum, err = sum.Add(amount)
+	return err
 }
 
 
 func (c *Client)NewBlock(json *gjson.Result) *Block {
+	return c.newBlock(context.Background(), json)
+}
+
+func (c *Client) newBlock(ctx context.Context, json *gjson.Result) *Block {
 	obj := &Block{}
 	// 解  析
 	obj.Hash = gjson.Get(json.Raw, "header").Get("hash").String()
@@ -136,7 +151,7 @@ func (c *Client)NewBlock(json *gjson.Result) *Block {
 
 	chunks := gjson.Get(json.Raw, "chunks").Array()
 	for _, chunk := range chunks {
-		trxs, _ := c.getTransactionsInChunks(chunk.Get("chunk_hash").String())
+		trxs, _ := c.GetChunkTransactions(ctx, chunk.Get("chunk_hash").String())
 		obj.Transactions = append(obj.Transactions, trxs...)
 	}
 
@@ -15,12 +15,14 @@
 package near
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"math/big"
 	"path/filepath"
+	"time"
 
 	"github.com/astaxie/beego/config"
+	"github.com/blocktree/near-adapter/nearTransaction"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
 )
@@ -70,7 +72,29 @@ func (wm *WalletManager) RestartNodeFlow() error {
 
 //ShowNodeInfo 显示节点信息
 func (wm *WalletManager) ShowNodeInfo() error {
-	return errors.New("Install node is unsupport now. ")
+	ctx := context.Background()
+	status, err := wm.Client.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	network, err := wm.Client.GetNetworkInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("-----------------------------------------------------------\n")
+	fmt.Printf("Chain ID: %s (expected %s)\n", status.ChainID, wm.Config.ChainID)
+	fmt.Printf("Node Version: %s (%s)\n", status.Version, status.Build)
+	fmt.Printf("Protocol Version: %d (latest %d)\n", status.ProtocolVersion, status.LatestProtocolVersion)
+	fmt.Printf("Syncing: %v\n", status.Syncing)
+	fmt.Printf("Latest Block: %d %s %s\n", status.LatestBlockHeight, status.LatestBlockHash, status.LatestBlockTime.Format(time.RFC3339))
+	fmt.Printf("Active Peers: %d/%d\n", network.NumActivePeers, network.PeerMaxCount)
+	for _, peer := range network.ActivePeers {
+		fmt.Printf("  %s %s %s\n", peer.ID, peer.Addr, peer.AccountID)
+	}
+	fmt.Printf("-----------------------------------------------------------\n")
+
+	return wm.CheckNode()
 }
 
 //SetConfigFlow 初始化配置流程
@@ -126,15 +150,52 @@ func (wm *WalletManager) GetBlockScanner() openwallet.BlockScanner {
 func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 
 	wm.Config.NodeAPI = c.String("nodeAPI")
-	wm.Client = NewClient(wm.Config.NodeAPI, false)
-
-	sendFound, _ := new(big.Int).SetString(c.String("sendFoundsTokenBurnt"), 10)
-	addFullAccessKey, _ := new(big.Int).SetString(c.String("addFullAccessKeyTokenBurnt"), 10)
-
-	wm.Config.TransferFee = new(big.Int).Add(sendFound, addFullAccessKey)
+	wm.Config.IsTestNet, _ = c.Bool("isTestNet")
+	wm.Config.ChainID = c.String("chainID")
+	if wm.Config.ChainID == "" {
+		if wm.Config.IsTestNet {
+			wm.Config.ChainID = TestNetChainID
+		} else {
+			wm.Config.ChainID = MainNetChainID
+		}
+	}
+	endpoints, err := ParseEndpoints(wm.Config.NodeAPI)
+	if err != nil {
+		return err
+	}
+	client := NewClientWithEndpoints(endpoints, false)
+	if maxHeadLag, err := c.Int64("maxHeadLag"); err == nil && maxHeadLag > 0 {
+		client.MaxHeadLag = uint64(maxHeadLag)
+	}
+	if rpcTimeout, err := c.Int64("rpcTimeout"); err == nil && rpcTimeout >= 0 {
+		client.Timeout = time.Duration(rpcTimeout) * time.Second
+	}
+	if rpcMaxRetries, err := c.Int("rpcMaxRetries"); err == nil && rpcMaxRetries >= 0 {
+		client.MaxRetries = rpcMaxRetries
+	}
+	wm.Client = client
+
+	wm.Config.RuntimeFeesConfigFile = c.String("runtimeFeesConfig")
+	wm.RuntimeFeesConfig = nil
+	if wm.Config.RuntimeFeesConfigFile != "" {
+		wm.RuntimeFeesConfig, err = nearTransaction.LoadRuntimeFeesConfig(wm.Config.RuntimeFeesConfigFile)
+		if err != nil {
+			return fmt.Errorf("load runtime fees config %s failed: %v", wm.Config.RuntimeFeesConfigFile, err)
+		}
+	}
 
 	wm.Config.DataDir = c.String("dataDir")
 
+	if waitUntil := c.String("broadcastWaitUntil"); waitUntil != "" {
+		wm.Config.BroadcastWaitUntil, err = ParseWaitUntil(waitUntil)
+		if err != nil {
+			return err
+		}
+	}
+	if broadcastTimeout, err := c.Int64("broadcastTimeout"); err == nil && broadcastTimeout > 0 {
+		wm.Config.BroadcastTimeout = time.Duration(broadcastTimeout) * time.Second
+	}
+
 	//数据文件夹
 	wm.Config.makeDataDir()
 
@@ -16,29 +16,127 @@
 package near
 
 import (
+	"context"
 	"encoding/base64"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/imroc/req"
 	"github.com/tidwall/gjson"
 	"math/big"
-	"strings"
+	"time"
 )
 
+// BlockReader 区块和交易查询
+type BlockReader interface {
+	//最新确认区块的高度
+	GetBlockHeight(ctx context.Context) (uint64, error)
+	//最新确认区块的哈希和高度
+	GetRecentBlockHeader(ctx context.Context) (string, uint64, error)
+	GetBlockHash(ctx context.Context, height uint64) (string, error)
+	GetBlock(ctx context.Context, hash string) (*Block, error)
+	GetBlockByHeight(ctx context.Context, height uint64) (*Block, error)
+	//chunk 中的转账和添加key交易
+	GetChunkTransactions(ctx context.Context, chunkHash string) ([]string, error)
+	GetTransaction(ctx context.Context, txid string) (*Transaction, error)
+}
+
+// TxBroadcaster 广播交易和查询交易状态
+type TxBroadcaster interface {
+	//broadcast_tx_async，返回交易哈希
+	BroadcastTransactionAsync(ctx context.Context, rawTx string) (string, error)
+	GetTxStatus(ctx context.Context, txid, senderID, waitUntil string) (*TxOutcome, error)
+}
+
+// AccountReader 账户余额和 access key 查询
+type AccountReader interface {
+	//view_account，账户不存在时余额为0
+	GetBalance(ctx context.Context, address string) (*AddrBalance, error)
+	//view_access_key，不存在时返回nil
+	GetAccessKey(ctx context.Context, accountID string, publicKey *nearKey.PublicKey) (*nearTransaction.AccessKey, error)
+	//view_access_key_list，账户不存在时返回nil
+	GetAccessKeyList(ctx context.Context, accountID string) ([]*AccessKeyInfo, error)
+	GetNonce(ctx context.Context, address string) (uint64, error)
+}
+
+// FeeReader gas价格和协议配置查询
+type FeeReader interface {
+	//当前epoch的gas价格
+	GetGasPrice(ctx context.Context) (*big.Int, error)
+	GetGasPriceByHeight(ctx context.Context, height uint64) (*big.Int, error)
+	GetGasPriceByHash(ctx context.Context, hash string) (*big.Int, error)
+	//当前epoch的协议配置
+	GetProtocolConfig(ctx context.Context) (*nearTransaction.ProtocolConfig, error)
+}
+
+// ContractReader 合约的view方法和状态查询
+type ContractReader interface {
+	//call_function 调用合约的view方法
+	ViewFunction(ctx context.Context, contractID, method string, args interface{}, blockRef BlockRef) (*ViewResult, error)
+	//view_state 查询合约状态
+	ViewState(ctx context.Context, contractID string, prefix []byte, blockRef BlockRef) (*StateResult, error)
+}
+
+// NodeInfoReader 节点状态查询
+type NodeInfoReader interface {
+	//status 节点的网络、版本和同步状态
+	GetStatus(ctx context.Context) (*NodeStatus, error)
+	//network_info 节点的连接信息
+	GetNetworkInfo(ctx context.Context) (*NetworkInfo, error)
+}
+
+// StateChangesReader 区块中的状态变化查询
+type StateChangesReader interface {
+	//EXPERIMENTAL_changes_in_block 区块中有状态变化的账户
+	GetChangesInBlock(ctx context.Context, blockRef BlockRef) (string, []*TouchedAccount, error)
+	//EXPERIMENTAL_changes 账户、access key 和合约状态的变化
+	GetAccountChanges(ctx context.Context, accountIDs []string, blockRef BlockRef) (*StateChanges, error)
+	GetAccessKeyChanges(ctx context.Context, accountIDs []string, blockRef BlockRef) (*StateChanges, error)
+	GetDataChanges(ctx context.Context, accountIDs []string, keyPrefix []byte, blockRef BlockRef) (*StateChanges, error)
+}
+
+// ClientInterface 适配器用到的所有节点查询，WalletManager、TransactionDecoder 和 NBlockScanner 只依赖该接口，
+// 单元测试可替换为模拟实现
 type ClientInterface interface {
-	Call(path string, request []interface{}) (*gjson.Result, error)
+	BlockReader
+	TxBroadcaster
+	AccountReader
+	FeeReader
+	ContractReader
+	NodeInfoReader
+	StateChangesReader
 }
 
+var _ ClientInterface = (*Client)(nil)
+
 // A Client is a Elastos RPC client. It performs RPCs over HTTP using JSON
 // request and responses. A Client must be configured with a secret token
 // to authenticate with other Cores on the network.
+// With several endpoints, each request goes to the best available node and fails over to the others.
 type Client struct {
 	BaseURL     string
 	AccessToken string
 	Debug       bool
-	client      *req.Req
+	//落后最佳高度超过该区块数的节点不再优先使用
+	MaxHeadLag uint64
+	//节点健康信息刷新间隔，0为不刷新
+	HealthCheckInterval time.Duration
+	//单次请求的超时时间，0为不限制
+	Timeout time.Duration
+	//可重试错误的最大重试次数，广播交易只在确定未发出时重试
+	MaxRetries int
+	//重试退避的初始间隔和最大间隔
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	//gas价格和协议配置缓存检查epoch切换的间隔
+	EpochCheckInterval time.Duration
+	//ViewStatePages 单次读取最多发出的请求数，0为不限制
+	MaxStateRequests int
+	endpoints        []*Endpoint
+	epoch            epochCache
+	client           *req.Req
 	//Client *req.Req
 }
 
@@ -51,13 +149,31 @@ type Response struct {
 }
 
 func NewClient(url string /*token string,*/, debug bool) *Client {
+	return NewClientWithEndpoints([]*Endpoint{NewEndpoint(url, 0)}, debug)
+}
+
+//NewClientWithEndpoints 多节点客户端，BaseURL为第一个节点
+func NewClientWithEndpoints(endpoints []*Endpoint, debug bool) *Client {
 	c := Client{
-		BaseURL: url,
 		//	AccessToken: token,
-		Debug: debug,
+		Debug:               debug,
+		MaxHeadLag:          DefaultMaxHeadLag,
+		HealthCheckInterval: DefaultHealthCheckInterval,
+		Timeout:             DefaultTimeout,
+		MaxRetries:          DefaultMaxRetries,
+		RetryBaseDelay:      DefaultRetryBaseDelay,
+		RetryMaxDelay:       DefaultRetryMaxDelay,
+		EpochCheckInterval:  DefaultEpochCheckInterval,
+		MaxStateRequests:    DefaultMaxStateRequests,
+		endpoints:           endpoints,
+	}
+	if len(endpoints) > 0 {
+		c.BaseURL = endpoints[0].URL
 	}
 
 	api := req.New()
+	//超时由每次请求的ctx控制
+	api.SetTimeout(0)
 	//trans, _ := api.Client().Transport.(*http.Transport)
 	//trans.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	c.client = api
@@ -67,63 +183,70 @@ func NewClient(url string /*token string,*/, debug bool) *Client {
 
 // Call calls a remote procedure on another node, specified by the path.
 func (c *Client) Call(path string, request map[string]interface{}) (*gjson.Result, error) {
+	return c.CallContext(context.Background(), path, request)
+}
 
-	var (
-		body = make(map[string]interface{}, 0)
-	)
-
-	if c.client == nil {
-		return nil, errors.New("API url is not setup. ")
-	}
-
-	authHeader := req.Header{
-		"Accept":        "application/json",
-		"Authorization": "Basic " + c.AccessToken,
-	}
-
-	//json-rpc
-	body["jsonrpc"] = "2.0"
-	body["id"] = "curltext"
-	body["method"] = path
-	body["params"] = request
+func (c *Client) Call2(path string, request []string) (*gjson.Result, error) {
+	return c.Call2Context(context.Background(), path, request)
+}
 
-	if c.Debug {
-		log.Std.Info("Start Request API...")
-	}
+// CallContext 同Call，ctx取消时立即返回
+func (c *Client) CallContext(ctx context.Context, path string, request map[string]interface{}) (*gjson.Result, error) {
+	return c.call(ctx, path, request)
+}
 
-	r, err := c.client.Post(c.BaseURL, req.BodyJSON(&body), authHeader)
+// Call2Context 同Call2，ctx取消时立即返回
+func (c *Client) Call2Context(ctx context.Context, path string, request []string) (*gjson.Result, error) {
+	return c.call(ctx, path, request)
+}
 
-	if c.Debug {
-		log.Std.Info("Request API Completed")
+// call 可重试的错误按抖动的指数退避重试，广播交易只在确定未发出时重试
+func (c *Client) call(ctx context.Context, path string, request interface{}) (*gjson.Result, error) {
+	if c.client == nil || len(c.endpoints) == 0 {
+		return nil, errors.New("API url is not setup. ")
 	}
 
-	if c.Debug {
-		log.Std.Info("%+v", r)
-	}
+	for attempt := 0; ; attempt++ {
+		result, err := c.callEndpoints(ctx, path, request)
+		if err == nil || !c.shouldRetry(path, err) || attempt >= c.MaxRetries {
+			return result, err
+		}
 
-	if err != nil {
-		return nil, err
+		delay := c.backoff(attempt, err)
+		log.Std.Warning("%s failed: %v, retry in %v", path, err, delay)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
 	}
+}
 
-	resp := gjson.ParseBytes(r.Bytes())
-	err = isError(&resp)
-	if err != nil {
-		return nil, err
+// callEndpoints 依次尝试各节点，节点故障时切换到下一个
+func (c *Client) callEndpoints(ctx context.Context, path string, request interface{}) (*gjson.Result, error) {
+	var lastErr error
+	for _, ep := range c.orderedEndpoints() {
+		result, err := c.callEndpoint(ctx, ep, path, request)
+		if err == nil || !c.shouldRetry(path, err) {
+			return result, err
+		}
+		if len(c.endpoints) > 1 {
+			log.Std.Warning("node %s failed: %v, try next node", ep.URL, err)
+		}
+		lastErr = err
 	}
-
-	result := resp.Get("result")
-
-	return &result, nil
+	return nil, lastErr
 }
 
-func (c *Client) Call2(path string, request []string) (*gjson.Result, error) {
+// callEndpoint 向单个节点发送请求并记录其健康信息
+func (c *Client) callEndpoint(ctx context.Context, ep *Endpoint, path string, request interface{}) (*gjson.Result, error) {
 
 	var (
 		body = make(map[string]interface{}, 0)
 	)
 
-	if c.client == nil {
-		return nil, errors.New("API url is not setup. ")
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	authHeader := req.Header{
@@ -141,7 +264,15 @@ func (c *Client) Call2(path string, request []string) (*gjson.Result, error) {
 		log.Std.Info("Start Request API...")
 	}
 
-	r, err := c.client.Post(c.BaseURL, req.BodyJSON(&body), authHeader)
+	callCtx := ctx
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	r, err := c.client.Post(ep.URL, req.BodyJSON(&body), authHeader, callCtx)
 
 	if c.Debug {
 		log.Std.Info("Request API Completed")
@@ -152,21 +283,50 @@ func (c *Client) Call2(path string, request []string) (*gjson.Result, error) {
 	}
 
 	if err != nil {
+		//调用方取消不计入节点故障
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		ep.recordFailure()
 		return nil, err
 	}
 
+	if httpErr := newHTTPError(ep.URL, r.Response(), r.Bytes()); httpErr != nil {
+		ep.recordFailure()
+		return nil, httpErr
+	}
+
 	resp := gjson.ParseBytes(r.Bytes())
 	err = isError(&resp)
 	if err != nil {
+		if isRetryable(err) {
+			ep.recordFailure()
+		} else {
+			ep.recordSuccess(time.Since(start))
+		}
 		return nil, err
 	}
+	ep.recordSuccess(time.Since(start))
 
 	result := resp.Get("result")
 
+	//记录节点的最新高度
+	switch path {
+	case "status":
+		ep.recordHead(result.Get("sync_info.latest_block_height").Uint())
+	case "block":
+		if height := result.Get("header.height").Uint(); height > 0 {
+			ep.mu.Lock()
+			if height > ep.head {
+				ep.head = height
+			}
+			ep.mu.Unlock()
+		}
+	}
+
 	return &result, nil
 }
 
-
 // See 2 (end of page 4) http://www.ietf.org/rfc/rfc2617.txt
 // "To receive authorization, the client sends the userid and password,
 // separated by a single colon (":") character, within a base64
@@ -179,7 +339,7 @@ func BasicAuth(username, password string) string {
 	//return username + ":" + password
 }
 
-//isError 是否报错
+//isError 是否报错，节点错误返回 *RPCError
 func isError(result *gjson.Result) error {
 	var (
 		err error
@@ -206,47 +366,66 @@ func isError(result *gjson.Result) error {
 		return nil
 	}
 
-	errInfo := fmt.Sprintf("[%d]%s",
-		result.Get("error.code").Int(),
-		result.Get("error").String())
-	err = errors.New(errInfo)
+	err = newRPCError(result.Get("error"))
 
 	return err
 }
 
 // 获取当前区块高度
 func (c *Client) getBlockHeight() (uint64, error) {
+	return c.GetBlockHeight(context.Background())
+}
+
+func (c *Client) GetBlockHeight(ctx context.Context) (uint64, error) {
 
 	request := map[string]interface{}{
 		"finality":"final",
 	}
 
-	resp, err := c.Call("block", request)
+	resp, err := c.CallContext(ctx, "block", request)
 	if err != nil {
 		return 0, err
 	}
 	return resp.Get("header").Get("height").Uint(), nil
 }
 
-func (c *Client) getRecentBlockHash() (string, error) {
+func (c *Client) GetRecentBlockHash(ctx context.Context) (string, error) {
 
 	request := map[string]interface{}{
 		"finality":"final",
 	}
 
-	resp, err := c.Call("block", request)
+	resp, err := c.CallContext(ctx, "block", request)
 	if err != nil {
 		return "", err
 	}
 	return resp.Get("header").Get("hash").String(), nil
 }
 
+// GetRecentBlockHeader 获取最新确认区块的哈希和高度
+func (c *Client) GetRecentBlockHeader(ctx context.Context) (string, uint64, error) {
+
+	request := map[string]interface{}{
+		"finality":"final",
+	}
+
+	resp, err := c.CallContext(ctx, "block", request)
+	if err != nil {
+		return "", 0, err
+	}
+	return resp.Get("header").Get("hash").String(), resp.Get("header").Get("height").Uint(), nil
+}
+
 // 通过高度获取区块哈希
 func (c *Client) getBlockHash(height uint64) (string, error) {
+	return c.GetBlockHash(context.Background(), height)
+}
+
+func (c *Client) GetBlockHash(ctx context.Context, height uint64) (string, error) {
 	request := map[string]interface{}{
 			"block_id": height,
 		}
-	resp, err := c.Call("block", request)
+	resp, err := c.CallContext(ctx, "block", request)
 
 	if err != nil {
 		return "", err
@@ -256,78 +435,139 @@ func (c *Client) getBlockHash(height uint64) (string, error) {
 }
 
 func (c *Client) getNonce(address string) (uint64, error) {
-	pubkey, _ := hex.DecodeString(address)
-	request := map[string]interface{}{
-		"request_type": "view_access_key",
-		"finality": "final",
-		"account_id": address,
-		"public_key": "ed25519:" + Encode(pubkey, BitcoinAlphabet),
-		}
+	return c.GetNonce(context.Background(), address)
+}
 
-	r, err := c.Call("query", request)
+func (c *Client) GetNonce(ctx context.Context, address string) (uint64, error) {
+	publicKey, err := nearKey.NewPublicKey(address)
+	if err != nil {
+		return 0, err
+	}
 
+	accessKey, err := c.GetAccessKey(ctx, address, publicKey)
 	if err != nil {
 		return 0, err
 	}
+	if accessKey == nil {
+		return 0, fmt.Errorf("access key %s of %s does not exist", publicKey, address)
+	}
+	return accessKey.Nonce, nil
+}
+
+// GetAccessKey 查询账户的access key，不存在时返回nil
+func (c *Client) GetAccessKey(ctx context.Context, accountID string, publicKey *nearKey.PublicKey) (*nearTransaction.AccessKey, error) {
+	request := map[string]interface{}{
+		"request_type":"view_access_key",
+		"finality":"final",
+		"account_id":accountID,
+		"public_key":publicKey.String(),
+	}
 
-	if r.Get("error").String() != "" {
-		return 0, errors.New(r.Get("error").String())
+	r, err := c.CallContext(ctx, "query", request)
+	if err == nil && r.Get("error").String() != "" {
+		//旧版本节点在result中返回错误
+		err = newQueryError(r.Get("error").String())
 	}
-	return r.Get("nonce").Uint(), nil
+	if err != nil {
+		if errors.Is(err, ErrUnknownAccessKey) || errors.Is(err, ErrUnknownAccount) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return nearTransaction.ParseAccessKey([]byte(r.Raw))
 }
 
-func (c *Client) getGasPrice() (*big.Int, error) {
-	request := []string{"F8dnD4nnCTPoEiYCrZNAq6eMpAR9vzazkNnH7DJo5wbw"}
+// GetAccessKeyList 查询账户的所有access key，账户不存在时返回nil
+func (c *Client) GetAccessKeyList(ctx context.Context, accountID string) ([]*AccessKeyInfo, error) {
+	request := map[string]interface{}{
+		"request_type": "view_access_key_list",
+		"finality":     "final",
+		"account_id":   accountID,
+	}
 
-	r, err := c.Call2("gas_price", request)
-	
-	fmt.Println(r)
-	fmt.Println(err)
+	r, err := c.CallContext(ctx, "query", request)
+	if err == nil && r.Get("error").String() != "" {
+		err = newQueryError(r.Get("error").String())
+	}
+	if err != nil {
+		if errors.Is(err, ErrUnknownAccount) {
+			return nil, nil
+		}
+		return nil, err
+	}
 
-	return nil, nil
+	keys := make([]*AccessKeyInfo, 0)
+	for _, item := range r.Get("keys").Array() {
+		publicKey, err := nearKey.ParsePublicKey(item.Get("public_key").String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid access key of %s: %v", accountID, err)
+		}
+		accessKey, err := nearTransaction.ParseAccessKey([]byte(item.Get("access_key").Raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid access key %s of %s: %v", publicKey, accountID, err)
+		}
+		keys = append(keys, &AccessKeyInfo{PublicKey: publicKey, AccessKey: accessKey})
+	}
+	return keys, nil
 }
 
+// 隐式账户（公钥hex）是否存在对应的access key
 func (c *Client) getAccess(pubkey string) bool {
-	pubBytes, _ := hex.DecodeString(pubkey)
-	request := map[string]interface{}{
-		"request_type":"view_access_key",
-		"finality":"final",
-		"account_id":pubkey,
-		"public_key":"ed25519:"+Encode(pubBytes, BitcoinAlphabet),
-	}
+	return c.getAccessContext(context.Background(), pubkey)
+}
 
-	r, err := c.Call("query", request)
+func (c *Client) getAccessContext(ctx context.Context, pubkey string) bool {
+	publicKey, err := nearKey.NewPublicKey(pubkey)
+	if err != nil {
+		return false
+	}
 
-	fmt.Println(r)
-	fmt.Println(err)
-	return false
+	r, err := c.GetAccessKey(ctx, pubkey, publicKey)
+	return err == nil && r != nil
 }
 
 // 获取地址余额
 func (c *Client) getBalance(address string) (*AddrBalance, error) {
+	return c.GetBalance(context.Background(), address)
+}
+
+func (c *Client) GetBalance(ctx context.Context, address string) (*AddrBalance, error) {
 	request := map[string]interface{}{
 			"request_type":"view_account",
 			"finality":"final",
 			"account_id":address,
 		}
 
-	r, err := c.Call("query", request)
+	r, err := c.CallContext(ctx, "query", request)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "does not exist while viewing") {
+		if errors.Is(err, ErrUnknownAccount) {
 			return &AddrBalance{Address: address, Balance: big.NewInt(0), Actived: false}, nil
 		} else {
 			return nil, err
 		}
 	}
 
-	totalAmount, _ := new(big.Int).SetString(r.Get("amount").String(), 10)
-	storage, _ := new(big.Int).SetString(r.Get("storage_usage").String(), 10)
-	storagePrice, _ := new(big.Int).SetString("100000000000000000000", 10)
-	storageAmount := new(big.Int).Mul(storage, storagePrice)
+	totalAmount, err := nearTransaction.ParseYocto(r.Get("amount").String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount of %s: %v", address, err)
+	}
+	storage, ok := new(big.Int).SetString(r.Get("storage_usage").String(), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid storage_usage of %s", address)
+	}
+	if !storage.IsUint64() {
+		return nil, fmt.Errorf("invalid storage_usage of %s", address)
+	}
+	//存储占用的余额按协议配置的单价锁定
+	config, err := c.GetProtocolConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	storageAmount := config.StorageCost(storage.Uint64())
 
 
-	return &AddrBalance{Address: address, Balance: new(big.Int).Sub(totalAmount, storageAmount), Actived: true}, nil
+	return &AddrBalance{Address: address, Balance: new(big.Int).Sub(totalAmount.BigInt(), storageAmount), Actived: true}, nil
 }
 
 //func (c *Client) isActived(address string) (bool, error) {
@@ -350,38 +590,46 @@ func (c *Client) getBalance(address string) (*AddrBalance, error) {
 //	return true, nil
 //}
 
-// 获取区块信息
-func (c *Client) getBlock(hash string) (*Block, error) {
+// GetBlock 获取区块信息
+func (c *Client) GetBlock(ctx context.Context, hash string) (*Block, error) {
 	request := map[string]interface{}{
 			"block_id":hash,
 		}
-	resp, err := c.Call("block", request)
+	resp, err := c.CallContext(ctx, "block", request)
 
 	if err != nil {
 		return nil, err
 	}
-	return c.NewBlock(resp), nil
+	return c.newBlock(ctx, resp), nil
 }
 
 func (c *Client) getBlockByHeight(height uint64) (*Block, error) {
+	return c.GetBlockByHeight(context.Background(), height)
+}
+
+func (c *Client) GetBlockByHeight(ctx context.Context, height uint64) (*Block, error) {
 	request := map[string]interface{}{
 			"block_id":height,
 		}
-	resp, err := c.Call("block", request)
+	resp, err := c.CallContext(ctx, "block", request)
 
 	if err != nil {
 		return nil, err
 	}
-	return c.NewBlock(resp), nil
+	return c.newBlock(ctx, resp), nil
+}
+
+func (c *Client) getTransactionsInChunks(hash string) ([]string, error) {
+	return c.GetChunkTransactions(context.Background(), hash)
 }
 
-func (c *Client) getTransactionsInChunks(hash string)([]string, error) {
+func (c *Client) GetChunkTransactions(ctx context.Context, hash string) ([]string, error) {
 
 	request := []string{
 		hash,
 	}
 
-	resp, err := c.Call2("chunk", request)
+	resp, err := c.Call2Context(ctx, "chunk", request)
 	if err != nil {
 		return nil, err
 	}
@@ -402,40 +650,15 @@ func (c *Client) getTransactionsInChunks(hash string)([]string, error) {
 }
 
 func (c *Client) getTransaction(txid string) (*Transaction, error) {
-	request := []string{txid, "test"}
-	resp, err := c.Call2("tx", request)
-	if err != nil {
-		return nil, err
-	}
-	return c.NewTransaction(resp), nil
+	return c.GetTransaction(context.Background(), txid)
 }
 
-
-func (c *Client) getTxStatus(txid string) {
+func (c *Client) GetTransaction(ctx context.Context, txid string) (*Transaction, error) {
 	request := []string{txid, "test"}
-	resp, err := c.Call2("EXPERIMENTAL_tx_status", request)
-
-	fmt.Println(err)
-	fmt.Println(resp)
-}
-
-
-func (c *Client) sendTransaction(rawTx string) (string, error) {
-	request := []string{rawTx}
-
-	resp, err := c.Call2("broadcast_tx_commit", request)
-
+	resp, err := c.Call2Context(ctx, "tx", request)
 	if err != nil {
-		return "", err
-	}
-
-	//time.Sleep(time.Duration(1) * time.Second)
-	//
-	//if resp.Get("engine_result").String() != "tesSUCCESS" && resp.Get("engine_result").String() != "terQUEUED" {
-	//	return "", errors.New("Submit transaction with error: " + resp.Get("engine_result_message").String())
-	//}
-	if resp.Get("status").Get("SuccessValue").String() != "" {
-		return "", errors.New(resp.Get("status").Get("SuccessValue").String())
+		return nil, err
 	}
-	return resp.Get("transaction").Get("hash").String(), nil
+	return c.newTransaction(ctx, resp)
 }
+
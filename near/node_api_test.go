@@ -1,130 +1,191 @@
 package near
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/near-adapter/borsh"
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
+	"github.com/blocktree/near-adapter/neartest"
+	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
 )
 
-const (
-	testNodeAPI = "https://rpc.mainnet.near.org/"
-
-)
+//newTransferNode 模拟节点上的隐式账户向 bob.near 转账，返回转账所在的区块和交易哈希
+func newTransferNode(t *testing.T) (*neartest.Server, *neartest.Block, string, string) {
+	t.Helper()
+	node := neartest.NewServer()
+	t.Cleanup(node.Close)
+
+	privateKey := bytes.Repeat([]byte{2}, 32)
+	privateKey[0] &= 248
+	privateKey[31] = privateKey[31]&127 | 64
+	pubBytes, _ := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_ED25519)
+	pub, _ := nearKey.NewPublicKey(hex.EncodeToString(pubBytes))
+	sender, _ := pub.ImplicitAccountID()
+	balance, _ := nearTransaction.ParseNEAR("10")
+	node.AddAccount(sender, balance, pub)
+	node.AddAccount("bob.near", nearTransaction.YoctoAmount{})
+	node.ProduceBlock()
+
+	ts, _ := nearTransaction.NewTxStruct(sender, hex.EncodeToString(pubBytes), 1, "bob.near", node.Head().Hash,
+		nearTransaction.NewTransferAction(nearTransaction.YoctoFromUint64(1000)))
+	rawTx, err := neartest.SignTransaction(ts, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txid, err := newRetryClient(node.URL).BroadcastTransactionAsync(context.Background(), rawTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := node.ProduceBlock()
+	node.ProduceBlocks(2)
+	return node, block, sender, txid
+}
 
 func Test_getBlockHeight(t *testing.T) {
-
-	c := NewClient(testNodeAPI, true)
+	node := neartest.NewServer()
+	defer node.Close()
+	node.ProduceBlocks(3)
+	c := newRetryClient(node.URL)
 
 	r, err := c.getBlockHeight()
-
-	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Println("height:", r)
+	if err != nil || r != node.Head().Height {
+		t.Errorf("height: %d, %v, expect %d", r, err, node.Head().Height)
 	}
 }
 
 func Test_getNonce(t *testing.T) {
-	address := "95cc0306c93744612e7986f6a3cc1e091a95a1bcb51cdd8885b35e0eb6229527"
-	c := NewClient(testNodeAPI, true)
-	r, err := c.getNonce(address)
-	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Println(r)
+	node, _, sender, _ := newTransferNode(t)
+	c := newRetryClient(node.URL)
+
+	r, err := c.getNonce(sender)
+	if err != nil || r != 1 {
+		t.Errorf("nonce: %d, %v", r, err)
+	}
+	if _, err := c.getNonce(hex.EncodeToString(make([]byte, 32))); err == nil {
+		t.Error("missing access key should fail")
 	}
 }
 
 func Test_getBlockByHeight(t *testing.T) {
+	node, block, _, txid := newTransferNode(t)
+	c := newRetryClient(node.URL)
 
-	c := NewClient(testNodeAPI, true)
-	r, err := c.getBlockByHeight(20525812)//114853
+	r, err := c.getBlockByHeight(block.Height)
 	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Println(r)
+		t.Fatal(err)
+	}
+	if r.Hash != block.Hash || r.PrevBlockHash != block.PrevHash || r.Height != block.Height ||
+		len(r.Transactions) != 1 || r.Transactions[0] != txid {
+		t.Errorf("wrong block: %+v", r)
+	}
+	if _, err := c.getBlockByHeight(node.Head().Height + 10); !errors.Is(err, ErrUnknownBlock) {
+		t.Errorf("future block: %v", err)
 	}
 }
 
-
 func Test_getBlockHash(t *testing.T) {
-
-	c := NewClient(testNodeAPI, true)
-
-	height := uint64(20634163)
-
-	r, err := c.getBlockHash(height)
-
-	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Println(r)
+	node := neartest.NewServer()
+	defer node.Close()
+	block := node.ProduceBlock()
+	node.ProduceBlocks(2)
+	c := newRetryClient(node.URL)
+
+	r, err := c.getBlockHash(block.Height)
+	if err != nil || r != block.Hash {
+		t.Errorf("hash: %s, %v, expect %s", r, err, block.Hash)
 	}
-
 }
 
 func Test_getGasPrice(t *testing.T) {
-	c := NewClient(testNodeAPI, true)
-
-	c.getGasPrice()
+	node := neartest.NewServer()
+	defer node.Close()
+	node.ProduceBlock()
+	c := newRetryClient(node.URL)
+
+	r, err := c.getGasPrice()
+	if err != nil || r.Cmp(node.Head().GasPrice) != 0 {
+		t.Errorf("gas price: %v, %v, expect %v", r, err, node.Head().GasPrice)
+	}
 }
 
 func Test_getAccess(t *testing.T) {
-	c := NewClient(testNodeAPI, true)
-	//address := "d3539d5e972dc51e8bb2f023c9499394a9325710e19a09c7c1c9afc71053f7f4"
-	address := "71a2caf1b6f369d64dc2ca2db950d7b296bfbe958a416fa294a83dbcd2cbe6f1"
+	node, _, sender, _ := newTransferNode(t)
+	c := newRetryClient(node.URL)
 
-	c.getAccess(address)
+	if !c.getAccess(sender) {
+		t.Errorf("%s should have its access key", sender)
+	}
+	if c.getAccess(hex.EncodeToString(make([]byte, 32))) {
+		t.Error("missing account should have no access key")
+	}
 }
 
 func Test_getBalance(t *testing.T) {
+	node, _, sender, _ := newTransferNode(t)
+	c := newRetryClient(node.URL)
 
-	c := NewClient(testNodeAPI, true)
-	//address := "d3539d5e972dc51e8bb2f023c9499394a9325710e19a09c7c1c9afc71053f7f4"
-	address := "71a2caf1b6f369d64dc2ca2db950d7b296bfbe958a416fa294a83dbcd2cbe6f1"
-
-	r, err := c.getBalance(address)
-
+	r, err := c.getBalance("bob.near")
 	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Println(r.Balance.String())
+		t.Fatal(err)
+	}
+	//存储占用的余额不可用
+	storage := new(big.Int).Mul(node.StorageAmountPerByte.BigInt(), new(big.Int).SetUint64(node.StorageUsage))
+	if expect := new(big.Int).Sub(big.NewInt(1000), storage); !r.Actived || r.Balance.Cmp(expect) != 0 {
+		t.Errorf("balance: %s, expect %s", r.Balance, expect)
+	}
+
+	if r, err = c.getBalance(sender); err != nil || r.Balance.Sign() <= 0 {
+		t.Errorf("sender balance: %+v, %v", r, err)
+	}
+	if r, err = c.getBalance("missing.near"); err != nil || r.Actived || r.Balance.Sign() != 0 {
+		t.Errorf("missing account: %+v, %v", r, err)
 	}
 }
 
 func Test_getChunk(t *testing.T) {
-	c := NewClient(testNodeAPI, true)
-
-	chunk := "HPJ95VF6YArbSkkqpaJUnqLnE8LoVxHcUwmb9XW2itLZ"
+	node, block, _, txid := newTransferNode(t)
+	c := newRetryClient(node.URL)
 
-	r, err := c.getTransactionsInChunks(chunk)
-
-	fmt.Println(err)
-	fmt.Println(r)
+	r, err := c.getTransactionsInChunks(block.ChunkHash)
+	if err != nil || len(r) != 1 || r[0] != txid {
+		t.Errorf("chunk transactions: %v, %v", r, err)
+	}
+	if _, err := c.getTransactionsInChunks("missing"); !errors.Is(err, ErrUnknownChunk) {
+		t.Errorf("missing chunk: %v", err)
+	}
 }
 
 func Test_getTransaction(t *testing.T) {
+	node, block, sender, txid := newTransferNode(t)
+	c := newRetryClient(node.URL)
 
-	c := NewClient(testNodeAPI, true)
-	txid := "FFfHgQNkysH3x9NZowNtLoDeMzpADpmAos1hFo4WUNhw"
 	r, err := c.getTransaction(txid)
-
 	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Println(r)
+		t.Fatal(err)
+	}
+	if r.TxID != txid || r.TxType != "transfer" || r.From != sender || r.To != "bob.near" ||
+		r.Amount.YoctoString() != "1000" || r.BlockHash != block.Hash || r.BlockHeight != block.Height {
+		t.Errorf("wrong transaction: %+v", r)
 	}
 
-	txid = "63pwAr4X3wq8otjvaAqbHuGC7p1JF29z5D5SbTEW298V"
-	r, err = c.getTransaction(txid)
-
-	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Println(r)
+	if _, err = c.getTransaction("FFfHgQNkysH3x9NZowNtLoDeMzpADpmAos1hFo4WUNhw"); !errors.Is(err, ErrUnknownTransaction) {
+		t.Errorf("missing transaction: %v", err)
 	}
 }
 
@@ -156,27 +217,787 @@ func Test_convert(t *testing.T) {
 }
 
 func Test_getTransactionByAddresses(t *testing.T) {
-	addrs := "ARAA8AnUYa4kWwWkiZTTyztG5C6S9MFTx11"
+	node, _, sender, _ := newTransferNode(t)
+	c := newRetryClient(node.URL)
+
+	//NEAR 节点没有按地址查询交易的接口
+	var rpcErr *RPCError
+	if _, err := c.getMultiAddrTransactions("MemoData", 0, -1, sender); !errors.As(err, &rpcErr) {
+		t.Errorf("expect a method not found error, got %v", err)
+	}
+}
+
+func Test_tmp(t *testing.T) {
+	node, block, _, _ := newTransferNode(t)
+	c := newRetryClient(node.URL)
+
+	r, err := c.getBlockByHeight(block.Height - 1)
+	if err != nil || r.Hash != node.Block(block.Height-1).Hash || len(r.Transactions) != 0 {
+		t.Errorf("block before the transfer: %+v, %v", r, err)
+	}
+}
+
+func Test_isError(t *testing.T) {
+	cases := []struct {
+		resp   string
+		kind   error
+		txKind string
+	}{
+		{`{"jsonrpc":"2.0","error":{"name":"HANDLER_ERROR","cause":{"info":{},"name":"UNKNOWN_BLOCK"},"code":-32000,"message":"Server error","data":"DB Not Found Error: BLOCK HEIGHT: 1"},"id":"1"}`,
+			ErrUnknownBlock, ""},
+		{`{"jsonrpc":"2.0","error":{"name":"HANDLER_ERROR","cause":{"info":{"requested_account_id":"x.near"},"name":"UNKNOWN_ACCOUNT"},"code":-32000,"message":"Server error","data":"account x.near does not exist while viewing"},"id":"1"}`,
+			ErrUnknownAccount, ""},
+		{`{"jsonrpc":"2.0","error":{"code":-32000,"message":"Server error","data":"account x.near does not exist while viewing"},"id":"1"}`,
+			ErrUnknownAccount, ""},
+		{`{"jsonrpc":"2.0","error":{"name":"HANDLER_ERROR","cause":{"name":"INVALID_TRANSACTION","info":{"TxExecutionError":{"InvalidTxError":{"InvalidNonce":{"ak_nonce":5,"tx_nonce":5}}}}},"code":-32000,"message":"Server error","data":{"TxExecutionError":{"InvalidTxError":{"InvalidNonce":{"ak_nonce":5,"tx_nonce":5}}}}},"id":"1"}`,
+			ErrInvalidTransaction, "InvalidNonce"},
+		{`{"jsonrpc":"2.0","error":{"code":-32000,"message":"Server error","data":{"TxExecutionError":{"InvalidTxError":"Expired"}}},"id":"1"}`,
+			ErrInvalidTransaction, "Expired"},
+		{`{"jsonrpc":"2.0","error":{"name":"HANDLER_ERROR","cause":{"name":"TIMEOUT_ERROR"},"code":-32000,"message":"Server error","data":"Timeout"},"id":"1"}`,
+			ErrTimeout, ""},
+		{`{"jsonrpc":"2.0","error":{"name":"HANDLER_ERROR","cause":{"name":"GARBAGE_COLLECTED_BLOCK","info":{}},"code":-32000,"message":"Server error"},"id":"1"}`,
+			ErrGarbageCollected, ""},
+	}
+
+	for _, c := range cases {
+		resp := gjson.Parse(c.resp)
+		err := isError(&resp)
+		if !errors.Is(err, c.kind) {
+			t.Errorf("expect %v, got %v", c.kind, err)
+			continue
+		}
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Code != -32000 || rpcErr.TxErrorKind != c.txKind {
+			t.Errorf("wrong rpc error %+v", rpcErr)
+		}
+		if errors.Is(err, ErrUnknownAccessKey) {
+			t.Errorf("%v should not be an unknown access key", err)
+		}
+	}
+
+	if err := newQueryError("access key ed25519:abc does not exist while viewing"); !errors.Is(err, ErrUnknownAccessKey) {
+		t.Errorf("legacy query error not classified: %v", err)
+	}
+
+	ok := gjson.Parse(`{"jsonrpc":"2.0","result":{},"id":"1"}`)
+	if err := isError(&ok); err != nil {
+		t.Error(err)
+	}
+}
 
-	c := NewClient(testNodeAPI, true)
-	result, err := c.getMultiAddrTransactions("MemoData", 0, -1, addrs)
+// testNode 本地模拟节点，head为status和block返回的高度，fail为true时返回HTTP 500
+type testNode struct {
+	*httptest.Server
+	head  uint64
+	fail  bool
+	calls int32
+}
+
+func newTestNode(head uint64, fail bool) *testNode {
+	n := &testNode{head: head, fail: fail}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		method := gjson.GetBytes(body, "method").String()
+		if method != "status" {
+			atomic.AddInt32(&n.calls, 1)
+		}
+		if n.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch method {
+		case "status":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"1","result":{"sync_info":{"latest_block_height":%d}}}`, n.head)
+		case "block":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"1","result":{"header":{"height":%d,"hash":"h%d"}}}`, n.head, n.head)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"1","error":{"name":"HANDLER_ERROR","cause":{"name":"UNKNOWN_ACCOUNT","info":{}},"code":-32000,"message":"Server error"}}`)
+		}
+	}))
+	return n
+}
 
+func Test_ParseEndpoints(t *testing.T) {
+	endpoints, err := ParseEndpoints("https://a.org/, https://b.org/|5 ,https://c.org/")
 	if err != nil {
-		t.Error("get transactions failed!")
-	} else {
-		for _, tx := range result {
-			fmt.Println(tx.TxID)
+		t.Fatal(err)
+	}
+	if len(endpoints) != 3 || endpoints[0].Priority != 0 || endpoints[1].URL != "https://b.org/" || endpoints[1].Priority != 5 ||
+		endpoints[2].Priority != 2 {
+		t.Errorf("wrong endpoints %+v %+v %+v", endpoints[0], endpoints[1], endpoints[2])
+	}
+	if _, err := ParseEndpoints(" , "); err == nil {
+		t.Error("empty node api should be rejected")
+	}
+	if _, err := ParseEndpoints("https://a.org/|x"); err == nil {
+		t.Error("invalid priority should be rejected")
+	}
+}
+
+func Test_ClientFailover(t *testing.T) {
+	down := newTestNode(0, true)
+	defer down.Close()
+	up := newTestNode(100, false)
+	defer up.Close()
+
+	c := NewClientWithEndpoints([]*Endpoint{NewEndpoint(down.URL, 0), NewEndpoint(up.URL, 1)}, false)
+	c.HealthCheckInterval = 0
+
+	for i := 0; i < endpointMaxFailures+2; i++ {
+		height, err := c.getBlockHeight()
+		if err != nil || height != 100 {
+			t.Fatalf("expect failover to the backup node, got %d %v", height, err)
 		}
 	}
+	//连续失败后暂停使用故障节点
+	if calls := atomic.LoadInt32(&down.calls); calls != endpointMaxFailures {
+		t.Errorf("expect %d calls to the failed node, got %d", endpointMaxFailures, calls)
+	}
+	status := c.Endpoints()
+	if !status[0].Suspended || status[0].ErrorRate == 0 || status[1].Suspended || status[1].HeadHeight != 100 {
+		t.Errorf("wrong endpoint status %+v", status)
+	}
+
+	//节点明确返回的错误不切换节点
+	calls := atomic.LoadInt32(&up.calls)
+	if _, err := c.getBalance("x.near"); err != nil {
+		t.Error(err)
+	}
+	if atomic.LoadInt32(&up.calls) != calls+1 || atomic.LoadInt32(&down.calls) != endpointMaxFailures {
+		t.Error("request errors should not fail over")
+	}
+
+	up.fail = true
+	c.RetryBaseDelay = time.Millisecond
+	if _, err := c.getBlockHeight(); err == nil {
+		t.Error("expect error when all nodes are down")
+	}
 }
 
-func Test_tmp(t *testing.T) {
+func Test_ClientLaggingNode(t *testing.T) {
+	lagging := newTestNode(100, false)
+	defer lagging.Close()
+	synced := newTestNode(200, false)
+	defer synced.Close()
+
+	c := NewClientWithEndpoints([]*Endpoint{NewEndpoint(lagging.URL, 0), NewEndpoint(synced.URL, 1)}, false)
+	c.HealthCheckInterval = 0
+	c.CheckEndpoints()
+
+	height, err := c.getBlockHeight()
+	if err != nil || height != 200 {
+		t.Errorf("expect the synced node, got %d %v", height, err)
+	}
+	if status := c.Endpoints(); !status[0].Lagging || status[1].Lagging {
+		t.Errorf("wrong endpoint status %+v", status)
+	}
+
+	//追上后恢复优先级
+	lagging.head = 195
+	c.CheckEndpoints()
+	if height, _ := c.getBlockHeight(); height != 195 {
+		t.Errorf("expect the primary node once synced, got %d", height)
+	}
+}
+
+// newFlakyNode 前 failures 次请求返回 status，之后返回 block
+func newFlakyNode(failures int32, status int, delay time.Duration) (*httptest.Server, *int32) {
+	calls := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(status)
+			return
+		}
+		time.Sleep(delay)
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":"1","result":{"header":{"height":7,"hash":"h7"}}}`)
+	}))
+	return server, calls
+}
+
+func newRetryClient(url string) *Client {
+	c := NewClient(url, false)
+	c.RetryBaseDelay = time.Millisecond
+	c.RetryMaxDelay = 10 * time.Millisecond
+	return c
+}
+
+func Test_ClientRetry(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusBadGateway} {
+		server, calls := newFlakyNode(2, status, 0)
+		c := newRetryClient(server.URL)
+
+		height, err := c.getBlockHeight()
+		if err != nil || height != 7 || atomic.LoadInt32(calls) != 3 {
+			t.Errorf("%d: expect success after 2 retries, got %d %v, %d calls", status, height, err, atomic.LoadInt32(calls))
+		}
+
+		c.MaxRetries = 1
+		atomic.StoreInt32(calls, -10)
+		_, err = c.getBlockHeight()
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != status || atomic.LoadInt32(calls) != -8 {
+			t.Errorf("%d: expect error after max retries, got %v, %d calls", status, err, atomic.LoadInt32(calls))
+		}
+		if status == http.StatusTooManyRequests && !errors.Is(err, ErrRateLimited) {
+			t.Errorf("429 should be ErrRateLimited: %v", err)
+		}
+		server.Close()
+	}
+
+	//节点明确返回的错误不重试
+	node := newTestNode(1, false)
+	defer node.Close()
+	c := newRetryClient(node.URL)
+	if _, err := c.Call("query", map[string]interface{}{}); !errors.Is(err, ErrUnknownAccount) || atomic.LoadInt32(&node.calls) != 1 {
+		t.Errorf("request errors should not be retried: %v, %d calls", err, atomic.LoadInt32(&node.calls))
+	}
+}
 
-	c := NewClient(testNodeAPI, true)
+func Test_ClientBroadcastRetry(t *testing.T) {
+	server, calls := newFlakyNode(1, http.StatusInternalServerError, 0)
+	defer server.Close()
+	c := newRetryClient(server.URL)
+
+	//节点可能已收到交易，不重试
+	if _, err := c.BroadcastTransactionAsync(context.Background(), "tx"); err == nil || atomic.LoadInt32(calls) != 1 {
+		t.Errorf("broadcast should not be retried on 5xx: %v, %d calls", err, atomic.LoadInt32(calls))
+	}
+
+	//429 时节点未处理请求，可以重试
+	limited, limitedCalls := newFlakyNode(1, http.StatusTooManyRequests, 0)
+	defer limited.Close()
+	c = newRetryClient(limited.URL)
+	if _, err := c.BroadcastTransactionAsync(context.Background(), "tx"); err != nil || atomic.LoadInt32(limitedCalls) != 2 {
+		t.Errorf("broadcast should be retried on 429: %v, %d calls", err, atomic.LoadInt32(limitedCalls))
+	}
+
+	//连接失败时请求未发出，可以切换节点
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	c = NewClientWithEndpoints([]*Endpoint{NewEndpoint(closed.URL, 0), NewEndpoint(server.URL, 1)}, false)
+	c.HealthCheckInterval = 0
+	if _, err := c.BroadcastTransactionAsync(context.Background(), "tx"); err != nil {
+		t.Errorf("broadcast should fail over when the node is unreachable: %v", err)
+	}
+}
+
+func Test_ClientContext(t *testing.T) {
+	server, calls := newFlakyNode(100, http.StatusServiceUnavailable, 0)
+	defer server.Close()
+	c := newRetryClient(server.URL)
+	c.MaxRetries = 100
+	c.RetryBaseDelay = 50 * time.Millisecond
+	c.RetryMaxDelay = 50 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 80*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.GetBlockHeight(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expect context deadline, got %v", err)
+	}
+	if time.Since(start) > time.Second || atomic.LoadInt32(calls) > 5 {
+		t.Errorf("cancelled call should stop retrying, %d calls", atomic.LoadInt32(calls))
+	}
+
+	//单次请求超时后重试
+	slow, slowCalls := newFlakyNode(0, 0, 100*time.Millisecond)
+	defer slow.Close()
+	c = newRetryClient(slow.URL)
+	c.Timeout = 20 * time.Millisecond
+	c.MaxRetries = 1
+	if _, err := c.getBlockHeight(); err == nil || atomic.LoadInt32(slowCalls) != 2 {
+		t.Errorf("expect timeout after 1 retry, got %v, %d calls", err, atomic.LoadInt32(slowCalls))
+	}
+}
+
+func Test_newTxOutcome(t *testing.T) {
+	tests := []struct {
+		json  string
+		state TxState
+		kind  string
+	}{
+		{`{"final_execution_status":"INCLUDED","status":"NotStarted","transaction_outcome":{"block_hash":"b"}}`, TxIncluded, ""},
+		{`{"final_execution_status":"EXECUTED_OPTIMISTIC","status":{"SuccessValue":""}}`, TxExecuted, ""},
+		{`{"final_execution_status":"FINAL","status":{"SuccessValue":"dHJ1ZQ=="}}`, TxFinal, ""},
+		{`{"status":{"SuccessValue":""},"transaction_outcome":{"block_hash":"b"}}`, TxExecuted, ""},
+		{`{"final_execution_status":"FINAL","status":{"Failure":{"ActionError":{"index":0,"kind":{"AccountDoesNotExist":{"account_id":"x.near"}}}}}}`, TxFailed, "AccountDoesNotExist"},
+		{`{"status":{"Failure":{"InvalidTxError":"Expired"}}}`, TxFailed, "Expired"},
+	}
+	for i, test := range tests {
+		result := gjson.Parse(test.json)
+		o := newTxOutcome("tx", "a.near", &result)
+		if o.State != test.state || o.FailureKind != test.kind || (o.Err() != nil) != (test.state == TxFailed) {
+			t.Errorf("%d: got %s %q", i, o.State, o.FailureKind)
+		}
+	}
 
-	block, err := c.getBlockByHeight(48059631)
+	result := gjson.Parse(`{"final_execution_status":"FINAL","status":{"SuccessValue":"dHJ1ZQ=="}}`)
+	if o := newTxOutcome("tx", "a.near", &result); o.SuccessValue != "dHJ1ZQ==" || !o.Reached(WaitUntilExecuted) {
+		t.Errorf("wrong outcome %+v", o)
+	}
+	if _, err := ParseWaitUntil("executed"); err != nil {
+		t.Error(err)
+	}
+	if _, err := ParseWaitUntil("DONE"); err == nil {
+		t.Error("invalid wait_until should be rejected")
+	}
+}
+
+func Test_waitTransaction(t *testing.T) {
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := gjson.ParseBytes(body)
+		switch req.Get("method").String() {
+		case "broadcast_tx_async":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"1","result":"txhash"}`)
+		case "EXPERIMENTAL_tx_status":
+			if req.Get("params.sender_account_id").String() != "a.near" || req.Get("params.wait_until").String() != WaitUntilNone {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if atomic.AddInt32(&polls, 1) < 3 {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":"1","error":{"name":"HANDLER_ERROR","cause":{"name":"UNKNOWN_TRANSACTION","info":{}},"code":-32000,"message":"Server error"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"1","result":{"final_execution_status":"EXECUTED","status":{"SuccessValue":""},"transaction":{"hash":"txhash"}}}`)
+		}
+	}))
+	defer server.Close()
+	c := newRetryClient(server.URL)
+
+	if hash, err := c.BroadcastTransactionAsync(context.Background(), "tx"); err != nil || hash != "txhash" {
+		t.Fatalf("broadcast failed: %s %v", hash, err)
+	}
+
+	outcome, err := waitTransaction(context.Background(), c, "txhash", "a.near", WaitUntilExecuted, time.Millisecond)
+	if err != nil || outcome.State != TxExecuted || atomic.LoadInt32(&polls) != 3 {
+		t.Errorf("expect executed after 3 polls, got %+v %v", outcome, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	atomic.StoreInt32(&polls, -1000)
+	if outcome, err := waitTransaction(ctx, c, "txhash", "a.near", WaitUntilExecuted, 10*time.Millisecond); err != context.DeadlineExceeded || outcome.State != TxPending {
+		t.Errorf("expect timeout while pending, got %+v %v", outcome, err)
+	}
+}
+
+func Test_ClientFakeNode(t *testing.T) {
+	node := neartest.NewServer()
+	defer node.Close()
+
+	privateKey := bytes.Repeat([]byte{1}, 32)
+	privateKey[0] &= 248
+	privateKey[31] = privateKey[31]&127 | 64
+	pubBytes, _ := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_ED25519)
+	address := hex.EncodeToString(pubBytes)
+	pub, _ := nearKey.NewPublicKey(address)
+	balance, _ := nearTransaction.ParseNEAR("10")
+	node.AddAccount(address, balance, pub)
+	node.AddAccount("bob.near", nearTransaction.YoctoAmount{})
+
+	c := newRetryClient(node.URL)
+	ctx := context.Background()
+
+	nonce, err := c.GetNonce(ctx, address)
+	if err != nil || nonce != 0 {
+		t.Fatalf("GetNonce = %d, %v", nonce, err)
+	}
+	ts, _ := nearTransaction.NewTxStruct(address, address, nonce+1, "bob.near", node.Head().Hash,
+		nearTransaction.NewTransferAction(nearTransaction.YoctoFromUint64(100)))
+	rawTx, err := neartest.SignTransaction(ts, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//第一次广播返回429，重试后成功
+	node.FailNext("broadcast_tx_async", neartest.Failure{HTTPStatus: http.StatusTooManyRequests})
+	txid, err := c.BroadcastTransactionAsync(ctx, rawTx)
+	if err != nil || node.Calls("broadcast_tx_async") != 2 {
+		t.Fatalf("broadcast failed: %v", err)
+	}
+	node.SkipHeight()
+	block := node.ProduceBlock()
+
+	outcome, err := waitTransaction(ctx, c, txid, address, WaitUntilExecutedOptimistic, time.Millisecond)
+	if err != nil || outcome.State != TxExecuted || outcome.BlockHash != block.Hash {
+		t.Fatalf("wrong outcome: %+v, %v", outcome, err)
+	}
+
+	height, err := c.GetBlockHeight(ctx)
+	if err != nil || height != block.Height {
+		t.Errorf("GetBlockHeight = %d, %v", height, err)
+	}
+	if _, err := c.GetBlockByHeight(ctx, block.Height-1); !errors.Is(err, ErrUnknownBlock) {
+		t.Errorf("skipped height should be unknown: %v", err)
+	}
+	b, err := c.GetBlockByHeight(ctx, block.Height)
+	if err != nil || b.Hash != block.Hash || len(b.Transactions) != 1 || b.Transactions[0] != txid {
+		t.Fatalf("wrong block: %+v, %v", b, err)
+	}
+	tx, err := c.GetTransaction(ctx, txid)
+	if err != nil || tx.From != address || tx.To != "bob.near" || tx.Amount.YoctoString() != "100" || tx.Fee.Cmp(node.TxFee) != 0 {
+		t.Errorf("wrong transaction: %+v, %v", tx, err)
+	}
+
+	to, err := c.GetBalance(ctx, "bob.near")
+	if err != nil || to.Balance.String() != "100" || !to.Actived {
+		t.Errorf("wrong balance: %+v, %v", to, err)
+	}
+	if missing, err := c.GetBalance(ctx, "carol.near"); err != nil || missing.Actived {
+		t.Errorf("missing account should be inactive: %+v, %v", missing, err)
+	}
+	if nonce, err := c.GetNonce(ctx, address); err != nil || nonce != 1 {
+		t.Errorf("GetNonce = %d, %v", nonce, err)
+	}
+
+	//已使用的nonce被节点拒绝
+	ts.Actions = []nearTransaction.Action{nearTransaction.NewTransferAction(nearTransaction.YoctoFromUint64(200))}
+	rawTx, _ = neartest.SignTransaction(ts, privateKey)
+	if txid, err = c.BroadcastTransactionAsync(ctx, rawTx); err != nil {
+		t.Fatal(err)
+	}
+	outcome, err = waitTransaction(ctx, c, txid, address, WaitUntilIncluded, time.Millisecond)
+	if err != nil || outcome.State != TxFailed || outcome.FailureKind != "InvalidNonce" {
+		t.Errorf("used nonce should be rejected: %+v, %v", outcome, err)
+	}
+}
+
+func Test_ClientEpochParams(t *testing.T) {
+	node := neartest.NewServer()
+	defer node.Close()
+	node.EpochLength = 3
+	node.StorageUsage = 100
+	balance, _ := nearTransaction.ParseNEAR("1")
+	node.AddAccount("alice.near", balance)
+
+	c := newRetryClient(node.URL)
+	c.EpochCheckInterval = 0
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		gasPrice, err := c.GetGasPrice(ctx)
+		if err != nil || gasPrice.Cmp(node.GasPrice) != 0 {
+			t.Fatalf("GetGasPrice = %v, %v", gasPrice, err)
+		}
+	}
+	config, err := c.GetProtocolConfig(ctx)
+	if err != nil || config.EpochLength != 3 || config.TransactionCosts == nil {
+		t.Fatalf("wrong protocol config: %+v, %v", config, err)
+	}
+	if node.Calls("gas_price") != 1 || node.Calls("EXPERIMENTAL_protocol_config") != 1 {
+		t.Errorf("epoch params should be fetched once per epoch, gas_price %d, protocol config %d",
+			node.Calls("gas_price"), node.Calls("EXPERIMENTAL_protocol_config"))
+	}
+
+	//存储占用按协议配置的单价扣除
+	b, err := c.GetBalance(ctx, "alice.near")
+	storage := config.StorageCost(100)
+	if err != nil || new(big.Int).Add(b.Balance, storage).Cmp(balance.BigInt()) != 0 {
+		t.Errorf("wrong balance: %+v, %v", b, err)
+	}
+
+	//新的epoch重新获取
+	node.GasPrice = big.NewInt(200000000)
+	node.ProduceBlocks(3)
+	if gasPrice, err := c.GetGasPrice(ctx); err != nil || gasPrice.Int64() != 200000000 {
+		t.Errorf("gas price of the new epoch = %v, %v", gasPrice, err)
+	}
+	if gasPrice, err := c.GetGasPriceByHeight(ctx, 1); err != nil || gasPrice.Int64() != 100000000 {
+		t.Errorf("GetGasPriceByHeight = %v, %v", gasPrice, err)
+	}
+	if gasPrice, err := c.GetGasPriceByHash(ctx, node.Head().Hash); err != nil || gasPrice.Int64() != 200000000 {
+		t.Errorf("GetGasPriceByHash = %v, %v", gasPrice, err)
+	}
+
+	//节点不可用时使用旧的缓存
+	node.FailNext("block", neartest.Failure{HTTPStatus: http.StatusBadGateway}, neartest.Failure{HTTPStatus: http.StatusBadGateway},
+		neartest.Failure{HTTPStatus: http.StatusBadGateway}, neartest.Failure{HTTPStatus: http.StatusBadGateway})
+	if gasPrice, err := c.GetGasPrice(ctx); err != nil || gasPrice.Int64() != 200000000 {
+		t.Errorf("cached gas price = %v, %v", gasPrice, err)
+	}
+}
+
+func Test_ClientViewFunction(t *testing.T) {
+	node := neartest.NewServer()
+	defer node.Close()
+	node.AddAccount("token.near", nearTransaction.YoctoAmount{})
+	node.SetViewFunction("token.near", "echo", func(args []byte) ([]byte, []string, error) {
+		return args, []string{"echo called"}, nil
+	})
+	node.SetViewFunction("token.near", "panic", func(args []byte) ([]byte, []string, error) {
+		return nil, nil, errors.New("FunctionCallError(HostError(GuestPanic))")
+	})
+
+	c := newRetryClient(node.URL)
+	ctx := context.Background()
+
+	//json参数
+	r, err := c.ViewFunction(ctx, "token.near", "echo", map[string]string{"account_id": "alice.near"}, FinalBlock)
 	if err != nil {
+		t.Fatal(err)
+	}
+	var args map[string]string
+	if err := r.JSON(&args); err != nil || args["account_id"] != "alice.near" {
+		t.Errorf("wrong json result: %s, %v", r.Result, err)
+	}
+	if len(r.Logs) != 1 || r.Logs[0] != "echo called" || r.BlockHash != node.Head().Hash {
+		t.Errorf("wrong view result: %+v", r)
+	}
+
+	//borsh参数原样发送，指定区块
+	node.ProduceBlocks(2)
+	r, err = c.ViewFunction(ctx, "token.near", "echo", BorshArgs{1, 0, 0, 0, 255}, BlockAtHeight(node.Head().Height-1))
+	if err != nil || !bytes.Equal(r.Result, []byte{1, 0, 0, 0, 255}) || r.BlockHeight != node.Head().Height-1 {
+		t.Errorf("wrong borsh result: %+v, %v", r, err)
+	}
+	var result struct {
+		Length uint32
+		Flag   uint8
+	}
+	if err := r.Borsh(&result); err != nil || result.Length != 1 || result.Flag != 255 {
+		t.Errorf("wrong borsh decode: %+v, %v", result, err)
+	}
+	var short struct {
+		Length uint32
+	}
+	if err := r.Borsh(&short); err == nil {
+		t.Error("trailing bytes should fail")
+	}
+
+	if _, err := c.ViewFunction(ctx, "token.near", "panic", nil, OptimisticBlock); !errors.Is(err, ErrContractExecution) {
+		t.Errorf("contract panic: %v", err)
+	}
+	if _, err := c.ViewFunction(ctx, "token.near", "ft_metadata", nil, FinalBlock); !errors.Is(err, ErrContractExecution) {
+		t.Errorf("missing method: %v", err)
+	}
+	if _, err := c.ViewFunction(ctx, "missing.near", "echo", nil, FinalBlock); !errors.Is(err, ErrUnknownAccount) {
+		t.Errorf("missing contract: %v", err)
+	}
+}
+
+func Test_ClientViewStatePages(t *testing.T) {
+	node := neartest.NewServer()
+	defer node.Close()
+	node.AddAccount("token.near", nearTransaction.YoctoAmount{})
+
+	//模拟 near-sdk 的 LookupMap<AccountId, u128>，前缀为 "t"
+	balance := borsh.U128
+	accounts := []string{"alice.near", "bob.near", "carol.near", "dave.near", "erin.near"}
+	for i, account := range accounts {
+		key, _ := borsh.String.Encode(account)
+		value, _ := balance.Encode(uint64(i + 1))
+		node.SetState("token.near", append([]byte("t"), key...), value)
+	}
+	node.SetState("token.near", []byte("STATE"), []byte(`{"owner_id":"alice.near"}`))
+	node.MaxStateSize = 60
+	node.ProduceBlock()
+
+	c := newRetryClient(node.URL)
+	ctx := context.Background()
+
+	if _, err := c.ViewState(ctx, "token.near", nil, FinalBlock); !errors.Is(err, ErrTooLargeState) {
+		t.Fatalf("expect too large state: %v", err)
+	}
+	r, err := c.ViewState(ctx, "token.near", []byte("STATE"), FinalBlock)
+	if err != nil || len(r.Items) != 1 {
+		t.Fatalf("view state: %+v, %v", r, err)
+	}
+	decoded, err := DecodeState(r.Items, nil, nil, JSONDecoder)
+	if err != nil || decoded[0].Value.(map[string]interface{})["owner_id"] != "alice.near" {
+		t.Errorf("decode json state: %+v, %v", decoded, err)
+	}
+
+	//分页过程中出块，所有页仍读取同一个区块
+	items := make([]*StateItem, 0)
+	blockHash := node.Head().Hash
+	err = c.ViewStatePages(ctx, "token.near", []byte("t"), FinalBlock, func(page *StateResult) error {
+		if page.BlockHash != blockHash {
+			t.Errorf("page of block %s, expect %s", page.BlockHash, blockHash)
+		}
+		items = append(items, page.Items...)
+		node.SetState("token.near", []byte("tz"), []byte{0})
+		node.ProduceBlock()
+		return nil
+	})
+	//拆分过的前缀 "t" 本身的key无法确认，Borsh编码的key长于前缀，不会漏读
+	var readErr *StateReadError
+	if !errors.As(err, &readErr) || len(readErr.Keys) != 0 || len(readErr.Prefixes) == 0 ||
+		!bytes.Equal(readErr.Prefixes[len(readErr.Prefixes)-1], []byte("t")) || !errors.Is(err, ErrTooLargeState) {
+		t.Fatalf("expect split prefixes: %v", err)
+	}
+
+	decoded, err = DecodeState(items, []byte("t"), borsh.String, balance)
+	if err != nil || len(decoded) != len(accounts) {
+		t.Fatalf("decode state: %d, %v", len(decoded), err)
+	}
+	//key按Borsh编码的字节序排列
+	for _, item := range decoded {
+		i := 0
+		for i < len(accounts) && accounts[i] != item.Key {
+			i++
+		}
+		if item.Value != strconv.Itoa(i+1) {
+			t.Errorf("wrong state: %v = %v", item.Key, item.Value)
+		}
+	}
+	if _, err := DecodeState(items, []byte("t"), nil, borsh.U64); err == nil {
+		t.Error("wrong schema should fail")
+	}
+
+	//单个值超过节点限制时返回该key
+	node.SetState("token.near", []byte("big"), make([]byte, 100))
+	node.ProduceBlocks(2)
+	items = items[:0]
+	err = c.ViewStatePages(ctx, "token.near", []byte("b"), FinalBlock, func(page *StateResult) error {
+		items = append(items, page.Items...)
+		return nil
+	})
+	if !errors.As(err, &readErr) || len(readErr.Keys) != 1 || string(readErr.Keys[0]) != "big" || len(items) != 0 {
+		t.Fatalf("expect unreadable key: %v, %d items", err, len(items))
+	}
+
+	//请求数超过限制时停止
+	c.MaxStateRequests = 10
+	err = c.ViewStatePages(ctx, "token.near", []byte("t"), FinalBlock, func(page *StateResult) error {
+		return nil
+	})
+	if !errors.Is(err, ErrTooLargeState) || errors.As(err, &readErr) {
+		t.Fatalf("expect request limit: %v", err)
+	}
+}
+
+func Test_CheckNode(t *testing.T) {
+	node := neartest.NewServer()
+	defer node.Close()
+	node.ProduceBlocks(2)
+
+	wm := NewWalletManager()
+	wm.Client = newRetryClient(node.URL)
+	ctx := context.Background()
+
+	status, err := wm.Client.GetStatus(ctx)
+	if err != nil || status.ChainID != "neartest" || status.ProtocolVersion != node.ProtocolVersion ||
+		status.LatestBlockHeight != node.Head().Height || status.LatestBlockHash != node.Head().Hash || status.LatestBlockTime.IsZero() {
+		t.Fatalf("wrong status: %+v, %v", status, err)
+	}
+	network, err := wm.Client.GetNetworkInfo(ctx)
+	if err != nil || network.NumActivePeers != 1 || network.ActivePeers[0].Addr != "127.0.0.1:24567" {
+		t.Fatalf("wrong network info: %+v, %v", network, err)
+	}
+
+	//默认要求主网节点
+	if err := wm.CheckNode(); !errors.Is(err, ErrWrongChain) {
+		t.Errorf("testnet node should be refused: %v", err)
+	}
+	err = wm.TxDecoder.SignRawTransaction(&openwallet.WalletDAIBase{}, &openwallet.RawTransaction{})
+	if !errors.Is(err, ErrWrongChain) {
+		t.Errorf("signing on the wrong chain should be refused: %v", err)
+	}
+
+	wm.Config.ChainID = "neartest"
+	if err := wm.CheckNode(); err != nil {
+		t.Error(err)
+	}
+	if err := wm.ShowNodeInfo(); err != nil {
 		t.Error(err)
 	}
-	fmt.Println(block)
+
+	node.Syncing = true
+	if err := wm.CheckNode(); !errors.Is(err, ErrNotSynced) {
+		t.Errorf("syncing node should be refused: %v", err)
+	}
+}
+
+func Test_ClientStateChanges(t *testing.T) {
+	node := neartest.NewServer()
+	defer node.Close()
+
+	privateKey := bytes.Repeat([]byte{1}, 32)
+	privateKey[0] &= 248
+	privateKey[31] = privateKey[31]&127 | 64
+	pubBytes, _ := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_ED25519)
+	pub, _ := nearKey.NewPublicKey(hex.EncodeToString(pubBytes))
+	balance, _ := nearTransaction.ParseNEAR("10")
+	node.AddAccount("alice.near", balance, pub)
+	node.AddAccount("bob.near", nearTransaction.YoctoFromUint64(1))
+	node.AddAccount("token.near", nearTransaction.YoctoAmount{})
+	node.ProduceBlock()
+
+	//不经过交易的余额变化，如验证人奖励，以及合约状态的变化
+	node.AddAccount("bob.near", nearTransaction.YoctoFromUint64(5))
+	node.SetState("token.near", []byte("tbob.near"), []byte{5})
+	node.SetState("token.near", []byte("STATE"), []byte{1})
+	ts, _ := nearTransaction.NewTxStruct("alice.near", hex.EncodeToString(pubBytes), 1, "bob.near", node.Head().Hash,
+		nearTransaction.NewTransferAction(nearTransaction.YoctoFromUint64(100)))
+	rawTx, _ := neartest.SignTransaction(ts, privateKey)
+
+	c := newRetryClient(node.URL)
+	ctx := context.Background()
+	txid, err := c.BroadcastTransactionAsync(ctx, rawTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := node.ProduceBlock()
+	blockRef := BlockWithHash(block.Hash)
+
+	changes, err := c.GetAccountChanges(ctx, []string{"alice.near", "bob.near"}, blockRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.BlockHash != block.Hash || len(changes.Changes) != 3 {
+		t.Fatalf("wrong account changes: %+v", changes)
+	}
+	reward, sent, received := changes.Changes[0], changes.Changes[1], changes.Changes[2]
+	if reward.AccountID != "bob.near" || reward.Cause.Type != CauseValidatorAccountsUpdate || reward.Amount.YoctoString() != "5" {
+		t.Errorf("wrong reward change: %+v", reward)
+	}
+	if sent.AccountID != "alice.near" || sent.Type != ChangeAccountUpdate || sent.Cause.Type != CauseTransactionProcessing || sent.Cause.TxHash != txid {
+		t.Errorf("wrong sender change: %+v", sent)
+	}
+	//变化后的余额与节点上的账户余额一致
+	if aliceBalance, _ := node.Balance("alice.near"); sent.Amount.Cmp(aliceBalance) != 0 || !sent.Locked.IsZero() {
+		t.Errorf("wrong sender balance: %s, %s", sent.Amount, sent.Locked)
+	}
+	if received.AccountID != "bob.near" || received.Cause.Type != CauseReceiptProcessing || received.Cause.ReceiptHash == "" || received.Amount.YoctoString() != "105" {
+		t.Errorf("wrong receiver change: %+v", received)
+	}
+
+	keyChanges, err := c.GetAccessKeyChanges(ctx, []string{"alice.near"}, blockRef)
+	if err != nil || len(keyChanges.Changes) != 1 {
+		t.Fatalf("wrong access key changes: %+v, %v", keyChanges, err)
+	}
+	if k := keyChanges.Changes[0]; k.Type != ChangeAccessKeyUpdate || k.PublicKey.String() != pub.String() || k.AccessKey.Nonce != 1 {
+		t.Errorf("wrong access key change: %+v", k)
+	}
+
+	dataChanges, err := c.GetDataChanges(ctx, []string{"token.near"}, []byte("t"), blockRef)
+	if err != nil || len(dataChanges.Changes) != 1 {
+		t.Fatalf("wrong data changes: %+v, %v", dataChanges, err)
+	}
+	if d := dataChanges.Changes[0]; d.Type != ChangeDataUpdate || string(d.Key) != "tbob.near" || !bytes.Equal(d.Value, []byte{5}) {
+		t.Errorf("wrong data change: %+v", d)
+	}
+
+	hash, touched, err := c.GetChangesInBlock(ctx, BlockAtHeight(block.Height))
+	if err != nil || hash != block.Hash {
+		t.Fatalf("changes in block: %s, %v", hash, err)
+	}
+	found := make(map[string]bool)
+	for _, a := range touched {
+		found[a.Type+"/"+a.AccountID] = true
+	}
+	for _, want := range []string{"account_touched/alice.near", "account_touched/bob.near", "access_key_touched/alice.near", "data_touched/token.near"} {
+		if !found[want] {
+			t.Errorf("%s not in changes in block: %+v", want, touched)
+		}
+	}
+
+	if _, err := c.GetAccountChanges(ctx, []string{"alice.near"}, BlockWithHash("11111111111111111111111111111111")); !errors.Is(err, ErrUnknownBlock) {
+		t.Errorf("unknown block: %v", err)
+	}
 }
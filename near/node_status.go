@@ -0,0 +1,123 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrWrongChain 节点的 chain_id 与配置的网络不一致
+var ErrWrongChain = errors.New("wrong chain id")
+
+// NodeStatus status 接口返回的节点信息
+type NodeStatus struct {
+	ChainID string
+	Version string
+	Build   string
+	//节点当前的协议版本和支持的最新版本
+	ProtocolVersion       uint32
+	LatestProtocolVersion uint32
+	//是否正在同步
+	Syncing           bool
+	LatestBlockHeight uint64
+	LatestBlockHash   string
+	LatestBlockTime   time.Time
+}
+
+// PeerInfo 已连接的节点
+type PeerInfo struct {
+	ID        string
+	Addr      string
+	AccountID string
+}
+
+// NetworkInfo network_info 接口返回的连接信息
+type NetworkInfo struct {
+	ActivePeers         []*PeerInfo
+	NumActivePeers      uint64
+	PeerMaxCount        uint64
+	SentBytesPerSec     uint64
+	ReceivedBytesPerSec uint64
+}
+
+// GetStatus 查询节点的网络、版本和同步状态
+func (c *Client) GetStatus(ctx context.Context) (*NodeStatus, error) {
+	r, err := c.call(ctx, "status", []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	status := &NodeStatus{
+		ChainID:               r.Get("chain_id").String(),
+		Version:               r.Get("version.version").String(),
+		Build:                 r.Get("version.build").String(),
+		ProtocolVersion:       uint32(r.Get("protocol_version").Uint()),
+		LatestProtocolVersion: uint32(r.Get("latest_protocol_version").Uint()),
+		Syncing:               r.Get("sync_info.syncing").Bool(),
+		LatestBlockHeight:     r.Get("sync_info.latest_block_height").Uint(),
+		LatestBlockHash:       r.Get("sync_info.latest_block_hash").String(),
+	}
+	if t := r.Get("sync_info.latest_block_time").String(); t != "" {
+		status.LatestBlockTime, err = time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latest_block_time: %s", t)
+		}
+	}
+	return status, nil
+}
+
+// GetNetworkInfo 查询节点的连接信息
+func (c *Client) GetNetworkInfo(ctx context.Context) (*NetworkInfo, error) {
+	r, err := c.call(ctx, "network_info", []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &NetworkInfo{
+		ActivePeers:         make([]*PeerInfo, 0),
+		NumActivePeers:      r.Get("num_active_peers").Uint(),
+		PeerMaxCount:        r.Get("peer_max_count").Uint(),
+		SentBytesPerSec:     r.Get("sent_bytes_per_sec").Uint(),
+		ReceivedBytesPerSec: r.Get("received_bytes_per_sec").Uint(),
+	}
+	for _, peer := range r.Get("active_peers").Array() {
+		info.ActivePeers = append(info.ActivePeers, &PeerInfo{
+			ID:        peer.Get("id").String(),
+			Addr:      peer.Get("addr").String(),
+			AccountID: peer.Get("account_id").String(),
+		})
+	}
+	return info, nil
+}
+
+// CheckNode 确认节点已同步且 chain_id 与配置的网络一致，扫块和创建、签名交易前调用，
+// 避免把测试网节点当作主网使用
+func (wm *WalletManager) CheckNode() error {
+	status, err := wm.Client.GetStatus(context.Background())
+	if err != nil {
+		return fmt.Errorf("get node status failed: %v", err)
+	}
+	if status.ChainID != wm.Config.ChainID {
+		return fmt.Errorf("%w: node is on %s, expected %s", ErrWrongChain, status.ChainID, wm.Config.ChainID)
+	}
+	if status.Syncing {
+		return fmt.Errorf("%w: node is syncing at block %d", ErrNotSynced, status.LatestBlockHeight)
+	}
+	return nil
+}
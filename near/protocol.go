@@ -0,0 +1,147 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/blocktree/near-adapter/nearTransaction"
+	"github.com/blocktree/openwallet/v2/log"
+)
+
+// 默认检查epoch是否切换的间隔
+const DefaultEpochCheckInterval = time.Minute
+
+// epochCache 当前epoch的gas价格和协议配置，epoch切换后重新获取
+type epochCache struct {
+	mu       sync.Mutex
+	epochID  string
+	checked  time.Time
+	gasPrice *big.Int
+	config   *nearTransaction.ProtocolConfig
+}
+
+func (c *Client) getGasPrice() (*big.Int, error) {
+	return c.GetGasPrice(context.Background())
+}
+
+// GetGasPrice 当前epoch的gas价格，单位 yoctoNEAR，每个epoch只查询一次
+func (c *Client) GetGasPrice(ctx context.Context) (*big.Int, error) {
+	gasPrice, _, err := c.epochParams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Set(gasPrice), nil
+}
+
+// GetGasPriceByHeight 指定高度区块的gas价格
+func (c *Client) GetGasPriceByHeight(ctx context.Context, height uint64) (*big.Int, error) {
+	return c.gasPrice(ctx, height)
+}
+
+// GetGasPriceByHash 指定哈希区块的gas价格
+func (c *Client) GetGasPriceByHash(ctx context.Context, hash string) (*big.Int, error) {
+	return c.gasPrice(ctx, hash)
+}
+
+// gasPrice 查询 gas_price，blockID 为 nil 时为最新区块
+func (c *Client) gasPrice(ctx context.Context, blockID interface{}) (*big.Int, error) {
+	r, err := c.call(ctx, "gas_price", []interface{}{blockID})
+	if err != nil {
+		return nil, err
+	}
+
+	gasPrice, ok := new(big.Int).SetString(r.Get("gas_price").String(), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid gas_price: %s", r.Get("gas_price").String())
+	}
+	return gasPrice, nil
+}
+
+// GetProtocolConfig 当前epoch的协议配置，包括存储单价和交易费用，每个epoch只查询一次
+func (c *Client) GetProtocolConfig(ctx context.Context) (*nearTransaction.ProtocolConfig, error) {
+	_, config, err := c.epochParams(ctx)
+	return config, err
+}
+
+// protocolConfig 查询 EXPERIMENTAL_protocol_config
+func (c *Client) protocolConfig(ctx context.Context) (*nearTransaction.ProtocolConfig, error) {
+	request := map[string]interface{}{
+		"finality": "final",
+	}
+
+	r, err := c.CallContext(ctx, "EXPERIMENTAL_protocol_config", request)
+	if err != nil {
+		return nil, err
+	}
+	return nearTransaction.ParseProtocolConfig([]byte(r.Raw))
+}
+
+// epochParams 返回缓存的gas价格和协议配置，每隔 EpochCheckInterval 查询最新确认区块的epoch_id，
+// 切换时重新获取，查询失败时继续使用旧的缓存
+func (c *Client) epochParams(ctx context.Context) (*big.Int, *nearTransaction.ProtocolConfig, error) {
+	cache := &c.epoch
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.config != nil && time.Since(cache.checked) < c.EpochCheckInterval {
+		return cache.gasPrice, cache.config, nil
+	}
+
+	gasPrice, config, epochID, err := c.fetchEpochParams(ctx, cache.epochID)
+	if err != nil {
+		if cache.config != nil {
+			log.Std.Warning("refresh epoch params failed: %v, use the cached values", err)
+			return cache.gasPrice, cache.config, nil
+		}
+		return nil, nil, err
+	}
+	if config != nil {
+		cache.gasPrice, cache.config = gasPrice, config
+	}
+	cache.epochID = epochID
+	cache.checked = time.Now()
+	return cache.gasPrice, cache.config, nil
+}
+
+// fetchEpochParams epoch 未切换时返回 nil，旧版本节点没有 epoch_id 时每次都重新获取
+func (c *Client) fetchEpochParams(ctx context.Context, cachedEpochID string) (*big.Int, *nearTransaction.ProtocolConfig, string, error) {
+	request := map[string]interface{}{
+		"finality": "final",
+	}
+	block, err := c.CallContext(ctx, "block", request)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	epochID := block.Get("header.epoch_id").String()
+	if epochID != "" && epochID == cachedEpochID {
+		return nil, nil, epochID, nil
+	}
+
+	gasPrice, err := c.gasPrice(ctx, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	config, err := c.protocolConfig(ctx)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return gasPrice, config, epochID, nil
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	//默认单次请求超时
+	DefaultTimeout = 30 * time.Second
+	//默认最大重试次数
+	DefaultMaxRetries = 3
+	//默认重试退避的初始间隔和最大间隔
+	DefaultRetryBaseDelay = 200 * time.Millisecond
+	DefaultRetryMaxDelay  = 5 * time.Second
+)
+
+// ErrRateLimited 节点返回 429
+var ErrRateLimited = errors.New("rate limited")
+
+// broadcastMethods 非幂等的广播接口，重复发送可能导致重复上链
+var broadcastMethods = map[string]bool{
+	"broadcast_tx_commit": true,
+	"broadcast_tx_async":  true,
+	"send_tx":             true,
+}
+
+// HTTPError 节点返回的非json-rpc响应，如 429、5xx 或网关错误页
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	//429 时节点要求的等待时间，0为未指定
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("node %s responded with http status %d", e.URL, e.StatusCode)
+}
+
+// Is 429 可用 errors.Is(err, ErrRateLimited) 判断
+func (e *HTTPError) Is(target error) bool {
+	return target == ErrRateLimited && e.StatusCode == http.StatusTooManyRequests
+}
+
+// newHTTPError 响应不是有效的json-rpc内容时返回错误，json-rpc的error由 isError 处理
+func newHTTPError(url string, resp *http.Response, body []byte) *HTTPError {
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+
+	if statusCode == http.StatusTooManyRequests {
+		e := &HTTPError{URL: url, StatusCode: statusCode}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			e.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return e
+	}
+
+	if !json.Valid(body) || (statusCode >= 500 && len(body) == 0) {
+		return &HTTPError{URL: url, StatusCode: statusCode}
+	}
+	return nil
+}
+
+// isRetryable 临时性的错误，稍后或换一个节点可能成功
+func isRetryable(err error) bool {
+	//调用方取消或超时，不再重试
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		//网络错误、HTTP错误或返回内容无法解析
+		return true
+	}
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrNotSynced) || errors.Is(err, ErrInternal) ||
+		errors.Is(err, ErrGarbageCollected) || errors.Is(err, ErrUnavailableShard)
+}
+
+// notSent 请求确定没有到达节点
+func notSent(err error) bool {
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// shouldRetry 广播交易可能已被节点接收，只在确定未发出时重试，避免重复广播
+func (c *Client) shouldRetry(path string, err error) bool {
+	if broadcastMethods[path] {
+		return notSent(err)
+	}
+	return isRetryable(err)
+}
+
+// backoff 第 attempt 次重试前的等待时间，指数增长并加入抖动，429 时不少于 Retry-After
+func (c *Client) backoff(attempt int, err error) time.Duration {
+	delay := c.RetryBaseDelay
+	for i := 0; i < attempt && (c.RetryMaxDelay <= 0 || delay < c.RetryMaxDelay); i++ {
+		delay *= 2
+	}
+	if c.RetryMaxDelay > 0 && delay > c.RetryMaxDelay {
+		delay = c.RetryMaxDelay
+	}
+	if delay > 0 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > delay {
+		delay = httpErr.RetryAfter
+	}
+	return delay
+}
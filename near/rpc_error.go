@@ -0,0 +1,187 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// 节点错误分类，配合 errors.Is 使用
+var (
+	ErrUnknownBlock       = errors.New("unknown block")
+	ErrUnknownChunk       = errors.New("unknown chunk")
+	ErrUnknownEpoch       = errors.New("unknown epoch")
+	ErrUnknownAccount     = errors.New("unknown account")
+	ErrUnknownAccessKey   = errors.New("unknown access key")
+	ErrUnknownTransaction = errors.New("unknown transaction")
+	ErrInvalidTransaction = errors.New("invalid transaction")
+	ErrTimeout            = errors.New("timeout")
+	ErrGarbageCollected   = errors.New("garbage collected block")
+	ErrNotSynced          = errors.New("node not synced")
+	ErrUnavailableShard   = errors.New("unavailable shard")
+	ErrContractExecution  = errors.New("contract execution error")
+	ErrTooLargeState      = errors.New("too large contract state")
+	ErrRequestValidation  = errors.New("request validation error")
+	ErrInternal           = errors.New("internal error")
+)
+
+// causeErrors cause.name 对应的错误分类
+var causeErrors = map[string]error{
+	"UNKNOWN_BLOCK":            ErrUnknownBlock,
+	"UNKNOWN_CHUNK":            ErrUnknownChunk,
+	"INVALID_SHARD_ID":         ErrUnknownChunk,
+	"UNKNOWN_EPOCH":            ErrUnknownEpoch,
+	"UNKNOWN_ACCOUNT":          ErrUnknownAccount,
+	"UNKNOWN_ACCESS_KEY":       ErrUnknownAccessKey,
+	"UNKNOWN_TRANSACTION":      ErrUnknownTransaction,
+	"INVALID_TRANSACTION":      ErrInvalidTransaction,
+	"TIMEOUT_ERROR":            ErrTimeout,
+	"GARBAGE_COLLECTED_BLOCK":  ErrGarbageCollected,
+	"NO_SYNCED_BLOCKS":         ErrNotSynced,
+	"NOT_SYNCED_YET":           ErrNotSynced,
+	"UNAVAILABLE_SHARD":        ErrUnavailableShard,
+	"NO_CONTRACT_CODE":         ErrContractExecution,
+	"CONTRACT_EXECUTION_ERROR": ErrContractExecution,
+	"TOO_LARGE_CONTRACT_STATE": ErrTooLargeState,
+	"PARSE_ERROR":              ErrRequestValidation,
+	"INTERNAL_ERROR":           ErrInternal,
+}
+
+// RPCError 节点返回的结构化错误，可用 errors.As 取出，errors.Is 判断分类
+//
+//	{"code":-32000,"message":"Server error","name":"HANDLER_ERROR",
+//	 "cause":{"name":"UNKNOWN_BLOCK","info":{}},"data":"DB Not Found Error: BLOCK HEIGHT: 1"}
+type RPCError struct {
+	Code    int64
+	Message string
+	//HANDLER_ERROR, REQUEST_VALIDATION_ERROR 或 INTERNAL_ERROR
+	Name string
+	//具体原因，如 UNKNOWN_BLOCK，旧版本节点为空
+	CauseName string
+	//cause.info 的原始json
+	CauseInfo string
+	//data 的原始内容，字符串或json
+	Data string
+	//INVALID_TRANSACTION 的 InvalidTxError 类型，如 InvalidNonce、NotEnoughBalance、Expired
+	TxErrorKind string
+
+	kind error
+	raw  string
+}
+
+// Error 保持 "[code]json" 的格式
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("[%d]%s", e.Code, e.raw)
+}
+
+// Is 判断错误分类，如 errors.Is(err, ErrUnknownBlock)
+func (e *RPCError) Is(target error) bool {
+	return e.kind != nil && e.kind == target
+}
+
+// Kind 返回错误分类，无法识别时为nil
+func (e *RPCError) Kind() error {
+	return e.kind
+}
+
+// newRPCError 解析json-rpc的error对象
+func newRPCError(errObj gjson.Result) *RPCError {
+	e := &RPCError{
+		Code:      errObj.Get("code").Int(),
+		Message:   errObj.Get("message").String(),
+		Name:      errObj.Get("name").String(),
+		CauseName: errObj.Get("cause.name").String(),
+		CauseInfo: errObj.Get("cause.info").Raw,
+		raw:       errObj.String(),
+	}
+
+	data := errObj.Get("data")
+	if data.Type == gjson.String {
+		e.Data = data.String()
+	} else {
+		e.Data = data.Raw
+	}
+
+	e.kind = causeErrors[e.CauseName]
+	if e.kind == nil {
+		//旧版本节点只在data中返回错误描述
+		e.kind = classifyErrorMessage(e.Data)
+	}
+	if e.kind == nil && e.Name == "REQUEST_VALIDATION_ERROR" {
+		e.kind = ErrRequestValidation
+	}
+
+	if e.kind == ErrInvalidTransaction || data.Get("TxExecutionError").Exists() {
+		e.kind = ErrInvalidTransaction
+		e.TxErrorKind = invalidTxErrorKind(errObj)
+	}
+	return e
+}
+
+// newQueryError 旧版本节点的query在result.error中返回错误字符串
+func newQueryError(message string) *RPCError {
+	return &RPCError{
+		Message: message,
+		Data:    message,
+		kind:    classifyErrorMessage(message),
+		raw:     message,
+	}
+}
+
+// classifyErrorMessage 根据旧版本节点的错误描述分类
+func classifyErrorMessage(message string) error {
+	switch {
+	case message == "":
+		return nil
+	case strings.Contains(message, "DB Not Found Error: BLOCK"):
+		return ErrUnknownBlock
+	case strings.Contains(message, "access key") && strings.Contains(message, "does not exist"):
+		return ErrUnknownAccessKey
+	case strings.Contains(message, "does not exist while viewing"):
+		return ErrUnknownAccount
+	case strings.Contains(message, "Timeout"):
+		return ErrTimeout
+	case strings.Contains(message, "is too large to be viewed"):
+		return ErrTooLargeState
+	case strings.Contains(message, "wasm execution failed"), strings.Contains(message, "CodeDoesNotExist"):
+		return ErrContractExecution
+	}
+	return nil
+}
+
+// invalidTxErrorKind 取出 TxExecutionError.InvalidTxError 的类型
+func invalidTxErrorKind(errObj gjson.Result) string {
+	for _, path := range []string{"cause.info", "data"} {
+		invalidTx := errObj.Get(path).Get("TxExecutionError.InvalidTxError")
+		if !invalidTx.Exists() {
+			continue
+		}
+		if invalidTx.Type == gjson.String {
+			return invalidTx.String()
+		}
+		kind := ""
+		invalidTx.ForEach(func(key, value gjson.Result) bool {
+			kind = key.String()
+			return false
+		})
+		return kind
+	}
+	return ""
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// StateItem 合约状态的一个key
+type StateItem struct {
+	Key   []byte
+	Value []byte
+}
+
+// StateResult view_state 的结果，key 按字节序排列
+type StateResult struct {
+	Items       []*StateItem
+	BlockHeight uint64
+	BlockHash   string
+}
+
+// ViewState 查询合约状态中以prefix开头的key，prefix 为空时为全部状态，
+// 超过节点的大小限制时返回 ErrTooLargeState，需要用 ViewStatePages 分页读取
+func (c *Client) ViewState(ctx context.Context, contractID string, prefix []byte, blockRef BlockRef) (*StateResult, error) {
+	request := map[string]interface{}{
+		"request_type":  "view_state",
+		"account_id":    contractID,
+		"prefix_base64": base64.StdEncoding.EncodeToString(prefix),
+	}
+	blockRef.apply(request)
+
+	r, err := c.CallContext(ctx, "query", request)
+	if err == nil && r.Get("error").String() != "" {
+		//旧版本节点在result中返回错误
+		err = newQueryError(r.Get("error").String())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*StateItem, 0)
+	for _, item := range r.Get("values").Array() {
+		key, err := base64.StdEncoding.DecodeString(item.Get("key").String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid state key of %s: %v", contractID, err)
+		}
+		value, err := base64.StdEncoding.DecodeString(item.Get("value").String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid state value of %s: %v", contractID, err)
+		}
+		items = append(items, &StateItem{Key: key, Value: value})
+	}
+
+	return &StateResult{
+		Items:       items,
+		BlockHeight: r.Get("block_height").Uint(),
+		BlockHash:   r.Get("block_hash").String(),
+	}, nil
+}
+
+// DefaultMaxStateRequests ViewStatePages 单次读取最多发出的 view_state 请求数
+const DefaultMaxStateRequests = 4096
+
+// maxStateSplitDepth ViewStatePages 最多拆分的层数，
+// 节点按账户的存储用量而不是结果大小限制时，拆分前缀不会成功
+const maxStateSplitDepth = 32
+
+// StateReadError ViewStatePages 无法确认读取完整的状态
+type StateReadError struct {
+	ContractID string
+	//值超过节点大小限制、无法读取的key
+	Keys [][]byte
+	//因状态过大被拆分的前缀，view_state 不能单独读取与前缀完全相同的key，无法确认其是否存在，
+	//near-sdk 集合的key都长于集合前缀，且Borsh编码的key互不为前缀，只有 Prefixes 时可以确认完整
+	Prefixes [][]byte
+}
+
+func (e *StateReadError) Error() string {
+	msg := fmt.Sprintf("state of %s is incomplete", e.ContractID)
+	if len(e.Keys) > 0 {
+		msg += fmt.Sprintf(", keys %x exceed the node limit", e.Keys)
+	}
+	if len(e.Prefixes) > 0 {
+		msg += fmt.Sprintf(", keys equal to the split prefixes %x cannot be verified", e.Prefixes)
+	}
+	return msg
+}
+
+func (e *StateReadError) Unwrap() error {
+	return ErrTooLargeState
+}
+
+// ViewStatePages 分页读取合约状态，状态过大时按下一个字节拆分前缀，所有页都读取同一个区块，
+// fn 按key的字节序依次收到每一页，返回错误时停止。
+// 拆分过前缀时，其余页都读完后返回 *StateReadError，列出无法读取的key和无法确认的前缀；
+// 请求数超过 MaxStateRequests 或拆分层数过多时立即返回 ErrTooLargeState
+func (c *Client) ViewStatePages(ctx context.Context, contractID string, prefix []byte, blockRef BlockRef, fn func(page *StateResult) error) error {
+	p := &statePager{client: c, contractID: contractID, blockRef: blockRef, fn: fn}
+	if _, err := p.read(ctx, prefix, 0); err != nil {
+		return err
+	}
+	if len(p.keys) > 0 || len(p.prefixes) > 0 {
+		return &StateReadError{ContractID: contractID, Keys: p.keys, Prefixes: p.prefixes}
+	}
+	return nil
+}
+
+type statePager struct {
+	client     *Client
+	contractID string
+	blockRef   BlockRef
+	fn         func(page *StateResult) error
+	requests   int
+	keys       [][]byte
+	prefixes   [][]byte
+}
+
+// read 读取以prefix开头的状态，返回是否存在这样的key
+func (p *statePager) read(ctx context.Context, prefix []byte, depth int) (bool, error) {
+	if p.client.MaxStateRequests > 0 && p.requests >= p.client.MaxStateRequests {
+		return false, fmt.Errorf("%w: reading state of %s needs more than %d requests", ErrTooLargeState, p.contractID, p.client.MaxStateRequests)
+	}
+	p.requests++
+
+	page, err := p.client.ViewState(ctx, p.contractID, prefix, p.blockRef)
+	if err == nil {
+		return len(page.Items) > 0, p.fn(page)
+	}
+	if !errors.Is(err, ErrTooLargeState) {
+		return false, err
+	}
+	if depth >= maxStateSplitDepth {
+		return false, fmt.Errorf("%w: state of %s under prefix %x is still too large after %d splits", ErrTooLargeState, p.contractID, prefix, depth)
+	}
+
+	if p.blockRef.BlockID == nil {
+		//固定到第一次查询的区块，节点的错误信息中带有区块哈希
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) {
+			p.blockRef = BlockWithHash(gjson.Get(rpcErr.CauseInfo, "block_hash").String())
+		}
+		if p.blockRef.BlockID == nil || p.blockRef.BlockID == "" {
+			hash, _, err := p.client.GetRecentBlockHeader(ctx)
+			if err != nil {
+				return false, err
+			}
+			p.blockRef = BlockWithHash(hash)
+		}
+	}
+
+	found := false
+	for b := 0; b < 256; b++ {
+		next := append(append(make([]byte, 0, len(prefix)+1), prefix...), byte(b))
+		ok, err := p.read(ctx, next, depth+1)
+		if err != nil {
+			return false, err
+		}
+		found = found || ok
+	}
+
+	key := append([]byte{}, prefix...)
+	if found {
+		p.prefixes = append(p.prefixes, key)
+	} else {
+		//更长的key都不存在，过大的只能是与前缀相同的key
+		p.keys = append(p.keys, key)
+	}
+	return true, nil
+}
+
+// StateDecoder 解码合约状态的key或value，*borsh.Schema 可直接使用
+type StateDecoder interface {
+	Decode(data []byte) (interface{}, error)
+}
+
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// JSONDecoder 以json解码，用于以json序列化状态的合约
+var JSONDecoder StateDecoder = jsonDecoder{}
+
+// DecodedStateItem 解码后的状态
+type DecodedStateItem struct {
+	Key   interface{}
+	Value interface{}
+	Raw   *StateItem
+}
+
+// DecodeState 解码以prefix开头的状态，key 去掉prefix后解码，如 near-sdk LookupMap 的key为前缀加Borsh编码的key，
+// 不以prefix开头的key跳过，decoder 为nil时保留原始字节
+func DecodeState(items []*StateItem, prefix []byte, keyDecoder, valueDecoder StateDecoder) ([]*DecodedStateItem, error) {
+	decoded := make([]*DecodedStateItem, 0, len(items))
+	for _, item := range items {
+		if !bytes.HasPrefix(item.Key, prefix) {
+			continue
+		}
+
+		d := &DecodedStateItem{Key: item.Key[len(prefix):], Value: item.Value, Raw: item}
+		if keyDecoder != nil {
+			key, err := keyDecoder.Decode(item.Key[len(prefix):])
+			if err != nil {
+				return nil, fmt.Errorf("decode state key %x failed: %v", item.Key, err)
+			}
+			d.Key = key
+		}
+		if valueDecoder != nil {
+			value, err := valueDecoder.Decode(item.Value)
+			if err != nil {
+				return nil, fmt.Errorf("decode state value of %x failed: %v", item.Key, err)
+			}
+			d.Value = value
+		}
+		decoded = append(decoded, d)
+	}
+	return decoded, nil
+}
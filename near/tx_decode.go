@@ -16,6 +16,7 @@
 package near
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -23,7 +24,6 @@ import (
 	"github.com/blocktree/openwallet/v2/log"
 	"math/big"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -31,6 +31,9 @@ import (
 	"github.com/blocktree/openwallet/v2/openwallet"
 )
 
+// implicitFeeReceiver 估算费率用的隐式账户，转到隐式账户需要额外支付创建账户和添加key的费用
+var implicitFeeReceiver = strings.Repeat("0", 64)
+
 type TransactionDecoder struct {
 	openwallet.TransactionDecoderBase
 	wm *WalletManager //钱包管理者
@@ -67,17 +70,31 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 		return nil, fmt.Errorf("transaction is not completed validation")
 	}
 
+	signed, err := nearTransaction.ParseSignedTransaction(rawTx.RawHex)
+	if err != nil {
+		return nil, fmt.Errorf("transaction decode failed, unexpected error: %v", err)
+	}
+
+	//交易已过期则不再广播，无法确认当前高度时也不广播
+	if signed.ExpiryHeight > 0 {
+		height, err := decoder.wm.Client.GetBlockHeight(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("can not check the expiry of the transaction: %v", err)
+		}
+		if height > signed.ExpiryHeight {
+			return nil, fmt.Errorf("transaction expired at block %d, current block %d", signed.ExpiryHeight, height)
+		}
+	}
+
 	txid, err := decoder.wm.SendRawTransaction(rawTx.RawHex)
-	fmt.Println("[near-debug] : " + txid + rawTx.RawHex)
 	if err != nil {
-		fmt.Println("Tx to send: ", rawTx.RawHex)
+		decoder.wm.Log.Std.Error("broadcast transaction failed: %v, raw transaction: %s", err, rawTx.RawHex)
 		return nil, err
-	} else {
-		addr_nonce := strings.Split(rawTx.RawHex, ":")[1]
-		data := strings.Split(addr_nonce, "@")
-		nonce, _  := strconv.Atoi(data[1])
-		wrapper.SetAddressExtParam(data[0], decoder.wm.FullName(), nonce + 1)
 	}
+	decoder.wm.Log.Std.Info("transaction %s broadcast", txid)
+	wrapper.SetAddressExtParam(signed.SignerID, decoder.wm.FullName(), signed.Nonce+1)
+
+	//广播成功即返回，交易状态由 CheckTransaction 或 WaitTransaction 另行确认
 
 	rawTx.TxID = txid
 	rawTx.IsSubmit = true
@@ -102,6 +119,9 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 }
 
 func (decoder *TransactionDecoder) CreateMRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	if err := decoder.wm.CheckNode(); err != nil {
+		return err
+	}
 
 	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID)
 
@@ -120,7 +140,7 @@ func (decoder *TransactionDecoder) CreateMRawTransaction(wrapper openwallet.Wall
 			balance *AddrBalance
 		)
 
-		balance, err = decoder.wm.Client.getBalance(addr.Address)
+		balance, err = decoder.wm.Client.GetBalance(context.Background(), addr.Address)
 
 		if err != nil {
 			return err
@@ -134,8 +154,6 @@ func (decoder *TransactionDecoder) CreateMRawTransaction(wrapper openwallet.Wall
 		return addressesBalanceList[i].Balance.Cmp(addressesBalanceList[j].Balance) >= 0
 	})
 
-	fee := decoder.wm.Config.TransferFee
-
 	var amountStr, to string
 	for k, v := range rawTx.To {
 		to = k
@@ -143,8 +161,17 @@ func (decoder *TransactionDecoder) CreateMRawTransaction(wrapper openwallet.Wall
 		break
 	}
 
-	amount := convertFromAmount(amountStr)
+	transferAmount, err := convertFromAmount(amountStr)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid amount %s: %v", amountStr, err)
+	}
+
+	fee, err := decoder.wm.EstimateTransferFee("", to)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "estimate transfer fee failed: %v", err)
+	}
 
+	amount := transferAmount.BigInt()
 	amount = amount.Add(amount, fee)
 
 	from := ""
@@ -180,8 +207,9 @@ func (decoder *TransactionDecoder) CreateMRawTransaction(wrapper openwallet.Wall
 	rawTx.FeeRate = convertToAmount(fee)
 
 	var (
-		nonce    uint64
-		blockHash string
+		nonce       uint64
+		blockHash   string
+		blockHeight uint64
 	)
 
 	nonce_db, err := wrapper.GetAddressExtParam(from, decoder.wm.FullName())
@@ -193,7 +221,7 @@ func (decoder *TransactionDecoder) CreateMRawTransaction(wrapper openwallet.Wall
 	} else {
 		nonce = ow.NewString(nonce_db).UInt64()
 	}
-	nonceChain, err := decoder.wm.Client.getNonce(from)
+	nonceChain, err := decoder.wm.Client.GetNonce(context.Background(), from)
 	if err != nil {
 		return errors.New("failed to get nonce when create transaction")
 	}
@@ -202,12 +230,13 @@ func (decoder *TransactionDecoder) CreateMRawTransaction(wrapper openwallet.Wall
 		nonce = nonceChain
 	}
 	nonce = nonce + 1
-	blockHash, err = decoder.wm.Client.getRecentBlockHash()
+	blockHash, blockHeight, err = decoder.wm.Client.GetRecentBlockHeader(context.Background())
 	if err != nil {
 		return errors.New("failed to get recent block hash when create transaction")
 	}
 
-	transfer := nearTransaction.NewTransfer(from, fromPub, nonce, to, blockHash, convertFromAmount(amountStr))
+	transfer := nearTransaction.NewTransfer(from, fromPub, nonce, to, blockHash, transferAmount)
+	transfer.ExpiryHeight = blockHeight + nearTransaction.TransactionValidityPeriod
 
 	emptyTrans, hash, err := transfer.CreateEmptyTransactionAndHash()
 	if err != nil {
@@ -244,6 +273,9 @@ func (decoder *TransactionDecoder) CreateMRawTransaction(wrapper openwallet.Wall
 }
 
 func (decoder *TransactionDecoder) SignMRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	if err := decoder.wm.CheckNode(); err != nil {
+		return err
+	}
 	key, err := wrapper.HDKey()
 	if err != nil {
 		return nil
@@ -251,9 +283,23 @@ func (decoder *TransactionDecoder) SignMRawTransaction(wrapper openwallet.Wallet
 
 	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
 
+	//解析交易单，确认签名的哈希与交易内容一致
+	ts, err := nearTransaction.DecodeUnsignedTransaction(rawTx.RawHex)
+	if err != nil {
+		return fmt.Errorf("transaction decode failed, unexpected error: %v", err)
+	}
+	txHash, err := ts.Hash()
+	if err != nil {
+		return fmt.Errorf("transaction decode failed, unexpected error: %v", err)
+	}
+
 	if keySignatures != nil {
 		for _, keySignature := range keySignatures {
 
+			if txHash != strings.ToLower(keySignature.Message) {
+				return fmt.Errorf("transaction hash does not match the raw transaction")
+			}
+
 			childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
 			keyBytes, err := childKey.GetPrivateKeyBytes()
 			if err != nil {
@@ -262,7 +308,12 @@ func (decoder *TransactionDecoder) SignMRawTransaction(wrapper openwallet.Wallet
 
 			//签名交易
 			///////交易单哈希签名
-			signature, err := nearTransaction.SignTransaction(keySignature.Message, keyBytes)
+			keyType, err := nearTransaction.KeyTypeByCurve(keySignature.EccType)
+			if err != nil {
+				return err
+			}
+
+			signature, err := nearTransaction.SignTransactionWithKeyType(keySignature.Message, keyBytes, keyType)
 			if err != nil {
 				return fmt.Errorf("transaction hash sign failed, unexpected error: %v", err)
 			} else {
@@ -323,8 +374,13 @@ func (decoder *TransactionDecoder) VerifyMRawTransaction(wrapper openwallet.Wall
 	return nil
 }
 
+//GetRawTransactionFeeRate 每笔转账的费用，按转到隐式账户估算
 func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, unit string, err error) {
-	return convertToAmount(decoder.wm.Config.TransferFee), "TX", nil
+	fee, err := decoder.wm.EstimateTransferFee("", implicitFeeReceiver)
+	if err != nil {
+		return "", "", err
+	}
+	return convertToAmount(fee), "TX", nil
 }
 
 //CreateSummaryRawTransaction 创建汇总交易，返回原始交易单数组
@@ -339,12 +395,31 @@ func (decoder *TransactionDecoder) CreateSummaryRawTransaction(wrapper openwalle
 func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransaction, error) {
 
 	var (
-		rawTxArray      = make([]*openwallet.RawTransaction, 0)
-		accountID       = sumRawTx.Account.AccountID
-		minTransfer     = convertFromAmount(sumRawTx.MinTransfer)
-		retainedBalance = convertFromAmount(sumRawTx.RetainedBalance)
+		rawTxArray = make([]*openwallet.RawTransaction, 0)
+		accountID  = sumRawTx.Account.AccountID
 	)
 
+	if err := decoder.wm.CheckNode(); err != nil {
+		return nil, err
+	}
+
+	minTransfer, err := convertFromAmount(sumRawTx.MinTransfer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mini transfer amount %s: %v", sumRawTx.MinTransfer, err)
+	}
+	retainedBalance, err := convertFromAmount(sumRawTx.RetainedBalance)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retained balance %s: %v", sumRawTx.RetainedBalance, err)
+	}
+	feeBI, err := decoder.wm.EstimateTransferFee("", sumRawTx.SummaryAddress)
+	if err != nil {
+		return nil, fmt.Errorf("estimate transfer fee failed: %v", err)
+	}
+	fee, err := nearTransaction.NewYoctoAmount(feeBI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transfer fee: %v", err)
+	}
+
 	if minTransfer.Cmp(retainedBalance) < 0 {
 		return nil, fmt.Errorf("mini transfer amount must be greater than address retained balance")
 	}
@@ -373,28 +448,26 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 	for _, addrBalance := range addrBalanceArray {
 
 		//检查余额是否超过最低转账
-		addrBalance_BI := convertFromAmount(addrBalance.Balance)
+		addrBalance_BI, err := convertFromAmount(addrBalance.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("invalid balance %s of %s: %v", addrBalance.Balance, addrBalance.Address, err)
+		}
 
 		if addrBalance_BI.Cmp(minTransfer) < 0 {
 			continue
 		}
-		//计算汇总数量 = 余额 - 保留余额
-		sumAmount_BI := new(big.Int)
-		sumAmount_BI.Sub(addrBalance_BI, retainedBalance)
-
-		//this.wm.Log.Debug("sumAmount:", sumAmount)
-		//计算手续费
-
-		fee := decoder.wm.Config.TransferFee
-
-		//减去手续费
-		sumAmount_BI.Sub(sumAmount_BI, fee)
-		if sumAmount_BI.Cmp(big.NewInt(0)) <= 0 {
+		//计算汇总数量 = 余额 - 保留余额 - 手续费，不足时跳过
+		sumAmount_BI, err := addrBalance_BI.Sub(retainedBalance)
+		if err != nil {
+			continue
+		}
+		sumAmount_BI, err = sumAmount_BI.Sub(fee)
+		if err != nil || sumAmount_BI.IsZero() {
 			continue
 		}
 
-		sumAmount := convertToAmount(sumAmount_BI)
-		fees := convertToAmount(fee)
+		sumAmount := sumAmount_BI.String()
+		fees := fee.String()
 
 		log.Debugf("balance: %v", addrBalance.Balance)
 		log.Debugf("fees: %v", fees)
@@ -427,8 +500,6 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 
 func (decoder *TransactionDecoder) createRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, addrBalance *openwallet.Balance) error {
 
-	fee := decoder.wm.Config.TransferFee
-
 	var amountStr, to string
 	for k, v := range rawTx.To {
 		to = k
@@ -436,10 +507,18 @@ func (decoder *TransactionDecoder) createRawTransaction(wrapper openwallet.Walle
 		break
 	}
 
-	amount := convertFromAmount(amountStr)
+	amount, err := convertFromAmount(amountStr)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid amount %s: %v", amountStr, err)
+	}
 	//amount = amount.Add(amount, fee)
 	from := addrBalance.Address
 
+	fee, err := decoder.wm.EstimateTransferFee(from, to)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "estimate transfer fee failed: %v", err)
+	}
+
 	fromAddr, err := wrapper.GetAddress(from)
 	if err != nil {
 		return err
@@ -452,24 +531,26 @@ func (decoder *TransactionDecoder) createRawTransaction(wrapper openwallet.Walle
 	rawTx.FeeRate = convertToAmount(fee)
 
 	var (
-		nonce      uint64
-		currentHash string
+		nonce         uint64
+		currentHash   string
+		currentHeight uint64
 	)
 
-	nonce, err = decoder.wm.Client.getNonce(from)
+	nonce, err = decoder.wm.Client.GetNonce(context.Background(), from)
 
 	if err != nil {
 		return errors.New("Failed to get sequence when create summay transaction!")
 	}
 
 
-	currentHash, err = decoder.wm.Client.getRecentBlockHash()
+	currentHash, currentHeight, err = decoder.wm.Client.GetRecentBlockHeader(context.Background())
 
 	if err != nil {
 		return errors.New("Failed to get block height when create summay transaction!")
 	}
 
 	transfer := nearTransaction.NewTransfer(from, fromAddr.PublicKey, nonce + 1, to, currentHash, amount)
+	transfer.ExpiryHeight = currentHeight + nearTransaction.TransactionValidityPeriod
 
 	emptyTrans, hash, err := transfer.CreateEmptyTransactionAndHash()
 	if err != nil {
@@ -0,0 +1,271 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// wait_until 等级，见 https://docs.near.org/api/rpc/transactions
+const (
+	WaitUntilNone               = "NONE"
+	WaitUntilIncluded           = "INCLUDED"
+	WaitUntilExecutedOptimistic = "EXECUTED_OPTIMISTIC"
+	WaitUntilIncludedFinal      = "INCLUDED_FINAL"
+	WaitUntilExecuted           = "EXECUTED"
+	WaitUntilFinal              = "FINAL"
+)
+
+// 默认交易状态轮询间隔
+const DefaultTxPollInterval = time.Second
+
+// TxState 交易的执行状态
+type TxState int
+
+const (
+	//节点尚未看到交易
+	TxPending TxState = iota
+	//已打包进区块，未执行完成
+	TxIncluded
+	//已执行，所在区块未最终确认
+	TxExecuted
+	//已执行且所有相关区块已最终确认
+	TxFinal
+	//执行失败
+	TxFailed
+)
+
+func (s TxState) String() string {
+	switch s {
+	case TxPending:
+		return "pending"
+	case TxIncluded:
+		return "included"
+	case TxExecuted:
+		return "executed"
+	case TxFinal:
+		return "final"
+	case TxFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("TxState(%d)", int(s))
+}
+
+// waitUntilStates wait_until 等级要求达到的状态
+var waitUntilStates = map[string]TxState{
+	WaitUntilNone:               TxPending,
+	WaitUntilIncluded:           TxIncluded,
+	WaitUntilIncludedFinal:      TxIncluded,
+	WaitUntilExecutedOptimistic: TxExecuted,
+	WaitUntilExecuted:           TxExecuted,
+	WaitUntilFinal:              TxFinal,
+}
+
+// ParseWaitUntil 检查 wait_until 等级，空字符串为 NONE
+func ParseWaitUntil(waitUntil string) (string, error) {
+	waitUntil = strings.ToUpper(strings.TrimSpace(waitUntil))
+	if waitUntil == "" {
+		return WaitUntilNone, nil
+	}
+	if _, ok := waitUntilStates[waitUntil]; !ok {
+		return "", fmt.Errorf("invalid wait_until: %s", waitUntil)
+	}
+	return waitUntil, nil
+}
+
+// TxOutcome tx / EXPERIMENTAL_tx_status 的查询结果
+type TxOutcome struct {
+	TxID     string
+	SenderID string
+	State    TxState
+	//节点返回的 final_execution_status，旧版本节点为空
+	ExecutionStatus string
+	//执行成功时的返回值，base64
+	SuccessValue string
+	//执行失败的类型，如 AccountDoesNotExist、NotEnoughBalance
+	FailureKind string
+	//status.Failure 的原始json
+	FailureReason string
+	//交易所在区块
+	BlockHash string
+}
+
+// newTxOutcome 解析 tx 接口的结果
+func newTxOutcome(txid, senderID string, result *gjson.Result) *TxOutcome {
+	o := &TxOutcome{
+		TxID:            txid,
+		SenderID:        senderID,
+		ExecutionStatus: result.Get("final_execution_status").String(),
+		BlockHash:       result.Get("transaction_outcome.block_hash").String(),
+	}
+	if hash := result.Get("transaction.hash").String(); hash != "" {
+		o.TxID = hash
+	}
+
+	status := result.Get("status")
+	if failure := status.Get("Failure"); failure.Exists() {
+		o.State = TxFailed
+		o.FailureReason = failure.Raw
+		o.FailureKind = txFailureKind(failure)
+		return o
+	}
+	if value := status.Get("SuccessValue"); value.Exists() {
+		o.SuccessValue = value.String()
+	}
+
+	switch o.ExecutionStatus {
+	case WaitUntilNone:
+		o.State = TxPending
+	case WaitUntilIncluded, WaitUntilIncludedFinal:
+		o.State = TxIncluded
+	case WaitUntilExecutedOptimistic, WaitUntilExecuted:
+		o.State = TxExecuted
+	case WaitUntilFinal:
+		o.State = TxFinal
+	default:
+		//旧版本节点只有 status
+		if status.Get("SuccessValue").Exists() || status.Get("SuccessReceiptId").Exists() {
+			o.State = TxExecuted
+		} else if o.BlockHash != "" {
+			o.State = TxIncluded
+		}
+	}
+	return o
+}
+
+// txFailureKind 取出最内层的错误类型，如 {"ActionError":{"kind":{"AccountDoesNotExist":{}}}} 为 AccountDoesNotExist，
+// 错误类型为大写开头，字段为小写
+func txFailureKind(failure gjson.Result) string {
+	kind := ""
+	for failure.IsObject() {
+		var next gjson.Result
+		failure.ForEach(func(key, value gjson.Result) bool {
+			name := key.String()
+			if name == "kind" || (name != "" && name[0] >= 'A' && name[0] <= 'Z') {
+				if name != "kind" {
+					kind = name
+				}
+				next = value
+				return false
+			}
+			return true
+		})
+		failure = next
+	}
+	if failure.Type == gjson.String {
+		kind = failure.String()
+	}
+	return kind
+}
+
+// Reached 是否已达到 wait_until 要求的状态，失败也视为结束
+func (o *TxOutcome) Reached(waitUntil string) bool {
+	return o.State == TxFailed || o.State >= waitUntilStates[waitUntil]
+}
+
+// Err 执行失败时返回错误
+func (o *TxOutcome) Err() error {
+	if o.State != TxFailed {
+		return nil
+	}
+	return fmt.Errorf("transaction %s failed: %s %s", o.TxID, o.FailureKind, o.FailureReason)
+}
+
+// BroadcastTransactionAsync 通过 broadcast_tx_async 广播交易，立即返回交易哈希
+func (c *Client) BroadcastTransactionAsync(ctx context.Context, rawTx string) (string, error) {
+	resp, err := c.Call2Context(ctx, "broadcast_tx_async", []string{rawTx})
+	if err != nil {
+		return "", err
+	}
+	return resp.String(), nil
+}
+
+// getTxStatus 查询交易状态，senderID 用于节点定位交易所在分片
+func (c *Client) getTxStatus(txid, senderID string) (*TxOutcome, error) {
+	return c.GetTxStatus(context.Background(), txid, senderID, WaitUntilNone)
+}
+
+// GetTxStatus 查询交易状态，waitUntil 为 NONE 时立即返回，其他等级节点等到该状态或超时才返回
+func (c *Client) GetTxStatus(ctx context.Context, txid, senderID, waitUntil string) (*TxOutcome, error) {
+	request := map[string]interface{}{
+		"tx_hash":           txid,
+		"sender_account_id": senderID,
+	}
+	if waitUntil != "" {
+		request["wait_until"] = waitUntil
+	}
+
+	resp, err := c.CallContext(ctx, "EXPERIMENTAL_tx_status", request)
+	if err != nil {
+		return nil, err
+	}
+	return newTxOutcome(txid, senderID, resp), nil
+}
+
+// txFailedOutcome 交易未通过节点校验时返回失败状态，其他错误原样返回
+func txFailedOutcome(txid, senderID string, err error) (*TxOutcome, error) {
+	outcome := &TxOutcome{TxID: txid, SenderID: senderID, State: TxPending}
+	if !errors.Is(err, ErrInvalidTransaction) {
+		return outcome, err
+	}
+	//交易未通过节点校验，不会上链
+	outcome.State = TxFailed
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		outcome.FailureKind = rpcErr.TxErrorKind
+		outcome.FailureReason = rpcErr.Data
+	}
+	return outcome, nil
+}
+
+// waitTransaction 轮询交易状态直到达到 waitUntil、执行失败或 ctx 结束，
+// 每次查询都以 NONE 立即返回，不占用节点的连接
+func waitTransaction(ctx context.Context, c TxBroadcaster, txid, senderID, waitUntil string, interval time.Duration) (*TxOutcome, error) {
+	if interval <= 0 {
+		interval = DefaultTxPollInterval
+	}
+	outcome := &TxOutcome{TxID: txid, SenderID: senderID, State: TxPending}
+	if waitUntil == WaitUntilNone {
+		return outcome, nil
+	}
+
+	for {
+		result, err := c.GetTxStatus(ctx, txid, senderID, WaitUntilNone)
+		switch {
+		case err == nil:
+			outcome = result
+			if outcome.Reached(waitUntil) {
+				return outcome, nil
+			}
+		case errors.Is(err, ErrUnknownTransaction) || errors.Is(err, ErrTimeout):
+			//交易尚未被节点处理
+		default:
+			return txFailedOutcome(txid, senderID, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return outcome, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package near
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/blocktree/near-adapter/borsh"
+)
+
+// BlockRef 查询状态使用的区块，BlockID 为高度(uint64)或哈希(string)，为空时使用 Finality
+type BlockRef struct {
+	Finality string
+	BlockID  interface{}
+}
+
+var (
+	//最新确认区块
+	FinalBlock = BlockRef{Finality: "final"}
+	//最新区块，可能回滚
+	OptimisticBlock = BlockRef{Finality: "optimistic"}
+)
+
+// BlockAtHeight 指定高度的区块
+func BlockAtHeight(height uint64) BlockRef {
+	return BlockRef{BlockID: height}
+}
+
+// BlockWithHash 指定哈希的区块
+func BlockWithHash(hash string) BlockRef {
+	return BlockRef{BlockID: hash}
+}
+
+// apply 把区块参数加入query请求
+func (ref BlockRef) apply(request map[string]interface{}) {
+	switch {
+	case ref.BlockID != nil:
+		request["block_id"] = ref.BlockID
+	case ref.Finality != "":
+		request["finality"] = ref.Finality
+	default:
+		request["finality"] = "final"
+	}
+}
+
+// BorshArgs 已经Borsh编码的合约参数，原样发送
+type BorshArgs []byte
+
+// ViewResult call_function 的结果
+type ViewResult struct {
+	//合约返回的原始字节，NEP-141 等合约为json
+	Result []byte
+	//合约执行时输出的日志
+	Logs        []string
+	BlockHeight uint64
+	BlockHash   string
+}
+
+// JSON 把返回的json解析到v
+func (r *ViewResult) JSON(v interface{}) error {
+	if err := json.Unmarshal(r.Result, v); err != nil {
+		return fmt.Errorf("invalid view result %q: %v", r.Result, err)
+	}
+	return nil
+}
+
+// Borsh 把返回的Borsh编码解析到v，v 的字段按合约中的顺序定义，必须读完全部字节
+func (r *ViewResult) Borsh(v interface{}) error {
+	if err := borsh.Deserialize(r.Result, v); err != nil {
+		return fmt.Errorf("invalid view result %x: %v", r.Result, err)
+	}
+	return nil
+}
+
+// encodeArgs 编码合约参数，BorshArgs 和 []byte 原样发送，nil 为空参数，其他类型编码为json
+func encodeArgs(args interface{}) (string, error) {
+	var data []byte
+	switch v := args.(type) {
+	case nil:
+	case BorshArgs:
+		data = v
+	case []byte:
+		data = v
+	case json.RawMessage:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return "", fmt.Errorf("encode args failed: %v", err)
+		}
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// ViewFunction 调用合约的view方法，args 为 BorshArgs 或可编码为json的参数
+func (c *Client) ViewFunction(ctx context.Context, contractID, method string, args interface{}, blockRef BlockRef) (*ViewResult, error) {
+	argsBase64, err := encodeArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	request := map[string]interface{}{
+		"request_type": "call_function",
+		"account_id":   contractID,
+		"method_name":  method,
+		"args_base64":  argsBase64,
+	}
+	blockRef.apply(request)
+
+	r, err := c.CallContext(ctx, "query", request)
+	if err == nil && r.Get("error").String() != "" {
+		//旧版本节点在result中返回错误
+		err = newQueryError(r.Get("error").String())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := r.Get("result").Array()
+	result := make([]byte, len(items))
+	for i, item := range items {
+		b := item.Uint()
+		if b > 255 {
+			return nil, fmt.Errorf("invalid view result of %s.%s", contractID, method)
+		}
+		result[i] = byte(b)
+	}
+	logs := make([]string, 0)
+	for _, log := range r.Get("logs").Array() {
+		logs = append(logs, log.String())
+	}
+
+	return &ViewResult{
+		Result:      result,
+		Logs:        logs,
+		BlockHeight: r.Get("block_height").Uint(),
+		BlockHash:   r.Get("block_hash").String(),
+	}, nil
+}
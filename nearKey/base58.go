@@ -1,4 +1,4 @@
-package near
+package nearKey
 
 import (
 	"errors"
@@ -146,3 +146,4 @@ func Decode(input string, alphabet *Alphabet) ([]byte, error) {
 	}
 	return retBytes, nil
 }
+
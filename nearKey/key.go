@@ -0,0 +1,247 @@
+package nearKey
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/near-adapter/borsh"
+)
+
+const (
+	KeyTypeED25519   = byte(0)
+	KeyTypeSECP256K1 = byte(1)
+)
+
+// publicKeyLength returns the key length of a key type, secp256k1 keys are stored uncompressed without the 0x04 prefix
+func publicKeyLength(keyType byte) (int, bool) {
+	switch keyType {
+	case KeyTypeED25519:
+		return 32, true
+	case KeyTypeSECP256K1:
+		return 64, true
+	}
+	return 0, false
+}
+
+// secretKeyLength returns the secret key length of a key type, ed25519 secret keys are the seed followed by the public key
+func secretKeyLength(keyType byte) (int, bool) {
+	switch keyType {
+	case KeyTypeED25519:
+		return 64, true
+	case KeyTypeSECP256K1:
+		return 32, true
+	}
+	return 0, false
+}
+
+func keyTypeName(keyType byte) string {
+	switch keyType {
+	case KeyTypeED25519:
+		return "ed25519"
+	case KeyTypeSECP256K1:
+		return "secp256k1"
+	}
+	return ""
+}
+
+func curve(keyType byte) uint32 {
+	if keyType == KeyTypeSECP256K1 {
+		return owcrypt.ECC_CURVE_SECP256K1
+	}
+	return owcrypt.ECC_CURVE_ED25519
+}
+
+// parseKeyString splits "<type>:<base58>" and checks the decoded length
+func parseKeyString(key string, length func(byte) (int, bool)) (byte, []byte, error) {
+	parts := strings.SplitN(key, ":", 2)
+	if len(parts) != 2 {
+		return 0, nil, errors.New("key has no type prefix")
+	}
+
+	var keyType byte
+	switch parts[0] {
+	case "ed25519":
+		keyType = KeyTypeED25519
+	case "secp256k1":
+		keyType = KeyTypeSECP256K1
+	default:
+		return 0, nil, fmt.Errorf("unsupported key type: %s", parts[0])
+	}
+
+	data, err := Decode(parts[1], BitcoinAlphabet)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n, _ := length(keyType); len(data) != n {
+		return 0, nil, fmt.Errorf("invalid %s key length: %d", parts[0], len(data))
+	}
+	return keyType, data, nil
+}
+
+type PublicKey struct {
+	KeyType byte
+	Key     []byte
+}
+
+// NewPublicKey parses a hex public key: 32 bytes for ed25519, 33 (compressed), 64 or 65 (uncompressed) bytes for secp256k1
+func NewPublicKey(key string) (*PublicKey, error) {
+	keyBytes, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, errors.New("invalid public key")
+	}
+
+	switch len(keyBytes) {
+	case 32:
+		return &PublicKey{KeyType: KeyTypeED25519, Key: keyBytes}, nil
+	case 33:
+		uncompressed := owcrypt.PointDecompress(keyBytes, owcrypt.ECC_CURVE_SECP256K1)
+		if len(uncompressed) != 65 {
+			return nil, errors.New("invalid secp256k1 public key")
+		}
+		return &PublicKey{KeyType: KeyTypeSECP256K1, Key: uncompressed[1:]}, nil
+	case 64:
+		return &PublicKey{KeyType: KeyTypeSECP256K1, Key: keyBytes}, nil
+	case 65:
+		if keyBytes[0] != 0x04 {
+			return nil, errors.New("invalid secp256k1 public key")
+		}
+		return &PublicKey{KeyType: KeyTypeSECP256K1, Key: keyBytes[1:]}, nil
+	default:
+		return nil, errors.New("public key length error")
+	}
+}
+
+// ParsePublicKey parses the NEAR text form "ed25519:<base58>" or "secp256k1:<base58>", hex keys are passed to NewPublicKey
+func ParsePublicKey(key string) (*PublicKey, error) {
+	if !strings.Contains(key, ":") {
+		return NewPublicKey(key)
+	}
+
+	keyType, keyBytes, err := parseKeyString(key, publicKeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	return &PublicKey{KeyType: keyType, Key: keyBytes}, nil
+}
+
+// String returns the NEAR text form of the key, as used by the RPC
+func (p *PublicKey) String() string {
+	name := keyTypeName(p.KeyType)
+	if name == "" {
+		return ""
+	}
+	return name + ":" + Encode(p.Key, BitcoinAlphabet)
+}
+
+func (p *PublicKey) Equal(other *PublicKey) bool {
+	return other != nil && p.KeyType == other.KeyType && bytes.Equal(p.Key, other.Key)
+}
+
+// ImplicitAccountID returns the implicit account of the key: the hex of an ed25519 key,
+// or the 0x address of a secp256k1 key
+func (p *PublicKey) ImplicitAccountID() (string, error) {
+	if length, ok := publicKeyLength(p.KeyType); !ok || len(p.Key) != length {
+		return "", errors.New("invalid public key")
+	}
+	if p.KeyType == KeyTypeSECP256K1 {
+		return "0x" + hex.EncodeToString(owcrypt.Hash(p.Key, 0, owcrypt.HASH_ALG_KECCAK256)[12:]), nil
+	}
+	return hex.EncodeToString(p.Key), nil
+}
+
+func (p *PublicKey) MarshalBorsh(e *borsh.Encoder) error {
+	if length, ok := publicKeyLength(p.KeyType); !ok || len(p.Key) != length {
+		return fmt.Errorf("invalid public key, type: %d, length: %d", p.KeyType, len(p.Key))
+	}
+	e.WriteU8(p.KeyType)
+	e.WriteFixedBytes(p.Key)
+	return nil
+}
+
+func (p *PublicKey) UnmarshalBorsh(d *borsh.Decoder) error {
+	keyType, err := d.ReadU8()
+	if err != nil {
+		return err
+	}
+	length, ok := publicKeyLength(keyType)
+	if !ok {
+		return fmt.Errorf("unsupported public key type: %d", keyType)
+	}
+	key, err := d.ReadFixedBytes(length)
+	if err != nil {
+		return err
+	}
+	p.KeyType = keyType
+	p.Key = append([]byte{}, key...)
+	return nil
+}
+
+// SecretKey is a NEAR secret key, 64 bytes of seed and public key for ed25519, 32 bytes for secp256k1
+type SecretKey struct {
+	KeyType byte
+	Key     []byte
+}
+
+// NewSecretKey creates a secret key from a 32-byte private key, a 64-byte ed25519 secret key is also accepted
+func NewSecretKey(keyType byte, privateKey []byte) (*SecretKey, error) {
+	switch {
+	case keyType == KeyTypeED25519 && len(privateKey) == 64:
+		return checkSecretKey(&SecretKey{KeyType: keyType, Key: append([]byte{}, privateKey...)})
+	case keyType == KeyTypeED25519 && len(privateKey) == 32:
+		pub, retCode := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_ED25519)
+		if retCode != owcrypt.SUCCESS {
+			return nil, errors.New("invalid ed25519 private key")
+		}
+		return &SecretKey{KeyType: keyType, Key: append(append([]byte{}, privateKey...), pub...)}, nil
+	case keyType == KeyTypeSECP256K1 && len(privateKey) == 32:
+		return checkSecretKey(&SecretKey{KeyType: keyType, Key: append([]byte{}, privateKey...)})
+	}
+	return nil, fmt.Errorf("invalid secret key, type: %d, length: %d", keyType, len(privateKey))
+}
+
+// ParseSecretKey parses the NEAR text form "ed25519:<base58>" or "secp256k1:<base58>",
+// the public half of an ed25519 secret key must match its seed
+func ParseSecretKey(key string) (*SecretKey, error) {
+	keyType, keyBytes, err := parseKeyString(key, secretKeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %v", err)
+	}
+	return checkSecretKey(&SecretKey{KeyType: keyType, Key: keyBytes})
+}
+
+func checkSecretKey(k *SecretKey) (*SecretKey, error) {
+	pub, retCode := owcrypt.GenPubkey(k.PrivateKey(), curve(k.KeyType))
+	if retCode != owcrypt.SUCCESS {
+		return nil, errors.New("invalid secret key")
+	}
+	if k.KeyType == KeyTypeED25519 && !bytes.Equal(pub, k.Key[32:]) {
+		return nil, errors.New("ed25519 secret key does not match its public key")
+	}
+	return k, nil
+}
+
+// String returns the NEAR text form of the key, as stored in the near-cli credentials
+func (k *SecretKey) String() string {
+	name := keyTypeName(k.KeyType)
+	if name == "" {
+		return ""
+	}
+	return name + ":" + Encode(k.Key, BitcoinAlphabet)
+}
+
+// PrivateKey returns the 32-byte private key used for signing, the seed of an ed25519 key
+func (k *SecretKey) PrivateKey() []byte {
+	return append([]byte{}, k.Key[:32]...)
+}
+
+func (k *SecretKey) PublicKey() *PublicKey {
+	if k.KeyType == KeyTypeED25519 {
+		return &PublicKey{KeyType: k.KeyType, Key: append([]byte{}, k.Key[32:]...)}
+	}
+	pub, _ := owcrypt.GenPubkey(k.Key, owcrypt.ECC_CURVE_SECP256K1)
+	return &PublicKey{KeyType: k.KeyType, Key: pub}
+}
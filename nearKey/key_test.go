@@ -0,0 +1,96 @@
+package nearKey
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestBase58(t *testing.T) {
+	data, _ := hex.DecodeString("00000102ff")
+	encoded := Encode(data, BitcoinAlphabet)
+	if encoded != "11LiA" {
+		t.Errorf("wrong base58 %s", encoded)
+	}
+	decoded, err := Decode(encoded, BitcoinAlphabet)
+	if err != nil || hex.EncodeToString(decoded) != "00000102ff" {
+		t.Errorf("wrong decoded %x %v", decoded, err)
+	}
+	if _, err := Decode("0OIl", BitcoinAlphabet); err == nil {
+		t.Error("invalid base58 chars should be rejected")
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	pub, err := NewPublicKey("bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParsePublicKey(pub.String())
+	if err != nil || !parsed.Equal(pub) || !strings.HasPrefix(pub.String(), "ed25519:") {
+		t.Errorf("ed25519 round trip failed: %s %v", pub, err)
+	}
+	if id, _ := pub.ImplicitAccountID(); id != "bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e" {
+		t.Errorf("wrong implicit account %s", id)
+	}
+
+	secp, err := NewPublicKey("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err = ParsePublicKey(secp.String())
+	if err != nil || !parsed.Equal(secp) || len(parsed.Key) != 64 || !strings.HasPrefix(secp.String(), "secp256k1:") {
+		t.Errorf("secp256k1 round trip failed: %s %v", secp, err)
+	}
+	// the address of the private key 1
+	if id, _ := secp.ImplicitAccountID(); id != "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf" {
+		t.Errorf("wrong eth implicit account %s", id)
+	}
+
+	invalid := []string{"", "ed25519", "ed25519:", "rsa:abc", "ed25519:0OIl",
+		"ed25519:" + Encode(make([]byte, 31), BitcoinAlphabet),
+		"secp256k1:" + Encode(make([]byte, 33), BitcoinAlphabet),
+		"bc7b"}
+	for _, key := range invalid {
+		if _, err := ParsePublicKey(key); err == nil {
+			t.Errorf("%q: expect error", key)
+		}
+	}
+}
+
+func TestSecretKey(t *testing.T) {
+	priv, _ := hex.DecodeString("e0c0c1a43f521f32c05a647a3595304c4992c9344f03eb66b61c796052001775")
+
+	sk, err := NewSecretKey(KeyTypeED25519, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sk.Key) != 64 || hex.EncodeToString(sk.PrivateKey()) != hex.EncodeToString(priv) {
+		t.Errorf("wrong ed25519 secret key %x", sk.Key)
+	}
+	parsed, err := ParseSecretKey(sk.String())
+	if err != nil || parsed.String() != sk.String() || !parsed.PublicKey().Equal(sk.PublicKey()) {
+		t.Errorf("ed25519 round trip failed: %v", err)
+	}
+
+	mismatched := append(append([]byte{}, priv...), make([]byte, 32)...)
+	if _, err := ParseSecretKey("ed25519:" + Encode(mismatched, BitcoinAlphabet)); err == nil {
+		t.Error("secret key with a wrong public half should be rejected")
+	}
+	if _, err := ParseSecretKey("ed25519:" + Encode(priv, BitcoinAlphabet)); err == nil {
+		t.Error("32-byte ed25519 secret key string should be rejected")
+	}
+
+	secp, err := NewSecretKey(KeyTypeSECP256K1, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err = ParseSecretKey(secp.String())
+	if err != nil || !strings.HasPrefix(secp.String(), "secp256k1:") || len(parsed.PublicKey().Key) != 64 {
+		t.Errorf("secp256k1 round trip failed: %v", err)
+	}
+
+	if _, err := NewSecretKey(KeyTypeSECP256K1, priv[:31]); err == nil {
+		t.Error("short private key should be rejected")
+	}
+}
@@ -1,25 +1,165 @@
 package nearTransaction
 
 import (
-	"encoding/hex"
-	"regexp"
+	"fmt"
+	"strings"
 )
 
-const pattern = `^(([a-z\d]+[\-_])*[a-z\d]+\.)*([a-z\d]+[\-_])*[a-z\d]+$`
+const (
+	MinAccountIDLength = 2
+	MaxAccountIDLength = 64
+	// top-level accounts shorter than this can only be created by the registrar
+	MinTopLevelAccountIDLength = 32
+)
+
+// AccountType is the kind of a valid account ID
+type AccountType int
+
+const (
+	NamedAccount AccountType = iota
+	// 64 lowercase hex chars, the hex of an ed25519 public key
+	NearImplicitAccount
+	// 0x followed by 40 lowercase hex chars, the address of a secp256k1 key
+	EthImplicitAccount
+)
+
+// AccountIDErrorReason is why an account ID is rejected
+type AccountIDErrorReason int
+
+const (
+	AccountIDTooShort AccountIDErrorReason = iota + 1
+	AccountIDTooLong
+	// a char other than a-z, 0-9, '-', '_' and '.'
+	AccountIDInvalidChar
+	// a separator at the start or the end, or next to another separator
+	AccountIDRedundantSeparator
+	// the new account is neither a direct sub-account of its creator nor a long enough top-level account
+	AccountIDNotSubAccount
+	AccountIDTopLevelTooShort
+	// an implicit account, which CreateAccount cannot create
+	AccountIDImplicit
+)
+
+func (r AccountIDErrorReason) String() string {
+	switch r {
+	case AccountIDTooShort:
+		return "too short"
+	case AccountIDTooLong:
+		return "too long"
+	case AccountIDInvalidChar:
+		return "invalid character"
+	case AccountIDRedundantSeparator:
+		return "redundant separator"
+	case AccountIDNotSubAccount:
+		return "not a sub-account of the creator"
+	case AccountIDTopLevelTooShort:
+		return "top-level account too short"
+	case AccountIDImplicit:
+		return "implicit account"
+	}
+	return "unknown"
+}
+
+// AccountIDError is returned by the account ID checks, Index is the offending char or -1
+type AccountIDError struct {
+	AccountID string
+	Reason    AccountIDErrorReason
+	Index     int
+}
+
+func (e *AccountIDError) Error() string {
+	if e.Index >= 0 {
+		return fmt.Sprintf("invalid account ID %q: %s at %d", e.AccountID, e.Reason, e.Index)
+	}
+	return fmt.Sprintf("invalid account ID %q: %s", e.AccountID, e.Reason)
+}
+
+// ValidateAccountID checks the account ID with the nearcore rules, the error is an *AccountIDError
+func ValidateAccountID(account string) error {
+	if len(account) < MinAccountIDLength {
+		return &AccountIDError{AccountID: account, Reason: AccountIDTooShort, Index: -1}
+	}
+	if len(account) > MaxAccountIDLength {
+		return &AccountIDError{AccountID: account, Reason: AccountIDTooLong, Index: -1}
+	}
+
+	// every separator must be followed by an alphanumeric char
+	lastIsSeparator := true
+	for i := 0; i < len(account); i++ {
+		c := account[i]
+		switch {
+		case c >= 'a' && c <= 'z' || c >= '0' && c <= '9':
+			lastIsSeparator = false
+		case c == '-' || c == '_' || c == '.':
+			if lastIsSeparator {
+				return &AccountIDError{AccountID: account, Reason: AccountIDRedundantSeparator, Index: i}
+			}
+			lastIsSeparator = true
+		default:
+			return &AccountIDError{AccountID: account, Reason: AccountIDInvalidChar, Index: i}
+		}
+	}
+	if lastIsSeparator {
+		return &AccountIDError{AccountID: account, Reason: AccountIDRedundantSeparator, Index: len(account) - 1}
+	}
+
+	return nil
+}
 
 func IsValid(account string) bool {
-	if len(account) < 2 || len(account) > 64 {
-		return false
+	return ValidateAccountID(account) == nil
+}
+
+// GetAccountType returns the kind of a valid account ID
+func GetAccountType(account string) AccountType {
+	switch {
+	case len(account) == 64 && isLowerHex(account):
+		return NearImplicitAccount
+	case len(account) == 42 && strings.HasPrefix(account, "0x") && isLowerHex(account[2:]):
+		return EthImplicitAccount
 	}
+	return NamedAccount
+}
 
-	if len(account) == 64 {
-		_, err := hex.DecodeString(account)
-		if err != nil {
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
 			return false
 		}
 	}
+	return true
+}
+
+func IsTopLevelAccount(account string) bool {
+	return !strings.Contains(account, ".")
+}
+
+// IsSubAccountOf reports whether account is a direct sub-account of parent, like "a.near" of "near"
+func IsSubAccountOf(account, parent string) bool {
+	return strings.HasSuffix(account, "."+parent) && !strings.Contains(account[:len(account)-len(parent)-1], ".")
+}
+
+// CheckCreateAccount applies the nearcore CreateAccount rules: the creator can only create its direct
+// sub-accounts, or top-level accounts of at least MinTopLevelAccountIDLength chars.
+// Implicit accounts are created by their first transfer, never by CreateAccount
+func CheckCreateAccount(creator, account string) error {
+	if err := ValidateAccountID(account); err != nil {
+		return err
+	}
+	if GetAccountType(account) != NamedAccount {
+		return &AccountIDError{AccountID: account, Reason: AccountIDImplicit, Index: -1}
+	}
 
-	matched, err := regexp.MatchString(pattern, account)
+	if IsTopLevelAccount(account) {
+		if len(account) < MinTopLevelAccountIDLength {
+			return &AccountIDError{AccountID: account, Reason: AccountIDTopLevelTooShort, Index: -1}
+		}
+		return nil
+	}
 
-	return matched && err == nil
-}
\ No newline at end of file
+	if !IsSubAccountOf(account, creator) {
+		return &AccountIDError{AccountID: account, Reason: AccountIDNotSubAccount, Index: -1}
+	}
+	return nil
+}
@@ -1,12 +1,11 @@
 package nearTransaction
 
 import (
-	"encoding/base64"
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/blocktree/go-owcrypt"
-	"math/big"
 	"strings"
 )
 
@@ -16,10 +15,11 @@ type Transfer struct {
 	Nonce uint64
 	ReceiverID string
 	RecentBlockHash string
-	AmountInYoctoN *big.Int
+	AmountInYoctoN YoctoAmount
+	ExpiryHeight uint64
 }
 
-func NewTransfer(signerID, signerPublicKey string, nonce uint64, reveiverID, recentBlockHash string, amountInYoctoN *big.Int) *Transfer {
+func NewTransfer(signerID, signerPublicKey string, nonce uint64, reveiverID, recentBlockHash string, amountInYoctoN YoctoAmount) *Transfer {
 	return &Transfer{
 		SignerID:        signerID,
 		SignerPublicKey: signerPublicKey,
@@ -36,15 +36,30 @@ func (tx *Transfer) CreateEmptyTransactionAndHash() (string, string, error) {
 		return "", "", err
 	}
 
-	emptyTrans := ts.ToBytes()
+	return ts.CreateEmptyTransactionAndHash(tx.ExpiryHeight)
+}
+
+// CreateEmptyTransactionAndHash returns the hex of the unsigned envelope and the hash to sign
+func (tx *TxStruct) CreateEmptyTransactionAndHash(expiryHeight uint64) (string, string, error) {
+	unsigned, err := tx.NewUnsignedTransaction(expiryHeight)
+	if err != nil {
+		return "", "", err
+	}
 
-	return hex.EncodeToString(emptyTrans) + ":" + tx.SignerID + "@" + fmt.Sprint(tx.Nonce),
-		hex.EncodeToString(owcrypt.Hash(emptyTrans, 0, owcrypt.HASH_ALG_SHA256)),
-		nil
+	emptyTrans, err := unsigned.Hex()
+	if err != nil {
+		return "", "", err
+	}
 
+	return emptyTrans, unsigned.Hash, nil
 }
 
 func SignTransaction(hash string, privateKey []byte) ([]byte, error) {
+	return SignTransactionWithKeyType(hash, privateKey, KeyTypeED25519)
+}
+
+// SignTransactionWithKeyType signs the transaction hash, secp256k1 signatures are returned as r || s || v
+func SignTransactionWithKeyType(hash string, privateKey []byte, keyType byte) ([]byte, error) {
 	if privateKey == nil || len(privateKey) != 32 {
 		return nil, errors.New("invalid private key")
 	}
@@ -54,41 +69,85 @@ func SignTransaction(hash string, privateKey []byte) ([]byte, error) {
 		return nil, errors.New("invalid transaction hash")
 	}
 
-	signature, _, retCode := owcrypt.Signature(privateKey, nil, hashBytes, owcrypt.ECC_CURVE_ED25519)
-	if retCode != owcrypt.SUCCESS {
-		return nil, errors.New("sign failed" )
+	switch keyType {
+	case KeyTypeED25519:
+		signature, _, retCode := owcrypt.Signature(privateKey, nil, hashBytes, owcrypt.ECC_CURVE_ED25519)
+		if retCode != owcrypt.SUCCESS {
+			return nil, errors.New("sign failed")
+		}
+		return signature, nil
+	case KeyTypeSECP256K1:
+		signature, v, retCode := owcrypt.Signature(privateKey, nil, hashBytes, owcrypt.ECC_CURVE_SECP256K1)
+		if retCode != owcrypt.SUCCESS {
+			return nil, errors.New("sign failed")
+		}
+		return append(signature, v), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %d", keyType)
 	}
+}
 
-	return signature, nil
+// KeyTypeByCurve maps an owcrypt curve to the NEAR key type
+func KeyTypeByCurve(curve uint32) (byte, error) {
+	switch curve {
+	case owcrypt.ECC_CURVE_ED25519:
+		return KeyTypeED25519, nil
+	case owcrypt.ECC_CURVE_SECP256K1:
+		return KeyTypeSECP256K1, nil
+	default:
+		return 0, fmt.Errorf("unsupported curve: %d", curve)
+	}
 }
 
+// VerifyAndCombineTransaction verifies the signature against the unsigned envelope and returns the hex of the signed envelope
 func VerifyAndCombineTransaction(emptyTrans, hash, publicKey, signature string) (string, bool) {
-	transData := strings.Split(emptyTrans, ":")
-
-	trans, err := hex.DecodeString(transData[0])
-	if err != nil || len(trans) == 0 {
+	unsigned, err := ParseUnsignedTransaction(emptyTrans)
+	if err != nil {
 		return "", false
 	}
-	hashBytes := owcrypt.Hash(trans, 0, owcrypt.HASH_ALG_SHA256)
-	if hex.EncodeToString(hashBytes) != strings.ToLower(hash) {
+	if unsigned.Hash != strings.ToLower(hash) {
 		return "", false
 	}
 
-	pubBytes, err := hex.DecodeString(publicKey)
-	if err != nil || len(pubBytes) != 32 {
+	pub, err := NewPublicKey(publicKey)
+	if err != nil || pub.KeyType != unsigned.PublicKey.KeyType || !bytes.Equal(pub.Key, unsigned.PublicKey.Key) {
 		return "", false
 	}
 
 	sigBytes, err := hex.DecodeString(signature)
-	if err != nil || len(sigBytes) != 64 {
+	if length, _ := signatureLength(pub.KeyType); err != nil || len(sigBytes) != length {
+		return "", false
+	}
+
+	signed := &SignedTransaction{
+		UnsignedTransaction: *unsigned,
+		Signature:           &Signature{KeyType: pub.KeyType, Data: sigBytes},
+	}
+	if signed.check() != nil {
 		return "", false
 	}
 
-	if owcrypt.SUCCESS != owcrypt.Verify(pubBytes, nil, hashBytes, sigBytes, owcrypt.ECC_CURVE_ED25519) {
+	signedTrans, err := signed.Hex()
+	if err != nil {
 		return "", false
 	}
 
-	signedTrans, _ := hex.DecodeString(transData[0] + hex.EncodeToString([]byte{KeyTypeED25519}) + signature)
+	return signedTrans, true
+}
+
+func verifySignature(publicKey *PublicKey, hash []byte, signature *Signature) bool {
+	if publicKey == nil || signature == nil || publicKey.KeyType != signature.KeyType {
+		return false
+	}
 
-	return base64.StdEncoding.EncodeToString(signedTrans) + ":" + transData[1], true
-}
\ No newline at end of file
+	switch publicKey.KeyType {
+	case KeyTypeED25519:
+		return owcrypt.SUCCESS == owcrypt.Verify(publicKey.Key, nil, hash, signature.Data, owcrypt.ECC_CURVE_ED25519)
+	case KeyTypeSECP256K1:
+		if len(signature.Data) != 65 || signature.Data[64] > 1 {
+			return false
+		}
+		return owcrypt.SUCCESS == owcrypt.Verify(publicKey.Key, nil, hash, signature.Data[:64], owcrypt.ECC_CURVE_SECP256K1)
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+package nearTransaction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/blocktree/near-adapter/borsh"
+)
+
+type CreateAccountAction struct{}
+
+type DeployContractAction struct {
+	Code []byte
+}
+
+type FunctionCallAction struct {
+	MethodName string
+	Args       []byte
+	Gas        uint64
+	Deposit    YoctoAmount
+}
+
+type TransferAction struct {
+	Deposit YoctoAmount
+}
+
+type StakeAction struct {
+	Stake     YoctoAmount
+	PublicKey *PublicKey
+}
+
+type AccessKey struct {
+	Nonce      uint64              `json:"nonce"`
+	Permission AccessKeyPermission `json:"permission"`
+}
+
+func (k *AccessKey) MarshalBorsh(e *borsh.Encoder) error {
+	e.WriteU64(k.Nonce)
+	return e.Encode(&k.Permission)
+}
+
+func (k *AccessKey) UnmarshalBorsh(d *borsh.Decoder) error {
+	nonce, err := d.ReadU64()
+	if err != nil {
+		return err
+	}
+	var permission AccessKeyPermission
+	if err := d.Decode(&permission); err != nil {
+		return err
+	}
+	k.Nonce = nonce
+	k.Permission = permission
+	return nil
+}
+
+// AccessKeyPermission is either FunctionCall or FullAccess, selected by PermissionType.
+// Its JSON form follows the RPC: "FullAccess" or {"FunctionCall": {...}}
+type AccessKeyPermission struct {
+	PermissionType byte `borsh:"enum"`
+	FunctionCall   *FunctionCallPermission
+	FullAccess     *struct{}
+}
+
+// FunctionCallPermission limits a key to calls without deposit to methodNames of receiverID,
+// an empty methodNames allows any method, a nil allowance is unlimited
+type FunctionCallPermission struct {
+	Allowance   *YoctoAmount `json:"allowance"`
+	ReceiverID  string       `json:"receiver_id"`
+	MethodNames []string     `json:"method_names"`
+}
+
+// MarshalBorsh writes the allowance as an Option<u128>, a *YoctoAmount is not an Option by itself
+func (p *FunctionCallPermission) MarshalBorsh(e *borsh.Encoder) error {
+	if p.Allowance == nil {
+		e.WriteU8(0)
+	} else {
+		e.WriteU8(1)
+		if err := e.Encode(p.Allowance); err != nil {
+			return err
+		}
+	}
+	e.WriteString(p.ReceiverID)
+	return e.Encode(p.MethodNames)
+}
+
+func (p *FunctionCallPermission) UnmarshalBorsh(d *borsh.Decoder) error {
+	var v FunctionCallPermission
+	hasAllowance, err := d.ReadBool()
+	if err != nil {
+		return err
+	}
+	if hasAllowance {
+		v.Allowance = &YoctoAmount{}
+		if err := d.Decode(v.Allowance); err != nil {
+			return err
+		}
+	}
+	if v.ReceiverID, err = d.ReadString(); err != nil {
+		return err
+	}
+	if err := d.Decode(&v.MethodNames); err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+func NewFullAccessKey(nonce uint64) *AccessKey {
+	return &AccessKey{
+		Nonce:      nonce,
+		Permission: AccessKeyPermission{PermissionType: PermissionFullAccess},
+	}
+}
+
+func NewFunctionCallAccessKey(nonce uint64, allowance *YoctoAmount, receiverID string, methodNames ...string) (*AccessKey, error) {
+	if err := ValidateAccountID(receiverID); err != nil {
+		return nil, err
+	}
+	for _, method := range methodNames {
+		if method == "" {
+			return nil, errors.New("empty method name")
+		}
+	}
+
+	permission := &FunctionCallPermission{
+		ReceiverID:  receiverID,
+		MethodNames: methodNames,
+	}
+	if allowance != nil {
+		a := *allowance
+		permission.Allowance = &a
+	}
+	if permission.MethodNames == nil {
+		permission.MethodNames = []string{}
+	}
+
+	return &AccessKey{
+		Nonce: nonce,
+		Permission: AccessKeyPermission{
+			PermissionType: PermissionFunctionCall,
+			FunctionCall:   permission,
+		},
+	}, nil
+}
+
+func (p AccessKeyPermission) MarshalJSON() ([]byte, error) {
+	switch p.PermissionType {
+	case PermissionFullAccess:
+		return json.Marshal("FullAccess")
+	case PermissionFunctionCall:
+		if p.FunctionCall == nil {
+			return nil, errors.New("function call permission is missing its payload")
+		}
+		return json.Marshal(map[string]interface{}{"FunctionCall": p.FunctionCall})
+	}
+	return nil, fmt.Errorf("unknown access key permission: %d", p.PermissionType)
+}
+
+func (p *AccessKeyPermission) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		if name != "FullAccess" {
+			return fmt.Errorf("unknown access key permission: %s", name)
+		}
+		*p = AccessKeyPermission{PermissionType: PermissionFullAccess}
+		return nil
+	}
+
+	var v struct {
+		FunctionCall *FunctionCallPermission
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.FunctionCall == nil {
+		return fmt.Errorf("unknown access key permission: %s", string(data))
+	}
+	if v.FunctionCall.MethodNames == nil {
+		v.FunctionCall.MethodNames = []string{}
+	}
+
+	*p = AccessKeyPermission{PermissionType: PermissionFunctionCall, FunctionCall: v.FunctionCall}
+	return nil
+}
+
+// IsFullAccess reports whether the key has full access to its account
+func (k *AccessKey) IsFullAccess() bool {
+	return k.Permission.PermissionType == PermissionFullAccess
+}
+
+// Allowance returns the remaining allowance of a function call key, nil when unlimited or for a full access key
+func (k *AccessKey) Allowance() *YoctoAmount {
+	if k.IsFullAccess() || k.Permission.FunctionCall == nil {
+		return nil
+	}
+	return k.Permission.FunctionCall.Allowance
+}
+
+// ReceiverID returns the contract a function call key may call, empty for a full access key
+func (k *AccessKey) ReceiverID() string {
+	if k.IsFullAccess() || k.Permission.FunctionCall == nil {
+		return ""
+	}
+	return k.Permission.FunctionCall.ReceiverID
+}
+
+// MethodNames returns the methods a function call key may call, empty when any method is allowed or for a full access key
+func (k *AccessKey) MethodNames() []string {
+	if k.IsFullAccess() || k.Permission.FunctionCall == nil {
+		return nil
+	}
+	return k.Permission.FunctionCall.MethodNames
+}
+
+// ParseAccessKey decodes the access key JSON of view_access_key results and AddKey actions
+func ParseAccessKey(data []byte) (*AccessKey, error) {
+	var k AccessKey
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+type AddKeyAction struct {
+	PublicKey *PublicKey
+	AccessKey *AccessKey
+}
+
+type DeleteKeyAction struct {
+	PublicKey *PublicKey
+}
+
+type DeleteAccountAction struct {
+	BeneficiaryID *Account
+}
+
+func NewCreateAccountAction() Action {
+	return Action{
+		ActionType:    ActionCreateAccount,
+		CreateAccount: &CreateAccountAction{},
+	}
+}
+
+func NewDeployContractAction(code []byte) Action {
+	return Action{
+		ActionType:     ActionDeployContract,
+		DeployContract: &DeployContractAction{Code: code},
+	}
+}
+
+func NewFunctionCallAction(methodName string, args []byte, gas uint64, deposit YoctoAmount) Action {
+	return Action{
+		ActionType: ActionFunctionCall,
+		FunctionCall: &FunctionCallAction{
+			MethodName: methodName,
+			Args:       args,
+			Gas:        gas,
+			Deposit:    deposit,
+		},
+	}
+}
+
+func NewTransferAction(deposit YoctoAmount) Action {
+	return Action{
+		ActionType: ActionTransfer,
+		Transfer:   &TransferAction{Deposit: deposit},
+	}
+}
+
+func NewStakeAction(stake YoctoAmount, publicKey *PublicKey) Action {
+	return Action{
+		ActionType: ActionStake,
+		Stake: &StakeAction{
+			Stake:     stake,
+			PublicKey: publicKey,
+		},
+	}
+}
+
+func NewAddKeyAction(publicKey *PublicKey, accessKey *AccessKey) Action {
+	return Action{
+		ActionType: ActionAddKey,
+		AddKey: &AddKeyAction{
+			PublicKey: publicKey,
+			AccessKey: accessKey,
+		},
+	}
+}
+
+func NewDeleteKeyAction(publicKey *PublicKey) Action {
+	return Action{
+		ActionType: ActionDeleteKey,
+		DeleteKey:  &DeleteKeyAction{PublicKey: publicKey},
+	}
+}
+
+func NewDeleteAccountAction(beneficiaryID string) (Action, error) {
+	if err := ValidateAccountID(beneficiaryID); err != nil {
+		return Action{}, err
+	}
+	return Action{
+		ActionType:    ActionDeleteAccount,
+		DeleteAccount: &DeleteAccountAction{BeneficiaryID: NewAccount(beneficiaryID)},
+	}, nil
+}
@@ -0,0 +1,196 @@
+package nearTransaction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/blocktree/near-adapter/borsh"
+)
+
+// NEARDecimals is the number of yoctoNEAR decimals in one NEAR
+const NEARDecimals = 24
+
+var (
+	ErrAmountOverflow  = errors.New("amount out of u128 range")
+	ErrAmountUnderflow = errors.New("amount below zero")
+
+	maxU128 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+)
+
+// YoctoAmount is an amount of yoctoNEAR, always within the u128 range.
+// The zero value is 0, the value is immutable and safe to copy.
+type YoctoAmount struct {
+	i *big.Int
+}
+
+func (a YoctoAmount) value() *big.Int {
+	if a.i == nil {
+		return new(big.Int)
+	}
+	return a.i
+}
+
+// NewYoctoAmount copies v, it fails when v is negative or over u128
+func NewYoctoAmount(v *big.Int) (YoctoAmount, error) {
+	var a YoctoAmount
+	if v == nil {
+		return a, nil
+	}
+	if v.Sign() < 0 {
+		return a, ErrAmountUnderflow
+	}
+	if v.Cmp(maxU128) > 0 {
+		return a, ErrAmountOverflow
+	}
+	a.i = new(big.Int).Set(v)
+	return a, nil
+}
+
+func YoctoFromUint64(v uint64) YoctoAmount {
+	return YoctoAmount{i: new(big.Int).SetUint64(v)}
+}
+
+// ParseYocto parses a raw yoctoNEAR integer, with an optional "yoctoNEAR" unit
+func ParseYocto(s string) (YoctoAmount, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "yoctoNEAR"))
+	if !isDigits(s) {
+		return YoctoAmount{}, fmt.Errorf("invalid yoctoNEAR amount: %q", s)
+	}
+	v, _ := new(big.Int).SetString(s, 10)
+	return NewYoctoAmount(v)
+}
+
+// ParseNEAR parses a decimal NEAR amount like "1.5" or "1.5 NEAR", with at most 24 decimals
+func ParseNEAR(s string) (YoctoAmount, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "NEAR"))
+
+	intPart, fracPart := s, ""
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		intPart, fracPart = s[:dot], s[dot+1:]
+		if fracPart == "" {
+			return YoctoAmount{}, fmt.Errorf("invalid NEAR amount: %q", s)
+		}
+	}
+	if !isDigits(intPart) || fracPart != "" && !isDigits(fracPart) {
+		return YoctoAmount{}, fmt.Errorf("invalid NEAR amount: %q", s)
+	}
+	if len(fracPart) > NEARDecimals {
+		return YoctoAmount{}, fmt.Errorf("NEAR amount has more than %d decimals: %q", NEARDecimals, s)
+	}
+
+	v, _ := new(big.Int).SetString(intPart+fracPart+strings.Repeat("0", NEARDecimals-len(fracPart)), 10)
+	return NewYoctoAmount(v)
+}
+
+// ParseAmount parses an amount with its unit, "yoctoNEAR" or "NEAR", a bare number is NEAR
+func ParseAmount(s string) (YoctoAmount, error) {
+	if strings.HasSuffix(strings.TrimSpace(s), "yoctoNEAR") {
+		return ParseYocto(s)
+	}
+	return ParseNEAR(s)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// BigInt returns a copy of the yoctoNEAR value
+func (a YoctoAmount) BigInt() *big.Int {
+	return new(big.Int).Set(a.value())
+}
+
+// YoctoString returns the raw yoctoNEAR integer, as used by the RPC
+func (a YoctoAmount) YoctoString() string {
+	return a.value().String()
+}
+
+// String returns the exact NEAR amount without trailing zeros, like "1.5"
+func (a YoctoAmount) String() string {
+	s := a.Format(NEARDecimals)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// Format returns the NEAR amount with precision decimals, the remaining digits are truncated
+func (a YoctoAmount) Format(precision int) string {
+	if precision < 0 {
+		precision = 0
+	}
+	if precision > NEARDecimals {
+		precision = NEARDecimals
+	}
+
+	digits := a.value().String()
+	if len(digits) <= NEARDecimals {
+		digits = strings.Repeat("0", NEARDecimals-len(digits)+1) + digits
+	}
+	intPart, fracPart := digits[:len(digits)-NEARDecimals], digits[len(digits)-NEARDecimals:]
+	if precision == 0 {
+		return intPart
+	}
+	return intPart + "." + fracPart[:precision]
+}
+
+func (a YoctoAmount) Cmp(b YoctoAmount) int {
+	return a.value().Cmp(b.value())
+}
+
+func (a YoctoAmount) IsZero() bool {
+	return a.value().Sign() == 0
+}
+
+func (a YoctoAmount) Add(b YoctoAmount) (YoctoAmount, error) {
+	return NewYoctoAmount(new(big.Int).Add(a.value(), b.value()))
+}
+
+func (a YoctoAmount) Sub(b YoctoAmount) (YoctoAmount, error) {
+	return NewYoctoAmount(new(big.Int).Sub(a.value(), b.value()))
+}
+
+func (a YoctoAmount) MulUint64(n uint64) (YoctoAmount, error) {
+	return NewYoctoAmount(new(big.Int).Mul(a.value(), new(big.Int).SetUint64(n)))
+}
+
+func (a *YoctoAmount) MarshalBorsh(e *borsh.Encoder) error {
+	return e.WriteU128(a.value())
+}
+
+func (a *YoctoAmount) UnmarshalBorsh(d *borsh.Decoder) error {
+	v, err := d.ReadU128()
+	if err != nil {
+		return err
+	}
+	*a = YoctoAmount{i: v}
+	return nil
+}
+
+// MarshalJSON writes the yoctoNEAR integer as a string, like the RPC
+func (a YoctoAmount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.value().String())
+}
+
+func (a *YoctoAmount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := ParseYocto(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
@@ -0,0 +1,155 @@
+package nearTransaction
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TransactionBuilder builds a transaction with one or more actions, executed atomically by the receiver.
+// The first error is kept and returned by Build.
+//
+//	ts, err := NewTransactionBuilder(signer, publicKey).Nonce(n).Receiver(newAccount).BlockHash(hash).
+//		CreateAccount().Transfer(amount).AddKey(key, NewFullAccessKey(0)).Build()
+type TransactionBuilder struct {
+	signerID        string
+	signerPublicKey string
+	nonce           uint64
+	receiverID      string
+	blockHash       string
+	actions         []Action
+	err             error
+}
+
+func NewTransactionBuilder(signerID, signerPublicKey string) *TransactionBuilder {
+	return &TransactionBuilder{
+		signerID:        signerID,
+		signerPublicKey: signerPublicKey,
+	}
+}
+
+func (b *TransactionBuilder) Nonce(nonce uint64) *TransactionBuilder {
+	b.nonce = nonce
+	return b
+}
+
+func (b *TransactionBuilder) Receiver(receiverID string) *TransactionBuilder {
+	b.receiverID = receiverID
+	return b
+}
+
+// BlockHash sets the base58 hash of a recent block
+func (b *TransactionBuilder) BlockHash(blockHash string) *TransactionBuilder {
+	b.blockHash = blockHash
+	return b
+}
+
+// Action appends a prebuilt action
+func (b *TransactionBuilder) Action(action Action) *TransactionBuilder {
+	b.actions = append(b.actions, action)
+	return b
+}
+
+func (b *TransactionBuilder) CreateAccount() *TransactionBuilder {
+	return b.Action(NewCreateAccountAction())
+}
+
+func (b *TransactionBuilder) DeployContract(code []byte) *TransactionBuilder {
+	return b.Action(NewDeployContractAction(code))
+}
+
+func (b *TransactionBuilder) FunctionCall(methodName string, args []byte, gas uint64, deposit YoctoAmount) *TransactionBuilder {
+	return b.Action(NewFunctionCallAction(methodName, args, gas, deposit))
+}
+
+func (b *TransactionBuilder) Transfer(deposit YoctoAmount) *TransactionBuilder {
+	return b.Action(NewTransferAction(deposit))
+}
+
+func (b *TransactionBuilder) Stake(stake YoctoAmount, publicKey *PublicKey) *TransactionBuilder {
+	return b.Action(NewStakeAction(stake, publicKey))
+}
+
+func (b *TransactionBuilder) AddKey(publicKey *PublicKey, accessKey *AccessKey) *TransactionBuilder {
+	return b.Action(NewAddKeyAction(publicKey, accessKey))
+}
+
+func (b *TransactionBuilder) DeleteKey(publicKey *PublicKey) *TransactionBuilder {
+	return b.Action(NewDeleteKeyAction(publicKey))
+}
+
+func (b *TransactionBuilder) DeleteAccount(beneficiaryID string) *TransactionBuilder {
+	action, err := NewDeleteAccountAction(beneficiaryID)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return b
+	}
+	return b.Action(action)
+}
+
+// Delegate appends a NEP-366 signed delegate, the receiver must be the delegate sender
+func (b *TransactionBuilder) Delegate(signedDelegate *SignedDelegate) *TransactionBuilder {
+	return b.Action(NewSignedDelegateAction(signedDelegate))
+}
+
+// Build validates the action combination and returns the transaction
+func (b *TransactionBuilder) Build() (*TxStruct, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.receiverID == "" {
+		return nil, errors.New("transaction receiver is not set")
+	}
+	if b.blockHash == "" {
+		return nil, errors.New("transaction block hash is not set")
+	}
+	if err := checkActions(b.signerID, b.receiverID, b.actions); err != nil {
+		return nil, err
+	}
+
+	return NewTxStruct(b.signerID, b.signerPublicKey, b.nonce, b.receiverID, b.blockHash, b.actions...)
+}
+
+// checkActions applies the nearcore rules on the actions of a single transaction:
+// CreateAccount can only come first and create a sub-account of the signer, DeleteAccount can only come last, and unless the signer
+// is the receiver or the receiver is created by this transaction, only Transfer, FunctionCall and
+// a Delegate from the receiver itself are allowed.
+func checkActions(signerID, receiverID string, actions []Action) error {
+	if len(actions) == 0 {
+		return errors.New("transaction has no action")
+	}
+
+	ownReceiver := signerID == receiverID || actions[0].ActionType == ActionCreateAccount
+	if actions[0].ActionType == ActionCreateAccount {
+		if err := CheckCreateAccount(signerID, receiverID); err != nil {
+			return err
+		}
+	}
+
+	for i, action := range actions {
+		switch action.ActionType {
+		case ActionCreateAccount:
+			if i != 0 {
+				return errors.New("CreateAccount must be the first action")
+			}
+		case ActionDeleteAccount:
+			if i != len(actions)-1 {
+				return errors.New("DeleteAccount must be the last action")
+			}
+		case ActionDelegate:
+			if err := checkDelegate(receiverID, action.Delegate); err != nil {
+				return err
+			}
+		}
+
+		switch action.ActionType {
+		case ActionTransfer, ActionFunctionCall, ActionCreateAccount, ActionDelegate:
+		default:
+			if !ownReceiver {
+				return fmt.Errorf("action %d can only be sent to the signer's own account or an account created in the same transaction", action.ActionType)
+			}
+		}
+	}
+	return nil
+}
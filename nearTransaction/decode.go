@@ -0,0 +1,92 @@
+package nearTransaction
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/blocktree/near-adapter/borsh"
+)
+
+type Signature struct {
+	KeyType byte
+	Data    []byte
+}
+
+func (s *Signature) MarshalBorsh(e *borsh.Encoder) error {
+	if length, ok := signatureLength(s.KeyType); !ok || len(s.Data) != length {
+		return fmt.Errorf("invalid signature, type: %d, length: %d", s.KeyType, len(s.Data))
+	}
+	e.WriteU8(s.KeyType)
+	e.WriteFixedBytes(s.Data)
+	return nil
+}
+
+func (s *Signature) UnmarshalBorsh(d *borsh.Decoder) error {
+	keyType, err := d.ReadU8()
+	if err != nil {
+		return err
+	}
+	length, ok := signatureLength(keyType)
+	if !ok {
+		return fmt.Errorf("unsupported signature type: %d", keyType)
+	}
+	data, err := d.ReadFixedBytes(length)
+	if err != nil {
+		return err
+	}
+	s.KeyType = keyType
+	s.Data = append([]byte{}, data...)
+	return nil
+}
+
+// DecodeTransactionBytes decodes a borsh serialized transaction, with the signature when signed is true
+func DecodeTransactionBytes(data []byte, signed bool) (*TxStruct, error) {
+	var ts TxStruct
+
+	d := borsh.NewDecoder(data)
+	if err := d.Decode(&ts); err != nil {
+		return nil, err
+	}
+
+	if signed {
+		ts.Signature = &Signature{}
+		if err := d.Decode(ts.Signature); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.Remaining() != 0 {
+		return nil, errors.New("unexpected trailing bytes in transaction data")
+	}
+
+	return &ts, nil
+}
+
+// DecodeUnsignedTransaction decodes the unsigned envelope returned by CreateEmptyTransactionAndHash
+func DecodeUnsignedTransaction(emptyTrans string) (*TxStruct, error) {
+	unsigned, err := ParseUnsignedTransaction(emptyTrans)
+	if err != nil {
+		return nil, err
+	}
+
+	return unsigned.Decode()
+}
+
+// DecodeSignedTransaction decodes the signed envelope returned by VerifyAndCombineTransaction
+func DecodeSignedTransaction(signedTrans string) (*TxStruct, error) {
+	signed, err := ParseSignedTransaction(signedTrans)
+	if err != nil {
+		return nil, err
+	}
+
+	return signed.Decode()
+}
+
+// DecodeRawTransaction decodes either envelope, as stored in RawTransaction.RawHex
+func DecodeRawTransaction(rawTx string) (*TxStruct, error) {
+	if ts, err := DecodeUnsignedTransaction(rawTx); err == nil {
+		return ts, nil
+	}
+
+	return DecodeSignedTransaction(rawTx)
+}
@@ -0,0 +1,171 @@
+package nearTransaction
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/near-adapter/borsh"
+)
+
+// DelegateAction is the NEP-366 meta transaction payload: actions the sender signs off-chain,
+// to be submitted and paid for by a relayer before MaxBlockHeight
+type DelegateAction struct {
+	SenderID       *Account
+	ReceiverID     *Account
+	Actions        []Action
+	Nonce          uint64
+	MaxBlockHeight uint64
+	PublicKey      *PublicKey
+}
+
+// SignedDelegate is a DelegateAction with the sender's signature
+type SignedDelegate struct {
+	DelegateAction DelegateAction
+	Signature      Signature
+}
+
+func NewDelegateAction(senderID, publicKey string, nonce uint64, receiverID string, maxBlockHeight uint64, actions ...Action) (*DelegateAction, error) {
+	if err := ValidateAccountID(senderID); err != nil {
+		return nil, err
+	}
+	if err := ValidateAccountID(receiverID); err != nil {
+		return nil, err
+	}
+
+	pub, err := NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DelegateAction{
+		SenderID:       NewAccount(senderID),
+		ReceiverID:     NewAccount(receiverID),
+		Actions:        actions,
+		Nonce:          nonce,
+		MaxBlockHeight: maxBlockHeight,
+		PublicKey:      pub,
+	}
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+	for i := range actions {
+		if err := actions[i].check(); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// check applies the same action rules as a transaction, delegate actions can not be nested
+func (d *DelegateAction) check() error {
+	for _, action := range d.Actions {
+		if action.ActionType == ActionDelegate {
+			return errors.New("delegate action can not contain a delegate action")
+		}
+	}
+	return checkActions(string(d.SenderID.ID), string(d.ReceiverID.ID), d.Actions)
+}
+
+func (d *DelegateAction) ToBytes() ([]byte, error) {
+	return borsh.Serialize(d)
+}
+
+// Hash returns the hex sha256 of the NEP-366 prefix and the delegate action, the message to sign
+func (d *DelegateAction) Hash() (string, error) {
+	e := borsh.NewEncoder()
+	e.WriteU32(DelegateActionPrefix)
+	if err := e.Encode(d); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(owcrypt.Hash(e.Bytes(), 0, owcrypt.HASH_ALG_SHA256)), nil
+}
+
+// Sign signs the delegate action with the private key of its public key
+func (d *DelegateAction) Sign(privateKey []byte) (*SignedDelegate, error) {
+	hash, err := d.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := SignTransactionWithKeyType(hash, privateKey, d.PublicKey.KeyType)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSignedDelegate(d, signature)
+}
+
+// NewSignedDelegate combines a delegate action with a signature made elsewhere, the signature is verified
+func NewSignedDelegate(d *DelegateAction, signature []byte) (*SignedDelegate, error) {
+	s := &SignedDelegate{
+		DelegateAction: *d,
+		Signature:      Signature{KeyType: d.PublicKey.KeyType, Data: signature},
+	}
+	if !s.Verify() {
+		return nil, errors.New("delegate action signature verify failed")
+	}
+	return s, nil
+}
+
+// Verify checks the signature against the public key of the delegate action
+func (s *SignedDelegate) Verify() bool {
+	hash, err := s.DelegateAction.Hash()
+	if err != nil {
+		return false
+	}
+	hashBytes, _ := hex.DecodeString(hash)
+	return verifySignature(s.DelegateAction.PublicKey, hashBytes, &s.Signature)
+}
+
+func (s *SignedDelegate) ToBytes() ([]byte, error) {
+	return borsh.Serialize(s)
+}
+
+// DecodeSignedDelegate decodes a borsh serialized SignedDelegate, as sent by the user to the relayer
+func DecodeSignedDelegate(data []byte) (*SignedDelegate, error) {
+	var s SignedDelegate
+	if err := borsh.Deserialize(data, &s); err != nil {
+		return nil, err
+	}
+	if err := s.DelegateAction.check(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func NewSignedDelegateAction(signedDelegate *SignedDelegate) Action {
+	return Action{
+		ActionType: ActionDelegate,
+		Delegate:   signedDelegate,
+	}
+}
+
+// NewRelayerTransaction wraps a signed delegate into the relayer's transaction, the relayer pays the gas
+// and the transaction is sent to the delegate sender
+func NewRelayerTransaction(relayerID, relayerPublicKey string, nonce uint64, recentBlockHash string, signedDelegate *SignedDelegate) (*TxStruct, error) {
+	if !signedDelegate.Verify() {
+		return nil, errors.New("delegate action signature verify failed")
+	}
+
+	return NewTransactionBuilder(relayerID, relayerPublicKey).
+		Nonce(nonce).
+		Receiver(string(signedDelegate.DelegateAction.SenderID.ID)).
+		BlockHash(recentBlockHash).
+		Delegate(signedDelegate).
+		Build()
+}
+
+// checkDelegate makes sure a delegate action is sent to its sender
+func checkDelegate(receiverID string, signedDelegate *SignedDelegate) error {
+	if signedDelegate == nil {
+		return errors.New("delegate action is missing its payload")
+	}
+	if string(signedDelegate.DelegateAction.SenderID.ID) != receiverID {
+		return fmt.Errorf("delegate action sender %s does not match the transaction receiver %s",
+			string(signedDelegate.DelegateAction.SenderID.ID), receiverID)
+	}
+	return nil
+}
@@ -0,0 +1,445 @@
+package nearTransaction
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/near-adapter/borsh"
+	"github.com/blocktree/near-adapter/nearKey"
+)
+
+// EnvelopeVersion is the version written by the envelope encoders
+const EnvelopeVersion = byte(1)
+
+const (
+	envelopeUnsigned = byte(0)
+	envelopeSigned   = byte(1)
+)
+
+// UnsignedTransaction is the envelope of a transaction waiting for its signature.
+//
+// Binary form: version u8 | kind u8 | borsh(tx bytes, hash, signer, public key, nonce, block hash, expiry height),
+// the signed form appends the signature. RawTransaction.RawHex holds the hex of the binary form.
+type UnsignedTransaction struct {
+	TxBytes      []byte // borsh serialized TxStruct
+	Hash         string // hex sha256 of TxBytes, the message to sign
+	SignerID     string
+	PublicKey    *PublicKey
+	Nonce        uint64
+	BlockHash    string // base58
+	ExpiryHeight uint64 // last block height the transaction can be included at
+}
+
+// SignedTransaction is an UnsignedTransaction with a verified signature
+type SignedTransaction struct {
+	UnsignedTransaction
+	Signature *Signature
+}
+
+type envelopeJSON struct {
+	Version      byte   `json:"version"`
+	Type         string `json:"type"`
+	SignerID     string `json:"signer_id"`
+	PublicKey    string `json:"public_key"` // "ed25519:<base58>" or "secp256k1:<base58>"
+	Nonce        uint64 `json:"nonce"`
+	BlockHash    string `json:"block_hash"`
+	ExpiryHeight uint64 `json:"expiry_height"`
+	Hash         string `json:"hash"`
+	Tx           string `json:"tx"`
+	Signature    string `json:"signature,omitempty"`
+}
+
+// NewUnsignedTransaction wraps tx into an envelope
+func (tx *TxStruct) NewUnsignedTransaction(expiryHeight uint64) (*UnsignedTransaction, error) {
+	txBytes, err := tx.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return &UnsignedTransaction{
+		TxBytes:      txBytes,
+		Hash:         hex.EncodeToString(owcrypt.Hash(txBytes, 0, owcrypt.HASH_ALG_SHA256)),
+		SignerID:     string(tx.Signer.ID),
+		PublicKey:    tx.SignerPublicKey,
+		Nonce:        tx.Nonce,
+		BlockHash:    nearKey.Encode(tx.BlockHash[:], nearKey.BitcoinAlphabet),
+		ExpiryHeight: expiryHeight,
+	}, nil
+}
+
+// Decode decodes the wrapped transaction
+func (u *UnsignedTransaction) Decode() (*TxStruct, error) {
+	return DecodeTransactionBytes(u.TxBytes, false)
+}
+
+// check makes sure the envelope fields describe the wrapped transaction
+func (u *UnsignedTransaction) check() error {
+	ts, err := u.Decode()
+	if err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(owcrypt.Hash(u.TxBytes, 0, owcrypt.HASH_ALG_SHA256)) != strings.ToLower(u.Hash) {
+		return errors.New("envelope hash does not match the transaction")
+	}
+	if string(ts.Signer.ID) != u.SignerID {
+		return errors.New("envelope signer does not match the transaction")
+	}
+	if u.PublicKey == nil || ts.SignerPublicKey.KeyType != u.PublicKey.KeyType || !bytes.Equal(ts.SignerPublicKey.Key, u.PublicKey.Key) {
+		return errors.New("envelope public key does not match the transaction")
+	}
+	if ts.Nonce != u.Nonce {
+		return errors.New("envelope nonce does not match the transaction")
+	}
+	if nearKey.Encode(ts.BlockHash[:], nearKey.BitcoinAlphabet) != u.BlockHash {
+		return errors.New("envelope block hash does not match the transaction")
+	}
+	return nil
+}
+
+func (u *UnsignedTransaction) encode(e *borsh.Encoder) error {
+	hash, err := hex.DecodeString(u.Hash)
+	if err != nil || len(hash) != 32 {
+		return errors.New("invalid envelope hash")
+	}
+	blockHash, err := nearKey.Decode(u.BlockHash, nearKey.BitcoinAlphabet)
+	if err != nil || len(blockHash) != 32 {
+		return errors.New("invalid envelope block hash")
+	}
+	if u.PublicKey == nil {
+		return errors.New("envelope public key is missing")
+	}
+
+	e.WriteBytes(u.TxBytes)
+	e.WriteFixedBytes(hash)
+	e.WriteString(u.SignerID)
+	if err := u.PublicKey.MarshalBorsh(e); err != nil {
+		return err
+	}
+	e.WriteU64(u.Nonce)
+	e.WriteFixedBytes(blockHash)
+	e.WriteU64(u.ExpiryHeight)
+	return nil
+}
+
+func (u *UnsignedTransaction) decode(d *borsh.Decoder) error {
+	var (
+		v   UnsignedTransaction
+		err error
+	)
+
+	if v.TxBytes, err = d.ReadBytes(); err != nil {
+		return err
+	}
+	hash, err := d.ReadFixedBytes(32)
+	if err != nil {
+		return err
+	}
+	v.Hash = hex.EncodeToString(hash)
+	if v.SignerID, err = d.ReadString(); err != nil {
+		return err
+	}
+	v.PublicKey = &PublicKey{}
+	if err = v.PublicKey.UnmarshalBorsh(d); err != nil {
+		return err
+	}
+	if v.Nonce, err = d.ReadU64(); err != nil {
+		return err
+	}
+	blockHash, err := d.ReadFixedBytes(32)
+	if err != nil {
+		return err
+	}
+	v.BlockHash = nearKey.Encode(blockHash, nearKey.BitcoinAlphabet)
+	if v.ExpiryHeight, err = d.ReadU64(); err != nil {
+		return err
+	}
+
+	v.TxBytes = append([]byte{}, v.TxBytes...)
+	*u = v
+	return nil
+}
+
+func (u *UnsignedTransaction) toJSON(kind string) (*envelopeJSON, error) {
+	if u.PublicKey == nil {
+		return nil, errors.New("envelope public key is missing")
+	}
+	return &envelopeJSON{
+		Version:      EnvelopeVersion,
+		Type:         kind,
+		SignerID:     u.SignerID,
+		PublicKey:    u.PublicKey.String(),
+		Nonce:        u.Nonce,
+		BlockHash:    u.BlockHash,
+		ExpiryHeight: u.ExpiryHeight,
+		Hash:         u.Hash,
+		Tx:           base64.StdEncoding.EncodeToString(u.TxBytes),
+	}, nil
+}
+
+func (u *UnsignedTransaction) fromJSON(data []byte, kind string) (*envelopeJSON, error) {
+	var j envelopeJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	if j.Version != EnvelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version: %d", j.Version)
+	}
+	if j.Type != kind {
+		return nil, fmt.Errorf("expect %s envelope, got %s", kind, j.Type)
+	}
+
+	// the key type comes from the prefix, a bare hex key is ambiguous
+	if !strings.Contains(j.PublicKey, ":") {
+		return nil, fmt.Errorf("envelope public key %q is not <curve>:<base58>", j.PublicKey)
+	}
+	publicKey, err := nearKey.ParsePublicKey(j.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	txBytes, err := base64.StdEncoding.DecodeString(j.Tx)
+	if err != nil {
+		return nil, errors.New("invalid envelope tx base64")
+	}
+
+	*u = UnsignedTransaction{
+		TxBytes:      txBytes,
+		Hash:         strings.ToLower(j.Hash),
+		SignerID:     j.SignerID,
+		PublicKey:    publicKey,
+		Nonce:        j.Nonce,
+		BlockHash:    j.BlockHash,
+		ExpiryHeight: j.ExpiryHeight,
+	}
+	return &j, nil
+}
+
+func (u *UnsignedTransaction) MarshalBinary() ([]byte, error) {
+	e := borsh.NewEncoder()
+	e.WriteU8(EnvelopeVersion)
+	e.WriteU8(envelopeUnsigned)
+	if err := u.encode(e); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+func (u *UnsignedTransaction) UnmarshalBinary(data []byte) error {
+	d, err := newEnvelopeDecoder(data, envelopeUnsigned)
+	if err != nil {
+		return err
+	}
+	if err := u.decode(d); err != nil {
+		return err
+	}
+	if d.Remaining() != 0 {
+		return errors.New("unexpected trailing bytes in envelope")
+	}
+	return u.check()
+}
+
+func (u *UnsignedTransaction) MarshalJSON() ([]byte, error) {
+	j, err := u.toJSON("unsigned")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+func (u *UnsignedTransaction) UnmarshalJSON(data []byte) error {
+	if _, err := u.fromJSON(data, "unsigned"); err != nil {
+		return err
+	}
+	return u.check()
+}
+
+// Hex returns the hex of the binary form
+func (u *UnsignedTransaction) Hex() (string, error) {
+	data, err := u.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// TxID returns the base58 transaction hash the node reports, known before broadcasting
+func (u *UnsignedTransaction) TxID() (string, error) {
+	hash, err := hex.DecodeString(u.Hash)
+	if err != nil || len(hash) != 32 {
+		return "", errors.New("invalid transaction hash")
+	}
+	return nearKey.Encode(hash, nearKey.BitcoinAlphabet), nil
+}
+
+// SignedBytes returns the borsh serialized SignedTransaction, the payload broadcast to the node
+func (s *SignedTransaction) SignedBytes() ([]byte, error) {
+	if s.Signature == nil {
+		return nil, errors.New("transaction is not signed")
+	}
+	e := borsh.NewEncoder()
+	e.WriteFixedBytes(s.TxBytes)
+	if err := s.Signature.MarshalBorsh(e); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// Base64 returns the base64 of SignedBytes, as expected by broadcast_tx_*
+func (s *SignedTransaction) Base64() (string, error) {
+	data, err := s.SignedBytes()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decode decodes the wrapped transaction with its signature
+func (s *SignedTransaction) Decode() (*TxStruct, error) {
+	data, err := s.SignedBytes()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeTransactionBytes(data, true)
+}
+
+func (s *SignedTransaction) check() error {
+	if err := s.UnsignedTransaction.check(); err != nil {
+		return err
+	}
+	if s.Signature == nil {
+		return errors.New("transaction is not signed")
+	}
+	hash, _ := hex.DecodeString(s.Hash)
+	if !verifySignature(s.PublicKey, hash, s.Signature) {
+		return errors.New("transaction signature verify failed")
+	}
+	return nil
+}
+
+func (s *SignedTransaction) MarshalBinary() ([]byte, error) {
+	e := borsh.NewEncoder()
+	e.WriteU8(EnvelopeVersion)
+	e.WriteU8(envelopeSigned)
+	if err := s.encode(e); err != nil {
+		return nil, err
+	}
+	if s.Signature == nil {
+		return nil, errors.New("transaction is not signed")
+	}
+	if err := s.Signature.MarshalBorsh(e); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+func (s *SignedTransaction) UnmarshalBinary(data []byte) error {
+	d, err := newEnvelopeDecoder(data, envelopeSigned)
+	if err != nil {
+		return err
+	}
+	if err := s.decode(d); err != nil {
+		return err
+	}
+	s.Signature = &Signature{}
+	if err := s.Signature.UnmarshalBorsh(d); err != nil {
+		return err
+	}
+	if d.Remaining() != 0 {
+		return errors.New("unexpected trailing bytes in envelope")
+	}
+	return s.check()
+}
+
+func (s *SignedTransaction) MarshalJSON() ([]byte, error) {
+	if s.Signature == nil {
+		return nil, errors.New("transaction is not signed")
+	}
+	j, err := s.toJSON("signed")
+	if err != nil {
+		return nil, err
+	}
+	j.Signature = hex.EncodeToString(s.Signature.Data)
+	return json.Marshal(j)
+}
+
+func (s *SignedTransaction) UnmarshalJSON(data []byte) error {
+	j, err := s.fromJSON(data, "signed")
+	if err != nil {
+		return err
+	}
+	sig, err := hex.DecodeString(j.Signature)
+	if err != nil {
+		return errors.New("invalid envelope signature hex")
+	}
+	s.Signature = &Signature{KeyType: s.PublicKey.KeyType, Data: sig}
+	return s.check()
+}
+
+// Hex returns the hex of the binary form
+func (s *SignedTransaction) Hex() (string, error) {
+	data, err := s.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+func newEnvelopeDecoder(data []byte, kind byte) (*borsh.Decoder, error) {
+	d := borsh.NewDecoder(data)
+	version, err := d.ReadU8()
+	if err != nil {
+		return nil, err
+	}
+	if version != EnvelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version: %d", version)
+	}
+	k, err := d.ReadU8()
+	if err != nil {
+		return nil, err
+	}
+	if k != kind {
+		return nil, fmt.Errorf("unexpected envelope kind: %d", k)
+	}
+	return d, nil
+}
+
+// ParseUnsignedTransaction parses an unsigned envelope, either its hex binary or its JSON form
+func ParseUnsignedTransaction(raw string) (*UnsignedTransaction, error) {
+	var u UnsignedTransaction
+	if err := parseEnvelope(raw, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ParseSignedTransaction parses a signed envelope, either its hex binary or its JSON form
+func ParseSignedTransaction(raw string) (*SignedTransaction, error) {
+	var s SignedTransaction
+	if err := parseEnvelope(raw, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+type envelope interface {
+	UnmarshalBinary(data []byte) error
+	UnmarshalJSON(data []byte) error
+}
+
+func parseEnvelope(raw string, v envelope) error {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "{") {
+		return v.UnmarshalJSON([]byte(raw))
+	}
+	data, err := hex.DecodeString(raw)
+	if err != nil || len(data) == 0 {
+		return errors.New("invalid transaction envelope hex")
+	}
+	return v.UnmarshalBinary(data)
+}
@@ -0,0 +1,274 @@
+package nearTransaction
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+)
+
+// Fee is the gas cost of one runtime operation, send_sir applies when the signer is the receiver
+type Fee struct {
+	SendSir    uint64 `json:"send_sir"`
+	SendNotSir uint64 `json:"send_not_sir"`
+	Execution  uint64 `json:"execution"`
+}
+
+func (f Fee) send(senderIsReceiver bool) uint64 {
+	if senderIsReceiver {
+		return f.SendSir
+	}
+	return f.SendNotSir
+}
+
+type AccessKeyCreationConfig struct {
+	FullAccessCost          Fee `json:"full_access_cost"`
+	FunctionCallCost        Fee `json:"function_call_cost"`
+	FunctionCallCostPerByte Fee `json:"function_call_cost_per_byte"`
+}
+
+type ActionCreationConfig struct {
+	CreateAccountCost         Fee                     `json:"create_account_cost"`
+	DeployContractCost        Fee                     `json:"deploy_contract_cost"`
+	DeployContractCostPerByte Fee                     `json:"deploy_contract_cost_per_byte"`
+	FunctionCallCost          Fee                     `json:"function_call_cost"`
+	FunctionCallCostPerByte   Fee                     `json:"function_call_cost_per_byte"`
+	TransferCost              Fee                     `json:"transfer_cost"`
+	StakeCost                 Fee                     `json:"stake_cost"`
+	AddKeyCost                AccessKeyCreationConfig `json:"add_key_cost"`
+	DeleteKeyCost             Fee                     `json:"delete_key_cost"`
+	DeleteAccountCost         Fee                     `json:"delete_account_cost"`
+	DelegateCost              Fee                     `json:"delegate_cost"`
+}
+
+// RuntimeFeesConfig is the transaction_costs section of the runtime config
+type RuntimeFeesConfig struct {
+	ActionReceiptCreationConfig Fee                  `json:"action_receipt_creation_config"`
+	ActionCreationConfig        ActionCreationConfig `json:"action_creation_config"`
+}
+
+// ProtocolConfig is the part of the EXPERIMENTAL_protocol_config result the adapter uses
+type ProtocolConfig struct {
+	ProtocolVersion uint32      `json:"protocol_version"`
+	ChainID         string      `json:"chain_id"`
+	EpochLength     uint64      `json:"epoch_length"`
+	MinGasPrice     YoctoAmount `json:"min_gas_price"`
+	// balance locked per byte of account storage
+	StorageAmountPerByte YoctoAmount        `json:"storage_amount_per_byte"`
+	TransactionCosts     *RuntimeFeesConfig `json:"transaction_costs"`
+}
+
+// ParseProtocolConfig parses an EXPERIMENTAL_protocol_config result
+func ParseProtocolConfig(data []byte) (*ProtocolConfig, error) {
+	var v struct {
+		ProtocolConfig
+		RuntimeConfig *struct {
+			StorageAmountPerByte YoctoAmount        `json:"storage_amount_per_byte"`
+			TransactionCosts     *RuntimeFeesConfig `json:"transaction_costs"`
+		} `json:"runtime_config"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if v.RuntimeConfig == nil || v.RuntimeConfig.TransactionCosts == nil {
+		return nil, errors.New("protocol config has no runtime_config.transaction_costs")
+	}
+	if v.RuntimeConfig.StorageAmountPerByte.IsZero() {
+		return nil, errors.New("protocol config has no runtime_config.storage_amount_per_byte")
+	}
+
+	cfg := v.ProtocolConfig
+	cfg.StorageAmountPerByte = v.RuntimeConfig.StorageAmountPerByte
+	cfg.TransactionCosts = v.RuntimeConfig.TransactionCosts
+	return &cfg, nil
+}
+
+// StorageCost returns the balance locked by storageUsage bytes of account storage
+func (p *ProtocolConfig) StorageCost(storageUsage uint64) *big.Int {
+	return new(big.Int).Mul(p.StorageAmountPerByte.value(), new(big.Int).SetUint64(storageUsage))
+}
+
+// FeeEstimate is the gas a transaction costs before execution.
+// SendGas is burnt when the transaction is converted to a receipt, ExecGas is prepaid for the receipt execution,
+// AttachedGas is the gas attached to function calls, all of it is burnt in the worst case.
+type FeeEstimate struct {
+	SendGas     uint64
+	ExecGas     uint64
+	AttachedGas uint64
+	Deposit     *big.Int
+}
+
+// ParseRuntimeFeesConfig parses either the transaction_costs object, or a whole
+// EXPERIMENTAL_protocol_config result containing runtime_config.transaction_costs
+func ParseRuntimeFeesConfig(data []byte) (*RuntimeFeesConfig, error) {
+	var v struct {
+		RuntimeConfig *struct {
+			TransactionCosts *RuntimeFeesConfig `json:"transaction_costs"`
+		} `json:"runtime_config"`
+		TransactionCosts *RuntimeFeesConfig `json:"transaction_costs"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case v.RuntimeConfig != nil && v.RuntimeConfig.TransactionCosts != nil:
+		return v.RuntimeConfig.TransactionCosts, nil
+	case v.TransactionCosts != nil:
+		return v.TransactionCosts, nil
+	}
+
+	var cfg RuntimeFeesConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.ActionReceiptCreationConfig.Execution == 0 {
+		return nil, errors.New("runtime fees config has no action_receipt_creation_config")
+	}
+	return &cfg, nil
+}
+
+// LoadRuntimeFeesConfig reads a runtime fees config file, see ParseRuntimeFeesConfig
+func LoadRuntimeFeesConfig(path string) (*RuntimeFeesConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRuntimeFeesConfig(data)
+}
+
+// EstimateFee computes the gas of tx the same way the runtime charges it before execution
+func (cfg *RuntimeFeesConfig) EstimateFee(tx *TxStruct) (*FeeEstimate, error) {
+	return cfg.EstimateActionsFee(string(tx.Signer.ID), string(tx.Receiver.ID), tx.Actions...)
+}
+
+// EstimateActionsFee computes the gas of a transaction with actions before it is built, the nonce,
+// keys and block hash do not change the fees
+func (cfg *RuntimeFeesConfig) EstimateActionsFee(signerID, receiverID string, actions ...Action) (*FeeEstimate, error) {
+	sir := signerID == receiverID
+
+	estimate := &FeeEstimate{Deposit: new(big.Int)}
+	receipt := cfg.ActionReceiptCreationConfig
+	estimate.SendGas = receipt.send(sir)
+	estimate.ExecGas = receipt.Execution
+
+	if err := cfg.addActions(estimate, sir, receiverID, actions); err != nil {
+		return nil, err
+	}
+	return estimate, nil
+}
+
+func (cfg *RuntimeFeesConfig) addActions(estimate *FeeEstimate, sir bool, receiverID string, actions []Action) error {
+	for _, action := range actions {
+		send, exec, err := cfg.actionFee(action, sir, receiverID)
+		if err != nil {
+			return err
+		}
+		estimate.SendGas += send
+		estimate.ExecGas += exec
+
+		switch action.ActionType {
+		case ActionFunctionCall:
+			estimate.AttachedGas += action.FunctionCall.Gas
+			estimate.Deposit.Add(estimate.Deposit, action.FunctionCall.Deposit.value())
+		case ActionTransfer:
+			estimate.Deposit.Add(estimate.Deposit, action.Transfer.Deposit.value())
+		case ActionDelegate:
+			// the inner receipt is prepaid by the relayer, its send fees included
+			d := action.Delegate.DelegateAction
+			innerSir := string(d.SenderID.ID) == string(d.ReceiverID.ID)
+			inner := &FeeEstimate{Deposit: new(big.Int)}
+			if err := cfg.addActions(inner, innerSir, string(d.ReceiverID.ID), d.Actions); err != nil {
+				return err
+			}
+			estimate.ExecGas += cfg.ActionReceiptCreationConfig.send(innerSir) + cfg.ActionReceiptCreationConfig.Execution +
+				inner.SendGas + inner.ExecGas
+			estimate.AttachedGas += inner.AttachedGas
+			estimate.Deposit.Add(estimate.Deposit, inner.Deposit)
+		}
+	}
+	return nil
+}
+
+// actionFee returns the send and exec gas of a single action
+func (cfg *RuntimeFeesConfig) actionFee(action Action, sir bool, receiverID string) (uint64, uint64, error) {
+	c := cfg.ActionCreationConfig
+	switch action.ActionType {
+	case ActionCreateAccount:
+		return c.CreateAccountCost.send(sir), c.CreateAccountCost.Execution, nil
+	case ActionDeployContract:
+		if action.DeployContract == nil {
+			break
+		}
+		n := uint64(len(action.DeployContract.Code))
+		return c.DeployContractCost.send(sir) + c.DeployContractCostPerByte.send(sir)*n,
+			c.DeployContractCost.Execution + c.DeployContractCostPerByte.Execution*n, nil
+	case ActionFunctionCall:
+		if action.FunctionCall == nil {
+			break
+		}
+		n := uint64(len(action.FunctionCall.MethodName) + len(action.FunctionCall.Args))
+		return c.FunctionCallCost.send(sir) + c.FunctionCallCostPerByte.send(sir)*n,
+			c.FunctionCallCost.Execution + c.FunctionCallCostPerByte.Execution*n, nil
+	case ActionTransfer:
+		send, exec := c.TransferCost.send(sir), c.TransferCost.Execution
+		switch GetAccountType(receiverID) {
+		case NearImplicitAccount:
+			// the first transfer to a NEAR-implicit account creates it with a full access key
+			send += c.CreateAccountCost.send(sir) + c.AddKeyCost.FullAccessCost.send(sir)
+			exec += c.CreateAccountCost.Execution + c.AddKeyCost.FullAccessCost.Execution
+		case EthImplicitAccount:
+			// an ETH-implicit account is created with the wallet contract and no access key,
+			// the contract deployment is not charged
+			send += c.CreateAccountCost.send(sir)
+			exec += c.CreateAccountCost.Execution
+		}
+		return send, exec, nil
+	case ActionStake:
+		return c.StakeCost.send(sir), c.StakeCost.Execution, nil
+	case ActionAddKey:
+		if action.AddKey == nil || action.AddKey.AccessKey == nil {
+			break
+		}
+		permission := action.AddKey.AccessKey.Permission
+		if permission.PermissionType != PermissionFunctionCall {
+			return c.AddKeyCost.FullAccessCost.send(sir), c.AddKeyCost.FullAccessCost.Execution, nil
+		}
+		if permission.FunctionCall == nil {
+			break
+		}
+		var n uint64
+		for _, method := range permission.FunctionCall.MethodNames {
+			n += uint64(len(method)) + 1
+		}
+		return c.AddKeyCost.FunctionCallCost.send(sir) + c.AddKeyCost.FunctionCallCostPerByte.send(sir)*n,
+			c.AddKeyCost.FunctionCallCost.Execution + c.AddKeyCost.FunctionCallCostPerByte.Execution*n, nil
+	case ActionDeleteKey:
+		return c.DeleteKeyCost.send(sir), c.DeleteKeyCost.Execution, nil
+	case ActionDeleteAccount:
+		return c.DeleteAccountCost.send(sir), c.DeleteAccountCost.Execution, nil
+	case ActionDelegate:
+		if action.Delegate == nil {
+			break
+		}
+		return c.DelegateCost.send(sir), c.DelegateCost.Execution, nil
+	}
+	return 0, 0, errors.New("invalid action")
+}
+
+// Gas returns the gas burnt by the fees, without the attached gas
+func (e *FeeEstimate) Gas() uint64 {
+	return e.SendGas + e.ExecGas
+}
+
+// Burnt returns the tokens burnt by the fees at gasPrice
+func (e *FeeEstimate) Burnt(gasPrice *big.Int) *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(e.Gas()), gasPrice)
+}
+
+// MaxCost returns the worst case tokens spent at gasPrice: the fees, all the attached gas and the deposits
+func (e *FeeEstimate) MaxCost(gasPrice *big.Int) *big.Int {
+	cost := e.Burnt(gasPrice)
+	cost.Add(cost, new(big.Int).Mul(new(big.Int).SetUint64(e.AttachedGas), gasPrice))
+	return cost.Add(cost, e.Deposit)
+}
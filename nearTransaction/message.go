@@ -0,0 +1,106 @@
+package nearTransaction
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/near-adapter/borsh"
+	"github.com/blocktree/near-adapter/nearKey"
+)
+
+// MessagePayload is the NEP-413 off-chain message, signed to prove the ownership of an account
+type MessagePayload struct {
+	Message     string
+	Nonce       [32]byte
+	Recipient   string
+	CallbackURL *string
+}
+
+// SignedMessage is the NEP-413 output returned to the recipient
+type SignedMessage struct {
+	AccountID string `json:"accountId"`
+	PublicKey string `json:"publicKey"` // <curve>:<base58>, ed25519 or secp256k1
+	Signature string `json:"signature"` // base64
+	State     string `json:"state,omitempty"`
+}
+
+// NewMessagePayload creates a payload, nonce must be 32 bytes and an empty callbackURL is omitted
+func NewMessagePayload(message string, nonce []byte, recipient, callbackURL string) (*MessagePayload, error) {
+	if len(nonce) != 32 {
+		return nil, errors.New("message nonce must be 32 bytes")
+	}
+	if recipient == "" {
+		return nil, errors.New("message recipient is empty")
+	}
+
+	p := &MessagePayload{
+		Message:   message,
+		Recipient: recipient,
+	}
+	copy(p.Nonce[:], nonce)
+	if callbackURL != "" {
+		p.CallbackURL = &callbackURL
+	}
+	return p, nil
+}
+
+// Hash returns the hex sha256 of the NEP-413 tag and the payload, the message to sign
+func (p *MessagePayload) Hash() (string, error) {
+	e := borsh.NewEncoder()
+	e.WriteU32(MessagePrefix)
+	if err := e.Encode(p); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(owcrypt.Hash(e.Bytes(), 0, owcrypt.HASH_ALG_SHA256)), nil
+}
+
+// SignMessage signs the payload for accountID with the same keys SignTransaction uses
+func SignMessage(payload *MessagePayload, accountID string, privateKey []byte, keyType byte) (*SignedMessage, error) {
+	hash, err := payload.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := SignTransactionWithKeyType(hash, privateKey, keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	secretKey, err := nearKey.NewSecretKey(keyType, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedMessage{
+		AccountID: accountID,
+		PublicKey: secretKey.PublicKey().String(),
+		Signature: base64.StdEncoding.EncodeToString(signature),
+	}, nil
+}
+
+// VerifyMessage verifies the signature of the payload against the public key of the signed message,
+// it does not check that the key belongs to the account
+func VerifyMessage(payload *MessagePayload, signed *SignedMessage) error {
+	pub, err := ParsePublicKey(signed.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return errors.New("invalid message signature base64")
+	}
+
+	hash, err := payload.Hash()
+	if err != nil {
+		return err
+	}
+	hashBytes, _ := hex.DecodeString(hash)
+
+	if !verifySignature(pub, hashBytes, &Signature{KeyType: pub.KeyType, Data: signature}) {
+		return errors.New("message signature verify failed")
+	}
+	return nil
+}
@@ -1,6 +1,47 @@
 package nearTransaction
 
+import "github.com/blocktree/near-adapter/nearKey"
+
+const (
+	KeyTypeED25519   = nearKey.KeyTypeED25519
+	KeyTypeSECP256K1 = nearKey.KeyTypeSECP256K1
+)
+
+// TransactionValidityPeriod is the number of blocks a transaction stays valid after its block hash
+const TransactionValidityPeriod = uint64(86400)
+
+// action types, in the order of the Action enum in nearcore
 const (
-	KeyTypeED25519 = byte(0)
-	ActionTransfer = byte(3)
+	ActionCreateAccount  = byte(0)
+	ActionDeployContract = byte(1)
+	ActionFunctionCall   = byte(2)
+	ActionTransfer       = byte(3)
+	ActionStake          = byte(4)
+	ActionAddKey         = byte(5)
+	ActionDeleteKey      = byte(6)
+	ActionDeleteAccount  = byte(7)
+	ActionDelegate       = byte(8)
 )
+
+// DelegateActionPrefix is the NEP-366 prefix hashed before a DelegateAction, 2^30 + 366
+const DelegateActionPrefix = uint32(1<<30 + 366)
+
+// MessagePrefix is the NEP-413 tag hashed before a signed message payload, 2^31 + 413
+const MessagePrefix = uint32(1<<31 + 413)
+
+// access key permission types
+const (
+	PermissionFunctionCall = byte(0)
+	PermissionFullAccess   = byte(1)
+)
+
+// signatureLength returns the signature length of a key type, secp256k1 signatures are r || s || v
+func signatureLength(keyType byte) (int, bool) {
+	switch keyType {
+	case KeyTypeED25519:
+		return 64, true
+	case KeyTypeSECP256K1:
+		return 65, true
+	}
+	return 0, false
+}
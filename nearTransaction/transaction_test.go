@@ -1,10 +1,18 @@
 package nearTransaction
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"strings"
 	"testing"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/near-adapter/borsh"
+	"github.com/blocktree/near-adapter/nearKey"
 )
 
 func TestTransfer(t *testing.T) {
@@ -14,7 +22,7 @@ func TestTransfer(t *testing.T) {
 	receiverID := "receiver.testnet"
 	recentBlockHash := "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu"
 	privateKey, _ := hex.DecodeString("e0c0c1a43f521f32c05a647a3595304c4992c9344f03eb66b61c796052001775")
-	amount, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+	amount, _ := ParseNEAR("1")
 
 	transfer := NewTransfer(signerID, signerPublicKey, nonce,receiverID, recentBlockHash, amount)
 
@@ -42,3 +50,741 @@ func TestTransfer(t *testing.T) {
 		t.Error("failed")
 	}
 }
+
+func TestActionToBytes(t *testing.T) {
+	pub, _ := NewPublicKey("bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e")
+	amount, _ := ParseNEAR("1")
+	deleteAccount, err := NewDeleteAccountAction("bob.near")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		action Action
+		expect string
+	}{
+		{NewCreateAccountAction(), "00"},
+		{NewDeployContractAction([]byte{0x00, 0x61, 0x73, 0x6d}), "01040000000061736d"},
+		{NewFunctionCallAction("ping", []byte("{}"), 30000000000000, YoctoFromUint64(1)),
+			"020400000070696e67020000007b7d00e057eb481b000001000000000000000000000000000000"},
+		{NewTransferAction(amount), "03000000a1edccce1bc2d3000000000000"},
+		{NewStakeAction(amount, pub), "04000000a1edccce1bc2d300000000000000bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e"},
+		{NewAddKeyAction(pub, NewFullAccessKey(0)), "0500bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e000000000000000001"},
+		{NewDeleteKeyAction(pub), "0600bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e"},
+		{deleteAccount, "0708000000626f622e6e656172"},
+	}
+
+	for _, c := range cases {
+		data, err := borsh.Serialize(&c.action)
+		if err != nil {
+			t.Errorf("action %d: %v", c.action.ActionType, err)
+			continue
+		}
+		if got := hex.EncodeToString(data); got != c.expect {
+			t.Errorf("action %d: expect %s, got %s", c.action.ActionType, c.expect, got)
+		}
+
+		var decoded Action
+		if err := borsh.Deserialize(data, &decoded); err != nil || decoded.ActionType != c.action.ActionType {
+			t.Errorf("action %d: decode failed: %v", c.action.ActionType, err)
+		}
+	}
+}
+
+func TestMultiActionTransaction(t *testing.T) {
+	signerPublicKey := "bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e"
+	privateKey, _ := hex.DecodeString("e0c0c1a43f521f32c05a647a3595304c4992c9344f03eb66b61c796052001775")
+	pub, _ := NewPublicKey(signerPublicKey)
+	amount, _ := ParseNEAR("1")
+
+	ts, err := NewTxStruct("sender.testnet", signerPublicKey, 2, "sub.sender.testnet", "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu",
+		NewCreateAccountAction(),
+		NewTransferAction(amount),
+		NewAddKeyAction(pub, NewFullAccessKey(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emptyTrans, hash, err := ts.CreateEmptyTransactionAndHash(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := SignTransaction(hash, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedTrans, pass := VerifyAndCombineTransaction(emptyTrans, hash, signerPublicKey, hex.EncodeToString(sig))
+	if !pass {
+		t.Fatal("verify failed")
+	}
+	fmt.Println("signed : ", signedTrans)
+
+	if _, err := NewTxStruct("sender.testnet", signerPublicKey, 2, "receiver.testnet", "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu",
+		Action{ActionType: ActionAddKey}); err == nil {
+		t.Error("action without payload should be rejected")
+	}
+}
+
+func TestDecodeTransaction(t *testing.T) {
+	signerPublicKey := "bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e"
+	privateKey, _ := hex.DecodeString("e0c0c1a43f521f32c05a647a3595304c4992c9344f03eb66b61c796052001775")
+	pub, _ := NewPublicKey(signerPublicKey)
+	deleteAccount, _ := NewDeleteAccountAction("beneficiary.testnet")
+
+	ts, err := NewTxStruct("sender.testnet", signerPublicKey, 7, "receiver.testnet", "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu",
+		NewFunctionCallAction("ft_transfer", []byte(`{"receiver_id":"bob.testnet","amount":"1"}`), 30000000000000, YoctoFromUint64(1)),
+		NewStakeAction(YoctoFromUint64(100), pub),
+		NewDeleteKeyAction(pub),
+		deleteAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emptyTrans, hash, err := ts.CreateEmptyTransactionAndHash(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned, err := DecodeRawTransaction(emptyTrans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsignedBytes, _ := unsigned.ToBytes()
+	tsBytes, _ := ts.ToBytes()
+	unsignedHash, _ := unsigned.Hash()
+	if !bytes.Equal(unsignedBytes, tsBytes) || unsignedHash != hash || unsigned.Signature != nil {
+		t.Error("unsigned transaction round trip failed")
+	}
+	if string(unsigned.Signer.ID) != "sender.testnet" || string(unsigned.Receiver.ID) != "receiver.testnet" {
+		t.Error("wrong signer or receiver")
+	}
+	if len(unsigned.Actions) != 4 || unsigned.Actions[0].FunctionCall.MethodName != "ft_transfer" ||
+		string(unsigned.Actions[3].DeleteAccount.BeneficiaryID.ID) != "beneficiary.testnet" {
+		t.Error("wrong actions")
+	}
+
+	sig, _ := SignTransaction(hash, privateKey)
+	signedTrans, pass := VerifyAndCombineTransaction(emptyTrans, hash, signerPublicKey, hex.EncodeToString(sig))
+	if !pass {
+		t.Fatal("verify failed")
+	}
+
+	signed, err := DecodeRawTransaction(signedTrans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedHash, _ := signed.Hash()
+	if signedHash != hash || signed.Signature == nil || !bytes.Equal(signed.Signature.Data, sig) {
+		t.Error("signed transaction round trip failed")
+	}
+
+	if _, err := DecodeUnsignedTransaction(emptyTrans[:len(emptyTrans)-40]); err == nil {
+		t.Error("truncated transaction should fail to decode")
+	}
+}
+
+func TestTransactionEnvelope(t *testing.T) {
+	signerPublicKey := "bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e"
+	privateKey, _ := hex.DecodeString("e0c0c1a43f521f32c05a647a3595304c4992c9344f03eb66b61c796052001775")
+
+	// an account ID with the separators the old "hex:signer@nonce" format split on
+	ts, err := NewTxStruct("a-b_c.sender.testnet", signerPublicKey, 42, "receiver.testnet", "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu",
+		NewTransferAction(YoctoFromUint64(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned, err := ts.NewUnsignedTransaction(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonData, err := json.Marshal(unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := ParseUnsignedTransaction(string(jsonData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyTrans, _ := unsigned.Hex()
+	fromHex, err := ParseUnsignedTransaction(emptyTrans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*UnsignedTransaction{fromJSON, fromHex} {
+		if u.SignerID != "a-b_c.sender.testnet" || u.Nonce != 42 || u.ExpiryHeight != 1000 ||
+			u.BlockHash != "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu" || u.Hash != unsigned.Hash ||
+			!bytes.Equal(u.TxBytes, unsigned.TxBytes) {
+			t.Errorf("envelope round trip failed: %+v", u)
+		}
+	}
+
+	pub, _ := NewPublicKey(signerPublicKey)
+	if !strings.Contains(string(jsonData), `"public_key":"`+pub.String()+`"`) {
+		t.Errorf("envelope public key should be typed: %s", jsonData)
+	}
+	hexKey := strings.Replace(string(jsonData), pub.String(), signerPublicKey, 1)
+	if _, err := ParseUnsignedTransaction(hexKey); err == nil {
+		t.Error("envelope with a hex public key should be rejected")
+	}
+
+	tampered := strings.Replace(string(jsonData), `"nonce":42`, `"nonce":43`, 1)
+	if _, err := ParseUnsignedTransaction(tampered); err == nil {
+		t.Error("envelope with a mismatched nonce should be rejected")
+	}
+	if _, err := ParseSignedTransaction(emptyTrans); err == nil {
+		t.Error("unsigned envelope should not parse as signed")
+	}
+
+	sig, _ := SignTransaction(unsigned.Hash, privateKey)
+	signedTrans, pass := VerifyAndCombineTransaction(emptyTrans, unsigned.Hash, signerPublicKey, hex.EncodeToString(sig))
+	if !pass {
+		t.Fatal("verify failed")
+	}
+	signed, err := ParseSignedTransaction(signedTrans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonData, err = json.Marshal(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseSignedTransaction(string(jsonData)); err != nil {
+		t.Error(err)
+	}
+
+	txid, err := signed.TxID()
+	if decoded, _ := nearKey.Decode(txid, nearKey.BitcoinAlphabet); err != nil || hex.EncodeToString(decoded) != unsigned.Hash {
+		t.Errorf("wrong txid %s %v", txid, err)
+	}
+
+	signedBytes, _ := signed.SignedBytes()
+	if !bytes.Equal(signedBytes, append(append(append([]byte{}, unsigned.TxBytes...), KeyTypeED25519), sig...)) {
+		t.Error("wrong signed transaction bytes")
+	}
+
+	sig[0] ^= 0xff
+	if _, pass := VerifyAndCombineTransaction(emptyTrans, unsigned.Hash, signerPublicKey, hex.EncodeToString(sig)); pass {
+		t.Error("bad signature should not verify")
+	}
+}
+
+func TestTransactionBuilder(t *testing.T) {
+	signerPublicKey := "bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e"
+	blockHash := "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu"
+	pub, _ := NewPublicKey(signerPublicKey)
+	amount, _ := ParseNEAR("1")
+
+	ts, err := NewTransactionBuilder("sender.testnet", signerPublicKey).Nonce(3).Receiver("new.sender.testnet").BlockHash(blockHash).
+		CreateAccount().Transfer(amount).AddKey(pub, NewFullAccessKey(0)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect, _ := NewTxStruct("sender.testnet", signerPublicKey, 3, "new.sender.testnet", blockHash,
+		NewCreateAccountAction(), NewTransferAction(amount), NewAddKeyAction(pub, NewFullAccessKey(0)))
+	tsBytes, _ := ts.ToBytes()
+	expectBytes, _ := expect.ToBytes()
+	if !bytes.Equal(tsBytes, expectBytes) {
+		t.Error("builder output differs from NewTxStruct")
+	}
+
+	invalid := map[string]*TransactionBuilder{
+		"no action":         NewTransactionBuilder("sender.testnet", signerPublicKey).Receiver("receiver.testnet").BlockHash(blockHash),
+		"no receiver":       NewTransactionBuilder("sender.testnet", signerPublicKey).BlockHash(blockHash).Transfer(amount),
+		"no block hash":     NewTransactionBuilder("sender.testnet", signerPublicKey).Receiver("receiver.testnet").Transfer(amount),
+		"late create":       NewTransactionBuilder("sender.testnet", signerPublicKey).Receiver("new.sender.testnet").BlockHash(blockHash).Transfer(amount).CreateAccount(),
+		"early delete":      NewTransactionBuilder("sender.testnet", signerPublicKey).Receiver("sender.testnet").BlockHash(blockHash).DeleteAccount("receiver.testnet").Transfer(amount),
+		"foreign add key":   NewTransactionBuilder("sender.testnet", signerPublicKey).Receiver("receiver.testnet").BlockHash(blockHash).AddKey(pub, NewFullAccessKey(0)),
+		"invalid recipient": NewTransactionBuilder("sender.testnet", signerPublicKey).Receiver("sender.testnet").BlockHash(blockHash).DeleteAccount("Invalid!"),
+	}
+	for name, b := range invalid {
+		if _, err := b.Build(); err == nil {
+			t.Errorf("%s: expect error", name)
+		}
+	}
+
+	if _, err := NewTransactionBuilder("sender.testnet", signerPublicKey).Receiver("receiver.testnet").BlockHash(blockHash).
+		FunctionCall("ft_transfer", []byte("{}"), 30000000000000, YoctoFromUint64(1)).Transfer(amount).Build(); err != nil {
+		t.Errorf("calls to a foreign account should be allowed: %v", err)
+	}
+}
+
+func TestSecp256k1Transaction(t *testing.T) {
+	privateKey, _ := hex.DecodeString("e0c0c1a43f521f32c05a647a3595304c4992c9344f03eb66b61c796052001775")
+	uncompressed, _ := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_SECP256K1)
+	compressed := owcrypt.PointCompress(append([]byte{0x04}, uncompressed...), owcrypt.ECC_CURVE_SECP256K1)
+
+	for _, key := range []string{hex.EncodeToString(uncompressed), "04" + hex.EncodeToString(uncompressed), hex.EncodeToString(compressed)} {
+		pub, err := NewPublicKey(key)
+		if err != nil || pub.KeyType != KeyTypeSECP256K1 || !bytes.Equal(pub.Key, uncompressed) {
+			t.Fatalf("parse secp256k1 key %s failed: %v", key, err)
+		}
+	}
+
+	signerPublicKey := hex.EncodeToString(compressed)
+	ts, err := NewTxStruct("sender.testnet", signerPublicKey, 1, "receiver.testnet", "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu",
+		NewTransferAction(YoctoFromUint64(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	txBytes, _ := ts.ToBytes()
+	if !bytes.Equal(txBytes[18:18+65], append([]byte{KeyTypeSECP256K1}, uncompressed...)) {
+		t.Errorf("wrong signer public key encoding: %x", txBytes[18:18+65])
+	}
+
+	emptyTrans, hash, err := ts.CreateEmptyTransactionAndHash(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := SignTransactionWithKeyType(hash, privateKey, KeyTypeSECP256K1)
+	if err != nil || len(sig) != 65 {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	signedTrans, pass := VerifyAndCombineTransaction(emptyTrans, hash, signerPublicKey, hex.EncodeToString(sig))
+	if !pass {
+		t.Fatal("verify failed")
+	}
+	signed, err := DecodeSignedTransaction(signedTrans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Signature.KeyType != KeyTypeSECP256K1 || !bytes.Equal(signed.Signature.Data, sig) {
+		t.Error("wrong signature")
+	}
+
+	// the JSON envelope carries the key type in the public key prefix
+	envelope, err := ParseSignedTransaction(signedTrans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonData, _ := json.Marshal(envelope)
+	fromJSON, err := ParseSignedTransaction(string(jsonData))
+	if err != nil || !strings.Contains(string(jsonData), `"public_key":"secp256k1:`) ||
+		fromJSON.PublicKey.KeyType != KeyTypeSECP256K1 || fromJSON.Signature.KeyType != KeyTypeSECP256K1 {
+		t.Errorf("secp256k1 envelope JSON round trip failed: %s %v", jsonData, err)
+	}
+
+	if _, pass := VerifyAndCombineTransaction(emptyTrans, hash, signerPublicKey, hex.EncodeToString(sig[:64])); pass {
+		t.Error("signature without recovery id should be rejected")
+	}
+	edSig, _ := SignTransaction(hash, privateKey)
+	if _, pass := VerifyAndCombineTransaction(emptyTrans, hash, signerPublicKey, hex.EncodeToString(edSig)); pass {
+		t.Error("ed25519 signature should not verify against a secp256k1 key")
+	}
+}
+
+func TestDelegateAction(t *testing.T) {
+	userPublicKey := "bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e"
+	userPrivateKey, _ := hex.DecodeString("e0c0c1a43f521f32c05a647a3595304c4992c9344f03eb66b61c796052001775")
+	blockHash := "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu"
+
+	d, err := NewDelegateAction("user.testnet", userPublicKey, 5, "token.testnet", 1000,
+		NewFunctionCallAction("ft_transfer", []byte(`{"receiver_id":"bob.testnet","amount":"1"}`), 30000000000000, YoctoFromUint64(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the signed message is prefixed with 2^30 + 366 as a little endian u32
+	dBytes, _ := d.ToBytes()
+	hash, _ := d.Hash()
+	expect := owcrypt.Hash(append([]byte{0x6e, 0x01, 0x00, 0x40}, dBytes...), 0, owcrypt.HASH_ALG_SHA256)
+	if hash != hex.EncodeToString(expect) {
+		t.Errorf("wrong delegate action hash %s", hash)
+	}
+
+	signed, err := d.Sign(userPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := signed.ToBytes()
+	decoded, err := DecodeSignedDelegate(data)
+	if err != nil || !decoded.Verify() || decoded.DelegateAction.MaxBlockHeight != 1000 {
+		t.Fatalf("signed delegate round trip failed: %v", err)
+	}
+
+	ts, err := NewRelayerTransaction("relayer.testnet", userPublicKey, 9, blockHash, decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ts.Receiver.ID) != "user.testnet" || len(ts.Actions) != 1 || ts.Actions[0].ActionType != ActionDelegate {
+		t.Error("wrong relayer transaction")
+	}
+	tsBytes, _ := ts.ToBytes()
+	relayed, err := DecodeTransactionBytes(tsBytes, false)
+	if err != nil || !relayed.Actions[0].Delegate.Verify() {
+		t.Errorf("relayer transaction round trip failed: %v", err)
+	}
+
+	if _, err := NewTransactionBuilder("relayer.testnet", userPublicKey).Receiver("other.testnet").BlockHash(blockHash).
+		Delegate(signed).Build(); err == nil {
+		t.Error("delegate sent to another account than its sender should be rejected")
+	}
+	if _, err := NewDelegateAction("user.testnet", userPublicKey, 6, "user.testnet", 1000, NewSignedDelegateAction(signed)); err == nil {
+		t.Error("nested delegate action should be rejected")
+	}
+	pub, _ := NewPublicKey(userPublicKey)
+	if _, err := NewDelegateAction("user.testnet", userPublicKey, 6, "token.testnet", 1000, NewAddKeyAction(pub, NewFullAccessKey(0))); err == nil {
+		t.Error("adding a key to a foreign account should be rejected")
+	}
+
+	signed.DelegateAction.Nonce++
+	if signed.Verify() {
+		t.Error("modified delegate action should not verify")
+	}
+	if _, err := NewRelayerTransaction("relayer.testnet", userPublicKey, 9, blockHash, signed); err == nil {
+		t.Error("relayer should reject a bad signature")
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	privateKey, _ := hex.DecodeString("e0c0c1a43f521f32c05a647a3595304c4992c9344f03eb66b61c796052001775")
+	nonce := bytes.Repeat([]byte{0x01}, 32)
+
+	payload, err := NewMessagePayload("login", nonce, "myapp.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tag 2^31 + 413 as a little endian u32, then message, nonce, recipient and the absent callback url
+	data := append([]byte{0x9d, 0x01, 0x00, 0x80}, 5, 0, 0, 0)
+	data = append(data, "login"...)
+	data = append(data, nonce...)
+	data = append(data, 9, 0, 0, 0)
+	data = append(data, "myapp.com"...)
+	data = append(data, 0)
+	hash, _ := payload.Hash()
+	if hash != hex.EncodeToString(owcrypt.Hash(data, 0, owcrypt.HASH_ALG_SHA256)) {
+		t.Errorf("wrong message hash %s", hash)
+	}
+
+	signed, err := SignMessage(payload, "alice.testnet", privateKey, KeyTypeED25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := NewPublicKey("bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e")
+	if signed.PublicKey != pub.String() || !strings.HasPrefix(signed.PublicKey, "ed25519:") {
+		t.Errorf("wrong public key %s", signed.PublicKey)
+	}
+	if err := VerifyMessage(payload, signed); err != nil {
+		t.Error(err)
+	}
+
+	withCallback, _ := NewMessagePayload("login", nonce, "myapp.com", "https://myapp.com/callback")
+	if err := VerifyMessage(withCallback, signed); err == nil {
+		t.Error("signature should not verify for another payload")
+	}
+
+	secpSigned, err := SignMessage(payload, "alice.testnet", privateKey, KeyTypeSECP256K1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncompressed, _ := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_SECP256K1)
+	secpPub := &PublicKey{KeyType: KeyTypeSECP256K1, Key: uncompressed}
+	if secpSigned.PublicKey != secpPub.String() || !strings.HasPrefix(secpSigned.PublicKey, "secp256k1:") {
+		t.Errorf("wrong secp256k1 public key %s", secpSigned.PublicKey)
+	}
+	if sig, _ := base64.StdEncoding.DecodeString(secpSigned.Signature); len(sig) != 65 {
+		t.Errorf("secp256k1 signature should be r || s || v, got %d bytes", len(sig))
+	}
+	if err := VerifyMessage(payload, secpSigned); err != nil {
+		t.Error(err)
+	}
+	if err := VerifyMessage(withCallback, secpSigned); err == nil {
+		t.Error("secp256k1 signature should not verify for another payload")
+	}
+	mixed := *secpSigned
+	mixed.Signature = signed.Signature
+	if err := VerifyMessage(payload, &mixed); err == nil {
+		t.Error("ed25519 signature should not verify against a secp256k1 key")
+	}
+
+	if _, err := NewMessagePayload("login", nonce[:31], "myapp.com", ""); err == nil {
+		t.Error("short nonce should be rejected")
+	}
+}
+
+func TestFunctionCallAccessKey(t *testing.T) {
+	one := YoctoFromUint64(1)
+	key, err := NewFunctionCallAccessKey(0, &one, "a.testnet", "ft_transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := borsh.Serialize(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "0000000000000000" + "00" + "01" + "01000000000000000000000000000000" +
+		"09000000" + hex.EncodeToString([]byte("a.testnet")) +
+		"01000000" + "0b000000" + hex.EncodeToString([]byte("ft_transfer"))
+	if hex.EncodeToString(data) != expect {
+		t.Errorf("expect %s\ngot    %s", expect, hex.EncodeToString(data))
+	}
+
+	var decoded AccessKey
+	if err := borsh.Deserialize(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Permission.PermissionType != PermissionFunctionCall || decoded.Permission.FunctionCall.Allowance.Cmp(one) != 0 ||
+		decoded.Permission.FunctionCall.MethodNames[0] != "ft_transfer" {
+		t.Errorf("wrong decoded key %+v", decoded)
+	}
+	if decoded.IsFullAccess() || decoded.Allowance().Cmp(one) != 0 || decoded.ReceiverID() != "a.testnet" ||
+		len(decoded.MethodNames()) != 1 || decoded.MethodNames()[0] != "ft_transfer" {
+		t.Errorf("wrong key accessors %+v", decoded)
+	}
+	if full := NewFullAccessKey(3); !full.IsFullAccess() || full.Allowance() != nil || full.ReceiverID() != "" || full.MethodNames() != nil {
+		t.Errorf("wrong full access key accessors %+v", full)
+	}
+
+	unlimited, _ := NewFunctionCallAccessKey(0, nil, "a.testnet")
+	data, _ = borsh.Serialize(unlimited)
+	if hex.EncodeToString(data) != "0000000000000000"+"00"+"00"+"09000000"+hex.EncodeToString([]byte("a.testnet"))+"00000000" {
+		t.Errorf("wrong unlimited key encoding %x", data)
+	}
+
+	views := map[string]*AccessKey{
+		`{"nonce":85,"permission":"FullAccess","block_height":1,"block_hash":"x"}`:                                             {Nonce: 85, Permission: AccessKeyPermission{PermissionType: PermissionFullAccess}},
+		`{"nonce":0,"permission":{"FunctionCall":{"allowance":"1","receiver_id":"a.testnet","method_names":["ft_transfer"]}}}`: key,
+		`{"nonce":0,"permission":{"FunctionCall":{"allowance":null,"receiver_id":"a.testnet","method_names":[]}}}`:             unlimited,
+	}
+	for view, expect := range views {
+		k, err := ParseAccessKey([]byte(view))
+		if err != nil {
+			t.Errorf("%s: %v", view, err)
+			continue
+		}
+		got, _ := borsh.Serialize(k)
+		want, _ := borsh.Serialize(expect)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: wrong access key %+v", view, k)
+		}
+		jsonData, _ := json.Marshal(k)
+		if k2, err := ParseAccessKey(jsonData); err != nil || k2.Nonce != k.Nonce {
+			t.Errorf("%s: json round trip failed: %v", jsonData, err)
+		}
+	}
+	if _, err := ParseAccessKey([]byte(`{"nonce":0,"permission":"NoAccess"}`)); err == nil {
+		t.Error("unknown permission should be rejected")
+	}
+
+	pub, _ := NewPublicKey("bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e")
+	if _, err := NewTxStruct("sender.testnet", "bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e", 1, "sender.testnet",
+		"4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu", NewAddKeyAction(pub, key)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEstimateFee(t *testing.T) {
+	protocolConfig := `{"runtime_config":{"transaction_costs":{
+		"action_receipt_creation_config":{"send_sir":100,"send_not_sir":101,"execution":102},
+		"action_creation_config":{
+			"create_account_cost":{"send_sir":10,"send_not_sir":11,"execution":12},
+			"function_call_cost":{"send_sir":20,"send_not_sir":21,"execution":22},
+			"function_call_cost_per_byte":{"send_sir":1,"send_not_sir":2,"execution":3},
+			"transfer_cost":{"send_sir":30,"send_not_sir":31,"execution":32},
+			"add_key_cost":{
+				"full_access_cost":{"send_sir":40,"send_not_sir":41,"execution":42},
+				"function_call_cost":{"send_sir":50,"send_not_sir":51,"execution":52},
+				"function_call_cost_per_byte":{"send_sir":1,"send_not_sir":1,"execution":1}
+			}
+		}
+	}}}`
+	cfg, err := ParseRuntimeFeesConfig([]byte(protocolConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signerPublicKey := "bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e"
+	blockHash := "4EZn16JrHvB52A8G4JzkYn6RgDRt8z9FcLGYftb8QUFu"
+
+	// transfer to a NEAR-implicit account also pays for its creation and its full access key
+	ts, _ := NewTxStruct("sender.testnet", signerPublicKey, 1, signerPublicKey, blockHash, NewTransferAction(YoctoFromUint64(5)))
+	estimate, err := cfg.EstimateFee(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.SendGas != 101+31+11+41 || estimate.ExecGas != 102+32+12+42 || estimate.AttachedGas != 0 {
+		t.Errorf("wrong implicit transfer estimate %+v", estimate)
+	}
+	// an ETH-implicit account is created without an access key
+	ts, _ = NewTxStruct("sender.testnet", signerPublicKey, 1, "0xb794f5ea0ba39494ce839613fffba74279579268", blockHash, NewTransferAction(YoctoFromUint64(5)))
+	if estimate, err = cfg.EstimateFee(ts); err != nil || estimate.SendGas != 101+31+11 || estimate.ExecGas != 102+32+12 {
+		t.Errorf("wrong eth-implicit transfer estimate %+v, %v", estimate, err)
+	}
+
+	key, _ := NewFunctionCallAccessKey(0, nil, "a.testnet", "ab", "c")
+	pub, _ := NewPublicKey(signerPublicKey)
+	ts, _ = NewTxStruct("sender.testnet", signerPublicKey, 1, "sender.testnet", blockHash,
+		NewFunctionCallAction("ab", []byte("xyz"), 1000, YoctoFromUint64(7)),
+		NewAddKeyAction(pub, key))
+	estimate, err = cfg.EstimateFee(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// function call: base + 5 bytes of method and args, add key: base + 5 bytes of method names with separators
+	if estimate.SendGas != 100+20+5*1+50+5 || estimate.ExecGas != 102+22+5*3+52+5 || estimate.AttachedGas != 1000 {
+		t.Errorf("wrong function call estimate %+v", estimate)
+	}
+	gasPrice := big.NewInt(100000000)
+	if estimate.Burnt(gasPrice).Int64() != int64(estimate.Gas())*100000000 ||
+		estimate.MaxCost(gasPrice).Int64() != int64(estimate.Gas()+1000)*100000000+7 {
+		t.Errorf("wrong cost %s %s", estimate.Burnt(gasPrice), estimate.MaxCost(gasPrice))
+	}
+
+	if _, err := ParseRuntimeFeesConfig([]byte(`{"foo":1}`)); err == nil {
+		t.Error("config without fees should be rejected")
+	}
+}
+
+func TestParseProtocolConfig(t *testing.T) {
+	data := `{"protocol_version":63,"chain_id":"testnet","epoch_length":43200,"min_gas_price":"100000000",
+		"runtime_config":{"storage_amount_per_byte":"10000000000000000000","transaction_costs":{
+			"action_receipt_creation_config":{"send_sir":100,"send_not_sir":101,"execution":102},
+			"action_creation_config":{"transfer_cost":{"send_sir":30,"send_not_sir":31,"execution":32}}
+		}}}`
+	cfg, err := ParseProtocolConfig([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ProtocolVersion != 63 || cfg.ChainID != "testnet" || cfg.EpochLength != 43200 || cfg.MinGasPrice.YoctoString() != "100000000" {
+		t.Errorf("wrong protocol config %+v", cfg)
+	}
+	if cfg.StorageCost(100).String() != "1000000000000000000000" {
+		t.Errorf("wrong storage cost %s", cfg.StorageCost(100))
+	}
+
+	estimate, err := cfg.TransactionCosts.EstimateActionsFee("sender.testnet", "receiver.testnet", NewTransferAction(YoctoFromUint64(5)))
+	if err != nil || estimate.SendGas != 101+31 || estimate.ExecGas != 102+32 || estimate.Deposit.Int64() != 5 {
+		t.Errorf("wrong transfer estimate %+v, %v", estimate, err)
+	}
+
+	if _, err := ParseProtocolConfig([]byte(`{"runtime_config":{"storage_amount_per_byte":"1"}}`)); err == nil {
+		t.Error("config without transaction costs should be rejected")
+	}
+}
+
+func TestValidateAccountID(t *testing.T) {
+	valid := []string{"aa", "a-a", "a_b.c", "near", "alice.near", "app.alice.near", "0x", "10-4.8-2", "b-o_w_e-n",
+		"bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e",
+		strings.Repeat("a", 64)}
+	for _, id := range valid {
+		if err := ValidateAccountID(id); err != nil {
+			t.Errorf("%s: %v", id, err)
+		}
+	}
+
+	invalid := map[string]AccountIDErrorReason{
+		"a":                     AccountIDTooShort,
+		strings.Repeat("a", 65): AccountIDTooLong,
+		"Alice.near":            AccountIDInvalidChar,
+		"alice near":            AccountIDInvalidChar,
+		"alice@near":            AccountIDInvalidChar,
+		"-alice":                AccountIDRedundantSeparator,
+		"alice.":                AccountIDRedundantSeparator,
+		"alice..near":           AccountIDRedundantSeparator,
+		"a-_b":                  AccountIDRedundantSeparator,
+	}
+	for id, reason := range invalid {
+		err := ValidateAccountID(id)
+		if e, ok := err.(*AccountIDError); !ok || e.Reason != reason {
+			t.Errorf("%s: expect %s, got %v", id, reason, err)
+		}
+	}
+
+	types := map[string]AccountType{
+		"alice.near": NamedAccount,
+		"bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e": NearImplicitAccount,
+		"0xb794f5ea0ba39494ce839613fffba74279579268":                       EthImplicitAccount,
+		"0xb794f5ea0ba39494ce839613fffba7427957926":                        NamedAccount,
+	}
+	for id, accountType := range types {
+		if GetAccountType(id) != accountType {
+			t.Errorf("%s: wrong account type %d", id, GetAccountType(id))
+		}
+	}
+
+	if !IsSubAccountOf("app.alice.near", "alice.near") || IsSubAccountOf("x.app.alice.near", "alice.near") || IsSubAccountOf("malice.near", "alice.near") {
+		t.Error("wrong sub-account check")
+	}
+	if err := CheckCreateAccount("alice.near", "app.alice.near"); err != nil {
+		t.Error(err)
+	}
+	if err, ok := CheckCreateAccount("alice.near", "app.bob.near").(*AccountIDError); !ok || err.Reason != AccountIDNotSubAccount {
+		t.Errorf("expect not sub-account, got %v", err)
+	}
+	if err, ok := CheckCreateAccount("alice.near", "short").(*AccountIDError); !ok || err.Reason != AccountIDTopLevelTooShort {
+		t.Errorf("expect top-level too short, got %v", err)
+	}
+	for _, implicit := range []string{"bc7bc2614fafe07798872abc0e25770f393e10c1a893f96cdf2890ce290bc35e", "0xb794f5ea0ba39494ce839613fffba74279579268"} {
+		if err, ok := CheckCreateAccount("alice.near", implicit).(*AccountIDError); !ok || err.Reason != AccountIDImplicit {
+			t.Errorf("expect implicit account, got %v", err)
+		}
+	}
+}
+
+func TestYoctoAmount(t *testing.T) {
+	parsed := map[string]string{
+		"1":                          "1000000000000000000000000",
+		"1.5":                        "1500000000000000000000000",
+		"1.5 NEAR":                   "1500000000000000000000000",
+		"0.000000000000000000000001": "1",
+		"0":                          "0",
+		"1000 yoctoNEAR":             "1000",
+		"340282366920938463463374607431768211455 yoctoNEAR": "340282366920938463463374607431768211455",
+	}
+	for s, expect := range parsed {
+		a, err := ParseAmount(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if a.YoctoString() != expect {
+			t.Errorf("%s: expect %s, got %s", s, expect, a.YoctoString())
+		}
+	}
+
+	invalid := []string{"", "-1", "1.", ".5", "1,5", "1e3", "0x10", "1.0000000000000000000000001", "1.5 yoctoNEAR",
+		"340282366920938463463374607431768211456 yoctoNEAR"}
+	for _, s := range invalid {
+		if _, err := ParseAmount(s); err == nil {
+			t.Errorf("%s: expect error", s)
+		}
+	}
+
+	a, _ := ParseNEAR("1.23456789")
+	if a.String() != "1.23456789" || a.Format(4) != "1.2345" || a.Format(0) != "1" || YoctoFromUint64(1).Format(2) != "0.00" {
+		t.Errorf("wrong format %s %s %s", a.String(), a.Format(4), a.Format(0))
+	}
+
+	max, _ := ParseYocto("340282366920938463463374607431768211455")
+	if _, err := max.Add(YoctoFromUint64(1)); err != ErrAmountOverflow {
+		t.Errorf("expect overflow, got %v", err)
+	}
+	if _, err := YoctoFromUint64(1).Sub(YoctoFromUint64(2)); err != ErrAmountUnderflow {
+		t.Errorf("expect underflow, got %v", err)
+	}
+	if _, err := NewYoctoAmount(new(big.Int).Lsh(big.NewInt(1), 128)); err != ErrAmountOverflow {
+		t.Error("amount wider than u128 should be rejected")
+	}
+
+	data, err := borsh.Serialize(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded YoctoAmount
+	if err := borsh.Deserialize(data, &decoded); err != nil || len(data) != 16 || decoded.Cmp(a) != 0 {
+		t.Errorf("borsh round trip failed: %x %v", data, err)
+	}
+
+	js, _ := json.Marshal(a)
+	if string(js) != `"1234567890000000000000000"` {
+		t.Errorf("wrong json %s", js)
+	}
+	if err := json.Unmarshal([]byte(`"1.5"`), &decoded); err == nil {
+		t.Error("json amount must be in yoctoNEAR")
+	}
+}
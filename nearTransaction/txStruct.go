@@ -3,134 +3,135 @@ package nearTransaction
 import (
 	"encoding/hex"
 	"errors"
-	"math/big"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/near-adapter/borsh"
+	"github.com/blocktree/near-adapter/nearKey"
 )
 
 type Account struct {
-	Length []byte
-	ID     []byte
+	ID []byte
 }
 
 func NewAccount(ID string) *Account {
-	//if len(ID) == 32{
-	//	idBytes, _ := hex.DecodeString(ID)
-	//	return &Account{
-	//		Length: uint32ToLittleEndianBytes(64),
-	//		ID:     idBytes,
-	//	}
-	//}
-	return &Account{
-		Length: uint32ToLittleEndianBytes(uint32(len(ID))),
-		ID:     []byte(ID),
-	}
+	return &Account{ID: []byte(ID)}
 }
 
-func (a *Account) ToBytes () []byte {return append(a.Length, a.ID...)}
-
-type PublicKey struct {
-	KeyType byte
-	Key     []byte
+func (a *Account) MarshalBorsh(e *borsh.Encoder) error {
+	e.WriteBytes(a.ID)
+	return nil
 }
 
-func NewPublicKey(key string) (*PublicKey, error) {
-	if len(key) != 64 {
-		return nil, errors.New("public key length error")
-	}
-
-	keyBytes, err := hex.DecodeString(key)
+func (a *Account) UnmarshalBorsh(d *borsh.Decoder) error {
+	id, err := d.ReadString()
 	if err != nil {
-		return nil, errors.New("invalid public key")
+		return err
 	}
-
-	return &PublicKey{
-		KeyType: KeyTypeED25519,
-		Key:     keyBytes,
-	}, nil
+	*a = *NewAccount(id)
+	return nil
 }
 
-func (p *PublicKey) ToBytes () []byte {return append([]byte{p.KeyType}, p.Key...)}
+// PublicKey is a NEAR public key, see nearKey.PublicKey
+type PublicKey = nearKey.PublicKey
 
-type Action struct {
-	ActionType byte
-	Amount     []byte
+// NewPublicKey parses a hex public key, see nearKey.NewPublicKey
+func NewPublicKey(key string) (*PublicKey, error) {
+	return nearKey.NewPublicKey(key)
 }
 
-func NewAmount(bigAmount *big.Int) []byte {
-	amount := reverseBytes(bigAmount.Bytes())
+// ParsePublicKey parses "ed25519:<base58>", "secp256k1:<base58>" or a hex key, see nearKey.ParsePublicKey
+func ParsePublicKey(key string) (*PublicKey, error) {
+	return nearKey.ParsePublicKey(key)
+}
 
-	offset := 16 - len(amount)
+type Action struct {
+	ActionType     byte `borsh:"enum"`
+	CreateAccount  *CreateAccountAction
+	DeployContract *DeployContractAction
+	FunctionCall   *FunctionCallAction
+	Transfer       *TransferAction
+	Stake          *StakeAction
+	AddKey         *AddKeyAction
+	DeleteKey      *DeleteKeyAction
+	DeleteAccount  *DeleteAccountAction
+	Delegate       *SignedDelegate
+}
 
-	for i := 0; i < offset; i ++ {
-		amount = append(amount, 0)
+func (a *Action) check() error {
+	if a.ActionType == ActionDelegate && a.Delegate != nil {
+		if err := a.Delegate.DelegateAction.check(); err != nil {
+			return err
+		}
 	}
-
-	return amount
+	_, err := borsh.Serialize(a)
+	return err
 }
 
-func (a *Action) ToBytes () []byte {return append([]byte{a.ActionType}, a.Amount...)}
-
 type TxStruct struct {
-	Signer *Account
+	Signer          *Account
 	SignerPublicKey *PublicKey
-	Nonce []byte
-	Receiver *Account
-	BlockHash []byte
-	Actions []Action
+	Nonce           uint64
+	Receiver        *Account
+	BlockHash       [32]byte
+	Actions         []Action
+	// only set on transactions decoded from the signed form
+	Signature *Signature `borsh:"skip"`
 }
 
-func (tx *Transfer) NewTxStruct() (*TxStruct, error) {
+func NewTxStruct(signerID, signerPublicKey string, nonce uint64, receiverID, recentBlockHash string, actions ...Action) (*TxStruct, error) {
 	var ts TxStruct
-	if !IsValid(tx.SignerID) {
-		return nil, errors.New("invalid signer ID")
+	if err := ValidateAccountID(signerID); err != nil {
+		return nil, err
 	}
-	ts.Signer = NewAccount(tx.SignerID)
+	ts.Signer = NewAccount(signerID)
 
-	publicKey, err := NewPublicKey(tx.SignerPublicKey)
+	publicKey, err := NewPublicKey(signerPublicKey)
 	if err != nil {
 		return nil, err
 	}
 	ts.SignerPublicKey = publicKey
 
-	ts.Nonce = uint64ToLittleEndianBytes(tx.Nonce)
+	ts.Nonce = nonce
 
-	if !IsValid(tx.ReceiverID) {
-		return nil, errors.New("invalid receiver ID")
+	if err := ValidateAccountID(receiverID); err != nil {
+		return nil, err
 	}
-	ts.Receiver = NewAccount(tx.ReceiverID)
+	ts.Receiver = NewAccount(receiverID)
 
-	hashBytes, err := Decode(tx.RecentBlockHash, BitcoinAlphabet)
+	hashBytes, err := nearKey.Decode(recentBlockHash, nearKey.BitcoinAlphabet)
 	if err != nil || len(hashBytes) != 32 {
 		return nil, errors.New("invalid recent block hash")
 	}
-	ts.BlockHash = hashBytes
+	copy(ts.BlockHash[:], hashBytes)
 
-	if tx.AmountInYoctoN.Cmp(big.NewInt(0)) > 0 {
-		ts.Actions = append(ts.Actions, Action{
-			ActionType: ActionTransfer,
-			Amount:     NewAmount(tx.AmountInYoctoN),
-		})
+	for i := range actions {
+		if err := actions[i].check(); err != nil {
+			return nil, err
+		}
 	}
+	ts.Actions = actions
 
 	return &ts, nil
 }
 
-func (tx *TxStruct) ToBytes() []byte {
-	txBytes := make([]byte, 0)
-	txBytes = append(txBytes, tx.Signer.ToBytes()...)
-	txBytes = append(txBytes, tx.SignerPublicKey.ToBytes()...)
-	txBytes = append(txBytes, tx.Nonce...)
-	txBytes = append(txBytes, tx.Receiver.ToBytes()...)
-	txBytes = append(txBytes, tx.BlockHash...)
-
-	if tx.Actions == nil || len(tx.Actions) == 0 {
-		txBytes = append(txBytes, uint32ToLittleEndianBytes(1)...)
-		txBytes = append(txBytes, 0)
-	} else {
-		txBytes = append(txBytes, uint32ToLittleEndianBytes(uint32(len(tx.Actions)))...)
-		for _, action := range tx.Actions {
-			txBytes = append(txBytes, action.ToBytes()...)
-		}
+func (tx *Transfer) NewTxStruct() (*TxStruct, error) {
+	actions := make([]Action, 0)
+	if !tx.AmountInYoctoN.IsZero() {
+		actions = append(actions, NewTransferAction(tx.AmountInYoctoN))
 	}
 
-	return txBytes
-}
\ No newline at end of file
+	return NewTxStruct(tx.SignerID, tx.SignerPublicKey, tx.Nonce, tx.ReceiverID, tx.RecentBlockHash, actions...)
+}
+
+func (tx *TxStruct) ToBytes() ([]byte, error) {
+	return borsh.Serialize(tx)
+}
+
+// Hash returns the hex sha256 of the unsigned transaction, the message SignTransaction signs
+func (tx *TxStruct) Hash() (string, error) {
+	txBytes, err := tx.ToBytes()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(owcrypt.Hash(txBytes, 0, owcrypt.HASH_ALG_SHA256)), nil
+}
@@ -1,25 +0,0 @@
-package nearTransaction
-
-import "encoding/binary"
-
-//uint32ToLittleEndianBytes
-func uint32ToLittleEndianBytes(data uint32) []byte {
-	tmp := [4]byte{}
-	binary.LittleEndian.PutUint32(tmp[:], data)
-	return tmp[:]
-}
-
-//uint64ToLittleEndianBytes
-func uint64ToLittleEndianBytes(data uint64) []byte {
-	tmp := [8]byte{}
-	binary.LittleEndian.PutUint64(tmp[:], data)
-	return tmp[:]
-}
-
-//reverseBytes endian reverse
-func reverseBytes(s []byte) []byte {
-	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
-		s[i], s[j] = s[j], s[i]
-	}
-	return s
-}
\ No newline at end of file
@@ -0,0 +1,436 @@
+package neartest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
+)
+
+// GenesisHeight is the height of the first block of a new server
+const GenesisHeight = uint64(1)
+
+// finalityDepth is how many blocks on top make a transaction FINAL
+const finalityDepth = 2
+
+// Block is a block of the fake chain, with a single chunk
+type Block struct {
+	Height    uint64
+	Hash      string
+	PrevHash  string
+	ChunkHash string
+	// nanoseconds, like the RPC
+	Timestamp uint64
+	EpochID   string
+	GasPrice  *big.Int
+	Txs       []*Tx
+
+	// account state after the block, restored by Fork
+	state map[string]*account
+	// state changes of the block, in order
+	changes []*stateChange
+}
+
+// Tx is a transaction accepted by the server
+type Tx struct {
+	Hash     string
+	SignerID string
+	// the decoded transaction with its signature
+	Signed *nearTransaction.TxStruct
+	// set once the transaction is included
+	BlockHash   string
+	BlockHeight uint64
+	// the JSON of status.Failure, empty on success
+	Failure     string
+	TokensBurnt nearTransaction.YoctoAmount
+
+	hash []byte
+}
+
+// InvalidTxError is why a transaction is rejected before it is included,
+// Kind is the InvalidTxError variant the node reports, e.g. InvalidNonce
+type InvalidTxError struct {
+	Kind string
+	Info map[string]interface{}
+}
+
+func (e *InvalidTxError) Error() string {
+	return "invalid transaction: " + e.Kind
+}
+
+// json returns the InvalidTxError value of the RPC error, a bare string for variants without fields
+func (e *InvalidTxError) json() interface{} {
+	if e.Info == nil {
+		return e.Kind
+	}
+	return map[string]interface{}{e.Kind: e.Info}
+}
+
+type account struct {
+	amount nearTransaction.YoctoAmount
+	keys   map[string]*nearTransaction.AccessKey
+	// contract state, the values are never modified in place
+	storage map[string][]byte
+}
+
+func (a *account) clone() *account {
+	c := &account{amount: a.amount, keys: make(map[string]*nearTransaction.AccessKey, len(a.keys))}
+	for k, v := range a.keys {
+		key := *v
+		c.keys[k] = &key
+	}
+	if a.storage != nil {
+		c.storage = make(map[string][]byte, len(a.storage))
+		for k, v := range a.storage {
+			c.storage[k] = v
+		}
+	}
+	return c
+}
+
+func cloneState(state map[string]*account) map[string]*account {
+	c := make(map[string]*account, len(state))
+	for id, a := range state {
+		c[id] = a.clone()
+	}
+	return c
+}
+
+// hashOf returns a deterministic base58 hash for the fake chain objects
+func hashOf(parts ...interface{}) string {
+	return nearKey.Encode(owcrypt.Hash([]byte(fmt.Sprint(parts...)), 0, owcrypt.HASH_ALG_SHA256), nearKey.BitcoinAlphabet)
+}
+
+// decodeTx decodes a base64 signed transaction and returns it with its hash
+func decodeTx(signedTx string) (*nearTransaction.TxStruct, []byte, error) {
+	data, err := base64.StdEncoding.DecodeString(signedTx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ts, err := nearTransaction.DecodeTransactionBytes(data, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	txBytes, err := ts.ToBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	return ts, owcrypt.Hash(txBytes, 0, owcrypt.HASH_ALG_SHA256), nil
+}
+
+func verifySignature(ts *nearTransaction.TxStruct, hash []byte) bool {
+	pub, sig := ts.SignerPublicKey, ts.Signature
+	if pub == nil || sig == nil || pub.KeyType != sig.KeyType {
+		return false
+	}
+	switch pub.KeyType {
+	case nearKey.KeyTypeED25519:
+		return owcrypt.SUCCESS == owcrypt.Verify(pub.Key, nil, hash, sig.Data, owcrypt.ECC_CURVE_ED25519)
+	case nearKey.KeyTypeSECP256K1:
+		if len(sig.Data) != 65 {
+			return false
+		}
+		return owcrypt.SUCCESS == owcrypt.Verify(pub.Key, nil, hash, sig.Data[:64], owcrypt.ECC_CURVE_SECP256K1)
+	}
+	return false
+}
+
+// totalCost is the fee plus the deposits of a transaction
+func totalCost(ts *nearTransaction.TxStruct, fee nearTransaction.YoctoAmount) (nearTransaction.YoctoAmount, error) {
+	cost := fee
+	var err error
+	for _, a := range ts.Actions {
+		switch a.ActionType {
+		case nearTransaction.ActionTransfer:
+			cost, err = cost.Add(a.Transfer.Deposit)
+		case nearTransaction.ActionFunctionCall:
+			cost, err = cost.Add(a.FunctionCall.Deposit)
+		}
+		if err != nil {
+			return cost, err
+		}
+	}
+	return cost, nil
+}
+
+// checkTx runs the checks a node does before accepting a transaction against state
+func (s *Server) checkTx(ts *nearTransaction.TxStruct, hash []byte, state map[string]*account) *InvalidTxError {
+	signerID := string(ts.Signer.ID)
+	if !verifySignature(ts, hash) {
+		return &InvalidTxError{Kind: "InvalidSignature"}
+	}
+	if _, ok := s.byHash[nearKey.Encode(ts.BlockHash[:], nearKey.BitcoinAlphabet)]; !ok {
+		return &InvalidTxError{Kind: "Expired"}
+	}
+
+	signer, ok := state[signerID]
+	if !ok {
+		return &InvalidTxError{Kind: "SignerDoesNotExist", Info: map[string]interface{}{"signer_id": signerID}}
+	}
+	key, ok := signer.keys[ts.SignerPublicKey.String()]
+	if !ok {
+		return &InvalidTxError{Kind: "InvalidAccessKeyError", Info: map[string]interface{}{
+			"AccessKeyNotFound": map[string]interface{}{"account_id": signerID, "public_key": ts.SignerPublicKey.String()},
+		}}
+	}
+	if ts.Nonce <= key.Nonce {
+		return &InvalidTxError{Kind: "InvalidNonce", Info: map[string]interface{}{"tx_nonce": ts.Nonce, "ak_nonce": key.Nonce}}
+	}
+
+	cost, err := totalCost(ts, s.TxFee)
+	if err != nil || signer.amount.Cmp(cost) < 0 {
+		return &InvalidTxError{Kind: "NotEnoughBalance", Info: map[string]interface{}{
+			"signer_id": signerID, "balance": signer.amount.YoctoString(), "cost": cost.YoctoString(),
+		}}
+	}
+	return nil
+}
+
+// execute applies an accepted transaction to state, the fee and the nonce are kept when an action fails
+func (s *Server) execute(tx *Tx, state map[string]*account) {
+	ts := tx.Signed
+	signer := state[tx.SignerID]
+	signer.keys[ts.SignerPublicKey.String()].Nonce = ts.Nonce
+	signer.amount, _ = signer.amount.Sub(s.TxFee)
+	tx.TokensBurnt = s.TxFee
+
+	working := cloneState(state)
+	for i, a := range ts.Actions {
+		if kind := s.applyAction(tx, &a, working); kind != nil {
+			tx.Failure = mustJSON(map[string]interface{}{
+				"ActionError": map[string]interface{}{"index": i, "kind": kind},
+			})
+			return
+		}
+	}
+	for id := range state {
+		if _, ok := working[id]; !ok {
+			delete(state, id)
+		}
+	}
+	for id, a := range working {
+		state[id] = a
+	}
+}
+
+// applyAction returns the ActionError kind when the action fails
+func (s *Server) applyAction(tx *Tx, a *nearTransaction.Action, state map[string]*account) interface{} {
+	receiverID := string(tx.Signed.Receiver.ID)
+	receiver := state[receiverID]
+	signer := state[tx.SignerID]
+
+	switch a.ActionType {
+	case nearTransaction.ActionCreateAccount:
+		if receiver != nil {
+			return map[string]interface{}{"AccountAlreadyExists": map[string]interface{}{"account_id": receiverID}}
+		}
+		state[receiverID] = &account{keys: make(map[string]*nearTransaction.AccessKey)}
+	case nearTransaction.ActionTransfer:
+		amount, err := signer.amount.Sub(a.Transfer.Deposit)
+		if err != nil {
+			return map[string]interface{}{"LackBalanceForState": map[string]interface{}{"account_id": tx.SignerID}}
+		}
+		if receiver == nil {
+			if nearTransaction.GetAccountType(receiverID) == nearTransaction.NamedAccount {
+				return map[string]interface{}{"AccountDoesNotExist": map[string]interface{}{"account_id": receiverID}}
+			}
+			//transfers create implicit accounts, with the key of the account ID
+			receiver = &account{keys: make(map[string]*nearTransaction.AccessKey)}
+			if pub, err := nearKey.NewPublicKey(receiverID); err == nil && pub.KeyType == nearKey.KeyTypeED25519 {
+				receiver.keys[pub.String()] = nearTransaction.NewFullAccessKey(0)
+			}
+			state[receiverID] = receiver
+		}
+		signer.amount = amount
+		receiver.amount, _ = receiver.amount.Add(a.Transfer.Deposit)
+	case nearTransaction.ActionAddKey:
+		if receiver == nil {
+			return map[string]interface{}{"AccountDoesNotExist": map[string]interface{}{"account_id": receiverID}}
+		}
+		if _, ok := receiver.keys[a.AddKey.PublicKey.String()]; ok {
+			return map[string]interface{}{"AddKeyAlreadyExists": map[string]interface{}{
+				"account_id": receiverID, "public_key": a.AddKey.PublicKey.String(),
+			}}
+		}
+		key := *a.AddKey.AccessKey
+		receiver.keys[a.AddKey.PublicKey.String()] = &key
+	case nearTransaction.ActionDeleteKey:
+		if receiver == nil {
+			return map[string]interface{}{"AccountDoesNotExist": map[string]interface{}{"account_id": receiverID}}
+		}
+		if _, ok := receiver.keys[a.DeleteKey.PublicKey.String()]; !ok {
+			return map[string]interface{}{"DeleteKeyDoesNotExist": map[string]interface{}{
+				"account_id": receiverID, "public_key": a.DeleteKey.PublicKey.String(),
+			}}
+		}
+		delete(receiver.keys, a.DeleteKey.PublicKey.String())
+	case nearTransaction.ActionDeleteAccount:
+		if receiver == nil {
+			return map[string]interface{}{"AccountDoesNotExist": map[string]interface{}{"account_id": receiverID}}
+		}
+		if beneficiary := state[string(a.DeleteAccount.BeneficiaryID.ID)]; beneficiary != nil {
+			beneficiary.amount, _ = beneficiary.amount.Add(receiver.amount)
+		}
+		delete(state, receiverID)
+	case nearTransaction.ActionDeployContract:
+		if receiver == nil {
+			return map[string]interface{}{"AccountDoesNotExist": map[string]interface{}{"account_id": receiverID}}
+		}
+	case nearTransaction.ActionFunctionCall:
+		//the fake chain runs no contracts
+		return map[string]interface{}{"FunctionCallError": map[string]interface{}{
+			"CompilationError": map[string]interface{}{"CodeDoesNotExist": map[string]interface{}{"account_id": receiverID}},
+		}}
+	default:
+		return map[string]interface{}{"UnsupportedAction": map[string]interface{}{"action_type": a.ActionType}}
+	}
+	return nil
+}
+
+// actionJSON is the RPC view of an action
+func actionJSON(a *nearTransaction.Action) interface{} {
+	switch a.ActionType {
+	case nearTransaction.ActionCreateAccount:
+		return "CreateAccount"
+	case nearTransaction.ActionDeployContract:
+		return map[string]interface{}{"DeployContract": map[string]interface{}{"code": base64.StdEncoding.EncodeToString(a.DeployContract.Code)}}
+	case nearTransaction.ActionFunctionCall:
+		return map[string]interface{}{"FunctionCall": map[string]interface{}{
+			"method_name": a.FunctionCall.MethodName,
+			"args":        base64.StdEncoding.EncodeToString(a.FunctionCall.Args),
+			"gas":         a.FunctionCall.Gas,
+			"deposit":     a.FunctionCall.Deposit.YoctoString(),
+		}}
+	case nearTransaction.ActionTransfer:
+		return map[string]interface{}{"Transfer": map[string]interface{}{"deposit": a.Transfer.Deposit.YoctoString()}}
+	case nearTransaction.ActionStake:
+		return map[string]interface{}{"Stake": map[string]interface{}{
+			"stake": a.Stake.Stake.YoctoString(), "public_key": a.Stake.PublicKey.String(),
+		}}
+	case nearTransaction.ActionAddKey:
+		return map[string]interface{}{"AddKey": map[string]interface{}{
+			"public_key": a.AddKey.PublicKey.String(), "access_key": a.AddKey.AccessKey,
+		}}
+	case nearTransaction.ActionDeleteKey:
+		return map[string]interface{}{"DeleteKey": map[string]interface{}{"public_key": a.DeleteKey.PublicKey.String()}}
+	case nearTransaction.ActionDeleteAccount:
+		return map[string]interface{}{"DeleteAccount": map[string]interface{}{"beneficiary_id": string(a.DeleteAccount.BeneficiaryID.ID)}}
+	case nearTransaction.ActionDelegate:
+		return map[string]interface{}{"Delegate": map[string]interface{}{
+			"sender_id": string(a.Delegate.DelegateAction.SenderID.ID), "receiver_id": string(a.Delegate.DelegateAction.ReceiverID.ID),
+		}}
+	}
+	return "Unknown"
+}
+
+// txJSON is the transaction view of chunk and tx results
+func txJSON(tx *Tx) map[string]interface{} {
+	ts := tx.Signed
+	actions := make([]interface{}, 0, len(ts.Actions))
+	for i := range ts.Actions {
+		actions = append(actions, actionJSON(&ts.Actions[i]))
+	}
+	return map[string]interface{}{
+		"hash":        tx.Hash,
+		"signer_id":   tx.SignerID,
+		"public_key":  ts.SignerPublicKey.String(),
+		"nonce":       ts.Nonce,
+		"receiver_id": string(ts.Receiver.ID),
+		"actions":     actions,
+		"signature":   signatureString(ts.Signature),
+	}
+}
+
+func signatureString(sig *nearTransaction.Signature) string {
+	if sig == nil {
+		return ""
+	}
+	name := "ed25519"
+	if sig.KeyType == nearKey.KeyTypeSECP256K1 {
+		name = "secp256k1"
+	}
+	return name + ":" + nearKey.Encode(sig.Data, nearKey.BitcoinAlphabet)
+}
+
+// outcomeJSON is the result of tx, EXPERIMENTAL_tx_status and broadcast_tx_commit
+func (s *Server) outcomeJSON(tx *Tx, receipts bool) map[string]interface{} {
+	var status interface{} = map[string]interface{}{"SuccessValue": ""}
+	if tx.Failure != "" {
+		status = map[string]interface{}{"Failure": rawJSON(tx.Failure)}
+	}
+	receiptID := hashOf("receipt", tx.Hash)
+
+	executionStatus := "EXECUTED_OPTIMISTIC"
+	if s.head.Height >= tx.BlockHeight+finalityDepth {
+		executionStatus = "FINAL"
+	}
+
+	result := map[string]interface{}{
+		"final_execution_status": executionStatus,
+		"status":                 status,
+		"transaction":            txJSON(tx),
+		"transaction_outcome": map[string]interface{}{
+			"id":         tx.Hash,
+			"block_hash": tx.BlockHash,
+			"outcome": map[string]interface{}{
+				"executor_id":  tx.SignerID,
+				"gas_burnt":    0,
+				"tokens_burnt": tx.TokensBurnt.YoctoString(),
+				"receipt_ids":  []string{receiptID},
+				"status":       map[string]interface{}{"SuccessReceiptId": receiptID},
+			},
+		},
+		"receipts_outcome": []interface{}{
+			map[string]interface{}{
+				"id":         receiptID,
+				"block_hash": tx.BlockHash,
+				"outcome": map[string]interface{}{
+					"executor_id":  string(tx.Signed.Receiver.ID),
+					"gas_burnt":    0,
+					"tokens_burnt": "0",
+					"receipt_ids":  []string{},
+					"status":       status,
+				},
+			},
+		},
+	}
+	if receipts {
+		result["receipts"] = []interface{}{}
+	}
+	return result
+}
+
+// blockByID finds a block by a height or a hash, nil for missing heights
+func (s *Server) blockByID(id interface{}) *Block {
+	switch v := id.(type) {
+	case float64:
+		return s.blocks[uint64(v)]
+	case string:
+		if height, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return s.blocks[height]
+		}
+		return s.byHash[v]
+	}
+	return nil
+}
+
+// SignTransaction signs ts with privateKey and returns the base64 signed transaction the broadcast methods take
+func SignTransaction(ts *nearTransaction.TxStruct, privateKey []byte) (string, error) {
+	unsigned, err := ts.NewUnsignedTransaction(0)
+	if err != nil {
+		return "", err
+	}
+	sig, err := nearTransaction.SignTransactionWithKeyType(unsigned.Hash, privateKey, ts.SignerPublicKey.KeyType)
+	if err != nil {
+		return "", err
+	}
+	signed := &nearTransaction.SignedTransaction{
+		UnsignedTransaction: *unsigned,
+		Signature:           &nearTransaction.Signature{KeyType: ts.SignerPublicKey.KeyType, Data: sig},
+	}
+	return signed.Base64()
+}
@@ -0,0 +1,224 @@
+package neartest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blocktree/near-adapter/nearTransaction"
+)
+
+// stateChange is a change of the account state in a block, as EXPERIMENTAL_changes reports it
+type stateChange struct {
+	accountID string
+	// account_update, access_key_deletion, data_update ...
+	kind   string
+	cause  map[string]interface{}
+	change map[string]interface{}
+	// data key of data changes, public key of access key changes
+	key string
+}
+
+func (c *stateChange) json() map[string]interface{} {
+	return map[string]interface{}{"cause": c.cause, "type": c.kind, "change": c.change}
+}
+
+// touched is the change type of EXPERIMENTAL_changes_in_block, e.g. account_touched
+func (c *stateChange) touched() string {
+	switch c.kind {
+	case "account_update", "account_deletion":
+		return "account_touched"
+	case "access_key_update", "access_key_deletion":
+		return "access_key_touched"
+	}
+	return "data_touched"
+}
+
+// validatorCause is the cause of the changes tests make between blocks, reported like staking rewards
+func validatorCause(string) map[string]interface{} {
+	return map[string]interface{}{"type": "validator_accounts_update"}
+}
+
+// txCause reports the changes of the signer as transaction_processing and the others as receipt_processing
+func txCause(tx *Tx) func(string) map[string]interface{} {
+	return func(accountID string) map[string]interface{} {
+		if accountID == tx.SignerID {
+			return map[string]interface{}{"type": "transaction_processing", "tx_hash": tx.Hash}
+		}
+		return map[string]interface{}{"type": "receipt_processing", "receipt_hash": hashOf("receipt", tx.Hash)}
+	}
+}
+
+// diffState returns the changes from before to after, ordered by account
+func (s *Server) diffState(before, after map[string]*account, cause func(string) map[string]interface{}) []*stateChange {
+	ids := make([]string, 0, len(before)+len(after))
+	for id := range before {
+		ids = append(ids, id)
+	}
+	for id := range after {
+		if before[id] == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	changes := make([]*stateChange, 0)
+	for _, id := range ids {
+		old, a := before[id], after[id]
+		if old == nil {
+			old = &account{}
+		}
+		add := func(kind, key string, change map[string]interface{}) {
+			change["account_id"] = id
+			changes = append(changes, &stateChange{accountID: id, kind: kind, cause: cause(id), change: change, key: key})
+		}
+
+		if a == nil {
+			add("account_deletion", "", map[string]interface{}{})
+			a = &account{}
+		} else if before[id] == nil || old.amount.Cmp(a.amount) != 0 {
+			add("account_update", "", map[string]interface{}{
+				"amount":          a.amount.YoctoString(),
+				"locked":          "0",
+				"code_hash":       "11111111111111111111111111111111",
+				"storage_usage":   s.StorageUsage,
+				"storage_paid_at": 0,
+			})
+		}
+
+		for _, name := range keyNames(old.keys, a.keys) {
+			switch key := a.keys[name]; {
+			case key == nil:
+				add("access_key_deletion", name, map[string]interface{}{"public_key": name})
+			case old.keys[name] == nil || mustJSON(old.keys[name]) != mustJSON(key):
+				add("access_key_update", name, map[string]interface{}{"public_key": name, "access_key": mustMap(key)})
+			}
+		}
+
+		for _, name := range storageKeys(old.storage, a.storage) {
+			keyBase64 := base64.StdEncoding.EncodeToString([]byte(name))
+			switch value, ok := a.storage[name]; {
+			case !ok:
+				add("data_deletion", name, map[string]interface{}{"key_base64": keyBase64})
+			default:
+				if oldValue, existed := old.storage[name]; existed && bytes.Equal(oldValue, value) {
+					continue
+				}
+				add("data_update", name, map[string]interface{}{
+					"key_base64":   keyBase64,
+					"value_base64": base64.StdEncoding.EncodeToString(value),
+				})
+			}
+		}
+	}
+	return changes
+}
+
+// keyNames returns the public keys of two key sets, sorted
+func keyNames(a, b map[string]*nearTransaction.AccessKey) []string {
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if a[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// storageKeys returns the keys of two contract states, sorted
+func storageKeys(a, b map[string][]byte) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) changesInBlock(p params) (interface{}, interface{}) {
+	block, rpcErr := s.findBlock(p)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	seen := make(map[string]bool)
+	changes := make([]interface{}, 0)
+	for _, c := range block.changes {
+		kind := c.touched()
+		if seen[kind+"/"+c.accountID] {
+			continue
+		}
+		seen[kind+"/"+c.accountID] = true
+		changes = append(changes, map[string]interface{}{"type": kind, "account_id": c.accountID})
+	}
+	return map[string]interface{}{"block_hash": block.Hash, "changes": changes}, nil
+}
+
+// changeKinds are the change types of each changes_type
+var changeKinds = map[string][]string{
+	"account_changes":           {"account_update", "account_deletion"},
+	"all_access_key_changes":    {"access_key_update", "access_key_deletion"},
+	"single_access_key_changes": {"access_key_update", "access_key_deletion"},
+	"data_changes":              {"data_update", "data_deletion"},
+}
+
+func (s *Server) changes(p params) (interface{}, interface{}) {
+	block, rpcErr := s.findBlock(p)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	changesType, _ := p.named["changes_type"].(string)
+	kinds := changeKinds[changesType]
+	if kinds == nil {
+		return nil, parseError(fmt.Errorf("unknown changes_type: %s", changesType))
+	}
+
+	//account_ids, or keys of single_access_key_changes, select the changes
+	selected := make(map[string]bool)
+	ids, _ := p.named["account_ids"].([]interface{})
+	for _, id := range ids {
+		selected[fmt.Sprint(id)] = true
+	}
+	keys, _ := p.named["keys"].([]interface{})
+	for _, key := range keys {
+		if k, ok := key.(map[string]interface{}); ok {
+			selected[fmt.Sprint(k["account_id"])+"/"+fmt.Sprint(k["public_key"])] = true
+		}
+	}
+	prefixBase64, _ := p.named["key_prefix_base64"].(string)
+	prefix, err := base64.StdEncoding.DecodeString(prefixBase64)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	changes := make([]interface{}, 0)
+	for _, c := range block.changes {
+		if c.kind != kinds[0] && c.kind != kinds[1] {
+			continue
+		}
+		switch {
+		case changesType == "single_access_key_changes":
+			if !selected[c.accountID+"/"+c.key] {
+				continue
+			}
+		case !selected[c.accountID]:
+			continue
+		case changesType == "data_changes" && !strings.HasPrefix(c.key, string(prefix)):
+			continue
+		}
+		changes = append(changes, c.json())
+	}
+	return map[string]interface{}{"block_hash": block.Hash, "changes": changes}, nil
+}
@@ -0,0 +1,394 @@
+package neartest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blocktree/near-adapter/nearKey"
+)
+
+// requiresFinal are the wait_until levels the fake node only reports once the block is final
+var requiresFinal = map[string]bool{
+	"INCLUDED_FINAL": true,
+	"EXECUTED":       true,
+	"FINAL":          true,
+}
+
+// params are the JSON-RPC params, either positional or named
+type params struct {
+	list  []interface{}
+	named map[string]interface{}
+}
+
+func parseParams(raw json.RawMessage) params {
+	var p params
+	if err := json.Unmarshal(raw, &p.list); err != nil {
+		json.Unmarshal(raw, &p.named)
+	}
+	return p
+}
+
+// get returns the positional param at index or the named param key
+func (p params) get(index int, key string) interface{} {
+	if p.named != nil {
+		return p.named[key]
+	}
+	if index < len(p.list) {
+		return p.list[index]
+	}
+	return nil
+}
+
+func (p params) str(index int, key string) string {
+	v, _ := p.get(index, key).(string)
+	return v
+}
+
+// handle serves a JSON-RPC method, s.mu is held
+func (s *Server) handle(method string, raw json.RawMessage) (interface{}, interface{}) {
+	p := parseParams(raw)
+	switch method {
+	case "status":
+		return s.status(), nil
+	case "network_info":
+		return s.networkInfo(), nil
+	case "block":
+		return s.block(p)
+	case "chunk":
+		return s.chunk(p)
+	case "tx":
+		return s.tx(p, false)
+	case "EXPERIMENTAL_tx_status":
+		return s.tx(p, true)
+	case "query":
+		return s.query(p)
+	case "gas_price":
+		block, rpcErr := s.findBlock(p)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return map[string]interface{}{"gas_price": block.GasPrice.String()}, nil
+	case "EXPERIMENTAL_protocol_config":
+		return s.protocolConfig(), nil
+	case "EXPERIMENTAL_changes_in_block":
+		return s.changesInBlock(p)
+	case "EXPERIMENTAL_changes":
+		return s.changes(p)
+	case "broadcast_tx_async":
+		tx, _, err := s.broadcast(p.str(0, "signed_tx_base64"))
+		if err != nil {
+			return nil, parseError(err)
+		}
+		return tx.Hash, nil
+	case "broadcast_tx_commit":
+		tx, invalid, err := s.broadcast(p.str(0, "signed_tx_base64"))
+		if err != nil {
+			return nil, parseError(err)
+		}
+		if invalid != nil {
+			return nil, invalidTxRPCError(invalid)
+		}
+		if tx.BlockHash == "" {
+			s.produceBlock()
+		}
+		if invalid, ok := s.rejected[tx.Hash]; ok {
+			return nil, invalidTxRPCError(invalid)
+		}
+		return s.outcomeJSON(tx, false), nil
+	}
+	return nil, rpcError(-32601, "Method not found", "REQUEST_VALIDATION_ERROR", "METHOD_NOT_FOUND",
+		map[string]interface{}{"method_name": method}, method)
+}
+
+func parseError(err error) map[string]interface{} {
+	return rpcError(-32700, "Parse error", "REQUEST_VALIDATION_ERROR", "PARSE_ERROR",
+		map[string]interface{}{"error_message": err.Error()}, err.Error())
+}
+
+func (s *Server) status() map[string]interface{} {
+	return map[string]interface{}{
+		"chain_id":                s.ChainID,
+		"protocol_version":        s.ProtocolVersion,
+		"latest_protocol_version": s.ProtocolVersion,
+		"version":                 map[string]interface{}{"version": "neartest", "build": "neartest"},
+		"sync_info": map[string]interface{}{
+			"latest_block_hash":   s.head.Hash,
+			"latest_block_height": s.head.Height,
+			"latest_block_time":   time.Unix(0, int64(s.head.Timestamp)).UTC().Format(time.RFC3339Nano),
+			"syncing":             s.Syncing,
+		},
+	}
+}
+
+// networkInfo reports the Peers as id@addr
+func (s *Server) networkInfo() map[string]interface{} {
+	peers := make([]interface{}, 0, len(s.Peers))
+	for _, peer := range s.Peers {
+		id, addr := peer, ""
+		if i := strings.Index(peer, "@"); i >= 0 {
+			id, addr = peer[:i], peer[i+1:]
+		}
+		peers = append(peers, map[string]interface{}{"id": id, "addr": addr, "account_id": nil})
+	}
+	return map[string]interface{}{
+		"active_peers":           peers,
+		"num_active_peers":       len(peers),
+		"peer_max_count":         40,
+		"sent_bytes_per_sec":     0,
+		"received_bytes_per_sec": 0,
+		"known_producers":        []interface{}{},
+	}
+}
+
+// findBlock resolves block_id, finality is ignored as every block of the fake chain is final
+func (s *Server) findBlock(p params) (*Block, interface{}) {
+	id := p.get(0, "block_id")
+	if id == nil {
+		return s.head, nil
+	}
+	block := s.blockByID(id)
+	if block == nil {
+		return nil, rpcError(-32000, "Server error", "HANDLER_ERROR", "UNKNOWN_BLOCK",
+			map[string]interface{}{}, fmt.Sprintf("DB Not Found Error: BLOCK: %v", id))
+	}
+	return block, nil
+}
+
+func (s *Server) protocolConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"protocol_version": s.ProtocolVersion,
+		"chain_id":         s.ChainID,
+		"epoch_length":     s.EpochLength,
+		"genesis_height":   GenesisHeight,
+		"min_gas_price":    s.GasPrice.String(),
+		"runtime_config": map[string]interface{}{
+			"storage_amount_per_byte": s.StorageAmountPerByte.YoctoString(),
+			"transaction_costs":       s.TransactionCosts,
+		},
+	}
+}
+
+func (s *Server) block(p params) (interface{}, interface{}) {
+	block, rpcErr := s.findBlock(p)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return map[string]interface{}{
+		"author": "neartest",
+		"header": map[string]interface{}{
+			"height":        block.Height,
+			"hash":          block.Hash,
+			"prev_hash":     block.PrevHash,
+			"timestamp":     block.Timestamp,
+			"chunk_tx_root": hashOf("chunk_tx_root", block.Hash),
+			"epoch_id":      block.EpochID,
+			"gas_price":     block.GasPrice.String(),
+		},
+		"chunks": []interface{}{
+			map[string]interface{}{"chunk_hash": block.ChunkHash, "height_created": block.Height, "shard_id": 0},
+		},
+	}, nil
+}
+
+func (s *Server) chunk(p params) (interface{}, interface{}) {
+	hash := p.str(0, "chunk_id")
+	block := s.byChunk[hash]
+	if block == nil {
+		return nil, rpcError(-32000, "Server error", "HANDLER_ERROR", "UNKNOWN_CHUNK",
+			map[string]interface{}{"chunk_hash": hash}, fmt.Sprintf("Chunk Missing (unavailable on the node): ChunkHash(`%s`)", hash))
+	}
+	txs := make([]interface{}, 0, len(block.Txs))
+	for _, tx := range block.Txs {
+		txs = append(txs, txJSON(tx))
+	}
+	return map[string]interface{}{
+		"author":       "neartest",
+		"header":       map[string]interface{}{"chunk_hash": block.ChunkHash, "height_created": block.Height, "shard_id": 0},
+		"transactions": txs,
+		"receipts":     []interface{}{},
+	}, nil
+}
+
+func (s *Server) tx(p params, receipts bool) (interface{}, interface{}) {
+	hash := p.str(0, "tx_hash")
+	waitUntil, _ := p.named["wait_until"].(string)
+
+	if invalid, ok := s.rejected[hash]; ok {
+		return nil, invalidTxRPCError(invalid)
+	}
+	if tx := s.txs[hash]; tx != nil {
+		outcome := s.outcomeJSON(tx, receipts)
+		if requiresFinal[waitUntil] && outcome["final_execution_status"] != "FINAL" {
+			return nil, causeError("TIMEOUT_ERROR")
+		}
+		return outcome, nil
+	}
+	for _, tx := range s.pending {
+		if tx.Hash != hash {
+			continue
+		}
+		if waitUntil == "NONE" {
+			return map[string]interface{}{"final_execution_status": "NONE"}, nil
+		}
+		//a node waits for the transaction and gives up
+		return nil, causeError("TIMEOUT_ERROR")
+	}
+	return nil, rpcError(-32000, "Server error", "HANDLER_ERROR", "UNKNOWN_TRANSACTION",
+		map[string]interface{}{"requested_transaction_hash": hash}, fmt.Sprintf("Transaction %s doesn't exist", hash))
+}
+
+func (s *Server) query(p params) (interface{}, interface{}) {
+	state := s.state
+	block := s.head
+	if p.named["block_id"] != nil {
+		var rpcErr interface{}
+		if block, rpcErr = s.findBlock(p); rpcErr != nil {
+			return nil, rpcErr
+		}
+		state = block.state
+	}
+
+	accountID, _ := p.named["account_id"].(string)
+	blockInfo := map[string]interface{}{"block_height": block.Height, "block_hash": block.Hash}
+	a := state[accountID]
+
+	requestType, _ := p.named["request_type"].(string)
+	switch requestType {
+	case "view_account", "view_access_key", "view_access_key_list", "call_function", "view_state":
+		if a == nil {
+			return nil, rpcError(-32000, "Server error", "HANDLER_ERROR", "UNKNOWN_ACCOUNT",
+				merge(blockInfo, map[string]interface{}{"requested_account_id": accountID}),
+				fmt.Sprintf("account %s does not exist while viewing", accountID))
+		}
+	default:
+		return nil, parseError(fmt.Errorf("unknown request_type: %s", requestType))
+	}
+
+	switch requestType {
+	case "view_account":
+		return merge(blockInfo, map[string]interface{}{
+			"amount":          a.amount.YoctoString(),
+			"locked":          "0",
+			"code_hash":       "11111111111111111111111111111111",
+			"storage_usage":   s.StorageUsage,
+			"storage_paid_at": 0,
+		}), nil
+	case "view_access_key":
+		publicKey, _ := p.named["public_key"].(string)
+		var key interface{}
+		if pub, err := nearKey.ParsePublicKey(publicKey); err == nil && a.keys[pub.String()] != nil {
+			key = a.keys[pub.String()]
+		}
+		if key == nil {
+			return nil, rpcError(-32000, "Server error", "HANDLER_ERROR", "UNKNOWN_ACCESS_KEY",
+				merge(blockInfo, map[string]interface{}{"public_key": publicKey}),
+				fmt.Sprintf("access key %s does not exist while viewing", publicKey))
+		}
+		return merge(blockInfo, mustMap(key)), nil
+	case "call_function":
+		return s.callFunction(p, blockInfo)
+	case "view_state":
+		return s.viewState(a, p, blockInfo)
+	}
+
+	names := make([]string, 0, len(a.keys))
+	for name := range a.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	keys := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, map[string]interface{}{"public_key": name, "access_key": a.keys[name]})
+	}
+	return merge(blockInfo, map[string]interface{}{"keys": keys}), nil
+}
+
+func (s *Server) callFunction(p params, blockInfo map[string]interface{}) (interface{}, interface{}) {
+	accountID, _ := p.named["account_id"].(string)
+	method, _ := p.named["method_name"].(string)
+	argsBase64, _ := p.named["args_base64"].(string)
+	args, err := base64.StdEncoding.DecodeString(argsBase64)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	fn := s.views[accountID+"/"+method]
+	if fn == nil {
+		return nil, contractError(accountID, blockInfo, "wasm execution failed with error: MethodResolveError(MethodNotFound)")
+	}
+	result, logs, err := fn(args)
+	if err != nil {
+		return nil, contractError(accountID, blockInfo, "wasm execution failed with error: "+err.Error())
+	}
+
+	//the node returns the result as an array of bytes
+	values := make([]int, len(result))
+	for i, b := range result {
+		values[i] = int(b)
+	}
+	if logs == nil {
+		logs = []string{}
+	}
+	return merge(blockInfo, map[string]interface{}{"result": values, "logs": logs}), nil
+}
+
+func (s *Server) viewState(a *account, p params, blockInfo map[string]interface{}) (interface{}, interface{}) {
+	accountID, _ := p.named["account_id"].(string)
+	prefixBase64, _ := p.named["prefix_base64"].(string)
+	prefix, err := base64.StdEncoding.DecodeString(prefixBase64)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	keys := make([]string, 0)
+	size := 0
+	for key, value := range a.storage {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+			size += len(key) + len(value)
+		}
+	}
+	if s.MaxStateSize > 0 && size > s.MaxStateSize {
+		return nil, rpcError(-32000, "Server error", "HANDLER_ERROR", "TOO_LARGE_CONTRACT_STATE",
+			merge(blockInfo, map[string]interface{}{"contract_account_id": accountID}),
+			fmt.Sprintf("State of contract %s is too large to be viewed", accountID))
+	}
+
+	sort.Strings(keys)
+	values := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, map[string]interface{}{
+			"key":   base64.StdEncoding.EncodeToString([]byte(key)),
+			"value": base64.StdEncoding.EncodeToString(a.storage[key]),
+		})
+	}
+	return merge(blockInfo, map[string]interface{}{"values": values, "proof": []interface{}{}}), nil
+}
+
+func contractError(accountID string, blockInfo map[string]interface{}, message string) map[string]interface{} {
+	return rpcError(-32000, "Server error", "HANDLER_ERROR", "CONTRACT_EXECUTION_ERROR",
+		merge(blockInfo, map[string]interface{}{"vm_error": message}), message)
+}
+
+func merge(a, b map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
+
+func mustMap(v interface{}) map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(mustJSON(v)), &m); err != nil {
+		panic(err)
+	}
+	return m
+}
@@ -0,0 +1,505 @@
+// Package neartest runs an in-process fake NEAR JSON-RPC node for offline tests.
+//
+// The server keeps an in-memory chain: tests add accounts and keys, produce blocks,
+// skip heights, fork and script failures, while the adapter talks to it over HTTP like
+// a real node. Broadcast transactions are decoded, their signatures, nonces, block hashes
+// and balances checked, and they are executed when the next block is produced.
+package neartest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
+)
+
+// DefaultTxFee is the tokens burnt by every transaction by default, about the cost of a transfer
+const DefaultTxFee = "42455506250000000000"
+
+// DefaultTransactionCosts is the transaction_costs of the protocol config, the mainnet fees of the common actions
+const DefaultTransactionCosts = `{
+	"action_receipt_creation_config": {"send_sir": 108059500000, "send_not_sir": 108059500000, "execution": 108059500000},
+	"action_creation_config": {
+		"create_account_cost": {"send_sir": 3850000000000, "send_not_sir": 3850000000000, "execution": 3850000000000},
+		"deploy_contract_cost": {"send_sir": 184765750000, "send_not_sir": 184765750000, "execution": 184765750000},
+		"deploy_contract_cost_per_byte": {"send_sir": 6812999, "send_not_sir": 6812999, "execution": 64572944},
+		"function_call_cost": {"send_sir": 2319861500000, "send_not_sir": 2319861500000, "execution": 2319861500000},
+		"function_call_cost_per_byte": {"send_sir": 2235934, "send_not_sir": 2235934, "execution": 2235934},
+		"transfer_cost": {"send_sir": 115123062500, "send_not_sir": 115123062500, "execution": 115123062500},
+		"stake_cost": {"send_sir": 141715687500, "send_not_sir": 141715687500, "execution": 102217625000},
+		"add_key_cost": {
+			"full_access_cost": {"send_sir": 101765125000, "send_not_sir": 101765125000, "execution": 101765125000},
+			"function_call_cost": {"send_sir": 102217625000, "send_not_sir": 102217625000, "execution": 102217625000},
+			"function_call_cost_per_byte": {"send_sir": 1925331, "send_not_sir": 1925331, "execution": 1925331}
+		},
+		"delete_key_cost": {"send_sir": 94946625000, "send_not_sir": 94946625000, "execution": 94946625000},
+		"delete_account_cost": {"send_sir": 147489000000, "send_not_sir": 147489000000, "execution": 147489000000},
+		"delegate_cost": {"send_sir": 200000000000, "send_not_sir": 200000000000, "execution": 200000000000}
+	}
+}`
+
+// DefaultMaxStateSize is the view_state size limit of the nodes, in bytes
+const DefaultMaxStateSize = 50000
+
+// genesisTime is the timestamp of the genesis block, in nanoseconds
+const genesisTime = uint64(1600000000) * uint64(time.Second)
+
+// Failure is a scripted failure of the next call of a method
+type Failure struct {
+	// responds with this HTTP status and an empty body, e.g. 429 or 503
+	HTTPStatus int
+	// responds with a JSON-RPC error of this cause, e.g. TIMEOUT_ERROR
+	Cause string
+	// waits before responding, or before responding normally when no failure is set
+	Delay time.Duration
+}
+
+// ViewFunc serves a call_function view call of a contract, args are the raw bytes of args_base64.
+// It runs with the server locked and must not call the Server methods.
+type ViewFunc func(args []byte) (result []byte, logs []string, err error)
+
+// Server is the fake node, start it with NewServer and Close it when done
+type Server struct {
+	*httptest.Server
+
+	ChainID string
+	// tokens burnt by each transaction, in yoctoNEAR
+	TxFee nearTransaction.YoctoAmount
+	// gas price of the next blocks
+	GasPrice *big.Int
+	// storage_usage reported by view_account, in bytes
+	StorageUsage uint64
+	// blocks per epoch, the epoch_id of the blocks changes every EpochLength heights
+	EpochLength uint64
+	// the protocol config returned by EXPERIMENTAL_protocol_config
+	ProtocolVersion      uint32
+	StorageAmountPerByte nearTransaction.YoctoAmount
+	TransactionCosts     *nearTransaction.RuntimeFeesConfig
+	// reported by status, a syncing node is refused by the adapter
+	Syncing bool
+	// peers reported by network_info
+	Peers []string
+	// view_state fails with TOO_LARGE_CONTRACT_STATE when the matching keys and values are larger, 0 for no limit
+	MaxStateSize int
+
+	mu       sync.Mutex
+	head     *Block
+	height   uint64
+	fork     int
+	blocks   map[uint64]*Block
+	byHash   map[string]*Block
+	byChunk  map[string]*Block
+	state    map[string]*account
+	pending  []*Tx
+	txs      map[string]*Tx
+	rejected map[string]*InvalidTxError
+	failures map[string][]Failure
+	calls    map[string]int
+	views    map[string]ViewFunc
+}
+
+// NewServer starts a fake node with only the genesis block
+func NewServer() *Server {
+	fee, _ := nearTransaction.ParseYocto(DefaultTxFee)
+	storage, _ := nearTransaction.ParseYocto("10000000000000000000")
+	costs, _ := nearTransaction.ParseRuntimeFeesConfig([]byte(DefaultTransactionCosts))
+	s := &Server{
+		ChainID:              "neartest",
+		Peers:                []string{"ed25519:neartest-peer@127.0.0.1:24567"},
+		TxFee:                fee,
+		GasPrice:             big.NewInt(100000000),
+		EpochLength:          43200,
+		ProtocolVersion:      63,
+		StorageAmountPerByte: storage,
+		TransactionCosts:     costs,
+		MaxStateSize:         DefaultMaxStateSize,
+		blocks:               make(map[uint64]*Block),
+		byHash:               make(map[string]*Block),
+		byChunk:              make(map[string]*Block),
+		state:                make(map[string]*account),
+		txs:                  make(map[string]*Tx),
+		rejected:             make(map[string]*InvalidTxError),
+		failures:             make(map[string][]Failure),
+		calls:                make(map[string]int),
+		views:                make(map[string]ViewFunc),
+	}
+	s.height = GenesisHeight - 1
+	s.produceBlock()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddAccount creates an account with full access keys of nonce 0, or sets the balance of an existing one
+func (s *Server) AddAccount(accountID string, amount nearTransaction.YoctoAmount, keys ...*nearKey.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.state[accountID]
+	if a == nil {
+		a = &account{keys: make(map[string]*nearTransaction.AccessKey)}
+		s.state[accountID] = a
+	}
+	a.amount = amount
+	for _, key := range keys {
+		a.keys[key.String()] = nearTransaction.NewFullAccessKey(0)
+	}
+}
+
+// AddAccessKey adds or replaces an access key of an existing account
+func (s *Server) AddAccessKey(accountID string, publicKey *nearKey.PublicKey, accessKey *nearTransaction.AccessKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.state[accountID]
+	if a == nil {
+		return fmt.Errorf("account %s does not exist", accountID)
+	}
+	key := *accessKey
+	a.keys[publicKey.String()] = &key
+	return nil
+}
+
+// Balance returns the current balance of an account
+func (s *Server) Balance(accountID string) (nearTransaction.YoctoAmount, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.state[accountID]
+	if a == nil {
+		return nearTransaction.YoctoAmount{}, false
+	}
+	return a.amount, true
+}
+
+// SetState sets a key of the contract state of an existing account, a nil value deletes the key
+func (s *Server) SetState(accountID string, key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.state[accountID]
+	if a == nil {
+		return fmt.Errorf("account %s does not exist", accountID)
+	}
+	if value == nil {
+		delete(a.storage, string(key))
+		return nil
+	}
+	if a.storage == nil {
+		a.storage = make(map[string][]byte)
+	}
+	a.storage[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// SetViewFunction serves the view method of a contract account with fn, errors are returned as CONTRACT_EXECUTION_ERROR
+func (s *Server) SetViewFunction(contractID, method string, fn ViewFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.views[contractID+"/"+method] = fn
+}
+
+// AccessKey returns a copy of an access key, nil if it does not exist
+func (s *Server) AccessKey(accountID string, publicKey *nearKey.PublicKey) *nearTransaction.AccessKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.state[accountID]
+	if a == nil || a.keys[publicKey.String()] == nil {
+		return nil
+	}
+	key := *a.keys[publicKey.String()]
+	return &key
+}
+
+// Head returns the latest block
+func (s *Server) Head() *Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.head
+}
+
+// Block returns the block at a height, nil for skipped heights
+func (s *Server) Block(height uint64) *Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blocks[height]
+}
+
+// ProduceBlock includes and executes the pending transactions in a new block
+func (s *Server) ProduceBlock() *Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.produceBlock()
+}
+
+// ProduceBlocks produces n blocks and returns the last one
+func (s *Server) ProduceBlocks(n int) *Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.produceBlock()
+	}
+	return s.head
+}
+
+// SkipHeight leaves the next height without a block, as when a producer misses its slot
+func (s *Server) SkipHeight() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.height++
+}
+
+// Fork drops the blocks above height and restores the state at height, the transactions
+// of the dropped blocks go back to the pending pool, the next blocks get new hashes
+func (s *Server) Fork(height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := s.blocks[height]
+	if base == nil {
+		return fmt.Errorf("no block at height %d", height)
+	}
+
+	dropped := make([]*Tx, 0)
+	for h := height + 1; h <= s.height; h++ {
+		block := s.blocks[h]
+		if block == nil {
+			continue
+		}
+		for _, tx := range block.Txs {
+			delete(s.txs, tx.Hash)
+			tx.BlockHash, tx.BlockHeight, tx.Failure = "", 0, ""
+			tx.TokensBurnt = nearTransaction.YoctoAmount{}
+			dropped = append(dropped, tx)
+		}
+		delete(s.blocks, h)
+		delete(s.byHash, block.Hash)
+		delete(s.byChunk, block.ChunkHash)
+	}
+
+	s.fork++
+	s.head = base
+	s.height = height
+	s.state = cloneState(base.state)
+	s.pending = append(dropped, s.pending...)
+	return nil
+}
+
+// FailNext makes the next calls of method fail, one failure per call
+func (s *Server) FailNext(method string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failures...)
+}
+
+// Calls returns how many times a method was called
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// Transaction returns an included transaction, nil if it is pending or unknown
+func (s *Server) Transaction(hash string) *Tx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.txs[hash]
+}
+
+// Pending returns the number of transactions waiting for the next block
+func (s *Server) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Rejected returns why a broadcast transaction was rejected
+func (s *Server) Rejected(hash string) (*InvalidTxError, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err, ok := s.rejected[hash]
+	return err, ok
+}
+
+func (s *Server) produceBlock() *Block {
+	s.height++
+	block := &Block{
+		Height:    s.height,
+		Hash:      hashOf("block", s.height, s.fork),
+		Timestamp: genesisTime + s.height*uint64(time.Second),
+		EpochID:   s.epochID(s.height),
+		GasPrice:  new(big.Int).Set(s.GasPrice),
+	}
+	block.ChunkHash = hashOf("chunk", block.Hash)
+	if s.head != nil {
+		block.PrevHash = s.head.Hash
+	} else {
+		block.PrevHash = nearKey.Encode(make([]byte, 32), nearKey.BitcoinAlphabet)
+	}
+
+	s.blocks[block.Height] = block
+	s.byHash[block.Hash] = block
+	s.byChunk[block.ChunkHash] = block
+
+	//changes made by the test since the previous block
+	parent := make(map[string]*account)
+	if s.head != nil {
+		parent = s.head.state
+	}
+	block.changes = s.diffState(parent, s.state, validatorCause)
+
+	for _, tx := range s.pending {
+		//pending transactions are checked again, a fork may have changed the state
+		if invalid := s.checkTx(tx.Signed, tx.hash, s.state); invalid != nil {
+			s.rejected[tx.Hash] = invalid
+			continue
+		}
+		before := cloneState(s.state)
+		s.execute(tx, s.state)
+		block.changes = append(block.changes, s.diffState(before, s.state, txCause(tx))...)
+		tx.BlockHash, tx.BlockHeight = block.Hash, block.Height
+		block.Txs = append(block.Txs, tx)
+		s.txs[tx.Hash] = tx
+	}
+	s.pending = nil
+
+	block.state = cloneState(s.state)
+	s.head = block
+	return block
+}
+
+func (s *Server) epochID(height uint64) string {
+	length := s.EpochLength
+	if length == 0 {
+		length = 1
+	}
+	return hashOf("epoch", (height-GenesisHeight)/length)
+}
+
+// broadcast checks a signed transaction and adds it to the pending pool
+func (s *Server) broadcast(signedTx string) (*Tx, *InvalidTxError, error) {
+	ts, hash, err := decodeTx(signedTx)
+	if err != nil {
+		return nil, nil, err
+	}
+	txHash := nearKey.Encode(hash, nearKey.BitcoinAlphabet)
+	if tx := s.txs[txHash]; tx != nil {
+		return tx, nil, nil
+	}
+	for _, tx := range s.pending {
+		if tx.Hash == txHash {
+			return tx, nil, nil
+		}
+	}
+
+	tx := &Tx{Hash: txHash, SignerID: string(ts.Signer.ID), Signed: ts, hash: hash}
+	if invalid := s.checkTx(ts, hash, s.state); invalid != nil {
+		s.rejected[txHash] = invalid
+		return tx, invalid, nil
+	}
+	delete(s.rejected, txHash)
+	s.pending = append(s.pending, tx)
+	return tx, nil, nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var req struct {
+		ID     interface{}     `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, map[string]interface{}{"jsonrpc": "2.0", "id": nil,
+			"error": rpcError(-32700, "Parse error", "REQUEST_VALIDATION_ERROR", "PARSE_ERROR", nil, err.Error())})
+		return
+	}
+
+	s.mu.Lock()
+	s.calls[req.Method]++
+	var failure *Failure
+	if queue := s.failures[req.Method]; len(queue) > 0 {
+		failure = &queue[0]
+		s.failures[req.Method] = queue[1:]
+	}
+	s.mu.Unlock()
+
+	if failure != nil {
+		if failure.Delay > 0 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(failure.Delay):
+			}
+		}
+		if failure.HTTPStatus != 0 {
+			w.WriteHeader(failure.HTTPStatus)
+			return
+		}
+		if failure.Cause != "" {
+			writeJSON(w, map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": causeError(failure.Cause)})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	result, rpcErr := s.handle(req.Method, req.Params)
+	s.mu.Unlock()
+
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if rpcErr != nil {
+		resp["error"] = rpcErr
+	} else {
+		resp["result"] = result
+	}
+	writeJSON(w, resp)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(mustJSON(v)))
+}
+
+func mustJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+type rawJSON string
+
+func (r rawJSON) MarshalJSON() ([]byte, error) {
+	return []byte(r), nil
+}
+
+func rpcError(code int, message, name, cause string, info interface{}, data interface{}) map[string]interface{} {
+	if info == nil {
+		info = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"code":    code,
+		"message": message,
+		"name":    name,
+		"cause":   map[string]interface{}{"name": cause, "info": info},
+		"data":    data,
+	}
+}
+
+// causeError is the error a node returns for a handler error cause
+func causeError(cause string) map[string]interface{} {
+	switch cause {
+	case "INTERNAL_ERROR":
+		return rpcError(-32000, "Server error", "INTERNAL_ERROR", cause, nil, "Internal error")
+	case "PARSE_ERROR", "METHOD_NOT_FOUND":
+		return rpcError(-32700, "Parse error", "REQUEST_VALIDATION_ERROR", cause, nil, cause)
+	}
+	return rpcError(-32000, "Server error", "HANDLER_ERROR", cause, nil, cause)
+}
+
+func invalidTxRPCError(invalid *InvalidTxError) map[string]interface{} {
+	info := map[string]interface{}{"TxExecutionError": map[string]interface{}{"InvalidTxError": invalid.json()}}
+	return rpcError(-32000, "Server error", "HANDLER_ERROR", "INVALID_TRANSACTION", info, info)
+}
@@ -0,0 +1,215 @@
+package neartest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
+	"github.com/tidwall/gjson"
+)
+
+func call(t *testing.T, s *Server, method string, params interface{}) gjson.Result {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": "1", "method": method, "params": params})
+	resp, err := http.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	return gjson.ParseBytes(data)
+}
+
+func testKey(t *testing.T, seed byte) ([]byte, *nearKey.PublicKey) {
+	t.Helper()
+	//owcrypt takes ed25519 private keys as clamped scalars, like the keys openwallet derives
+	privateKey := bytes.Repeat([]byte{seed}, 32)
+	privateKey[0] &= 248
+	privateKey[31] = privateKey[31]&127 | 64
+	key, _ := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_ED25519)
+	pub, err := nearKey.NewPublicKey(hex.EncodeToString(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, pub
+}
+
+func signTransfer(t *testing.T, s *Server, privateKey []byte, pub *nearKey.PublicKey, signerID string, nonce uint64, receiverID string, amount uint64) string {
+	t.Helper()
+	ts, err := nearTransaction.NewTxStruct(signerID, hex.EncodeToString(pub.Key), nonce, receiverID, s.Head().Hash,
+		nearTransaction.NewTransferAction(nearTransaction.YoctoFromUint64(amount)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedTx, err := SignTransaction(ts, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signedTx
+}
+
+func TestServer_Blocks(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.ProduceBlock()
+	s.SkipHeight()
+	s.ProduceBlock()
+
+	r := call(t, s, "block", map[string]interface{}{"finality": "final"})
+	if r.Get("result.header.height").Uint() != 4 || r.Get("result.header.prev_hash").String() != s.Block(2).Hash {
+		t.Fatalf("wrong head: %s", r.Raw)
+	}
+	if r := call(t, s, "block", map[string]interface{}{"block_id": 3}); r.Get("error.cause.name").String() != "UNKNOWN_BLOCK" {
+		t.Errorf("skipped height should be unknown: %s", r.Raw)
+	}
+	chunk := r.Get("result.chunks.0.chunk_hash").String()
+	if r := call(t, s, "chunk", []string{chunk}); !r.Get("result.transactions").IsArray() {
+		t.Errorf("wrong chunk: %s", r.Raw)
+	}
+	if r := call(t, s, "status", []interface{}{}); r.Get("result.sync_info.latest_block_height").Uint() != 4 {
+		t.Errorf("wrong status: %s", r.Raw)
+	}
+
+	//a fork replaces the blocks above height 2
+	oldHash := s.Block(4).Hash
+	if err := s.Fork(2); err != nil {
+		t.Fatal(err)
+	}
+	if s.Block(4) != nil {
+		t.Error("blocks above the fork should be dropped")
+	}
+	s.ProduceBlocks(2)
+	if s.Head().Height != 4 || s.Head().Hash == oldHash {
+		t.Errorf("wrong fork head: %+v", s.Head())
+	}
+	if r := call(t, s, "block", map[string]interface{}{"block_id": oldHash}); r.Get("error.cause.name").String() != "UNKNOWN_BLOCK" {
+		t.Errorf("forked block should be unknown: %s", r.Raw)
+	}
+
+	if r := call(t, s, "EXPERIMENTAL_validators_ordered", []interface{}{nil}); r.Get("error.cause.name").String() != "METHOD_NOT_FOUND" {
+		t.Errorf("wrong error: %s", r.Raw)
+	}
+}
+
+func TestServer_Transfer(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	privateKey, pub := testKey(t, 1)
+	_, otherPub := testKey(t, 2)
+	implicitID := hex.EncodeToString(otherPub.Key)
+	balance, _ := nearTransaction.ParseNEAR("10")
+	s.AddAccount("alice.near", balance, pub)
+
+	r := call(t, s, "query", map[string]interface{}{"request_type": "view_access_key", "finality": "final",
+		"account_id": "alice.near", "public_key": pub.String()})
+	if r.Get("result.nonce").Uint() != 0 || r.Get("result.permission").String() != "FullAccess" {
+		t.Fatalf("wrong access key: %s", r.Raw)
+	}
+
+	signedTx := signTransfer(t, s, privateKey, pub, "alice.near", 1, implicitID, 1000)
+	r = call(t, s, "broadcast_tx_async", []string{signedTx})
+	txHash := r.Get("result").String()
+	if txHash == "" || s.Pending() != 1 {
+		t.Fatalf("broadcast failed: %s", r.Raw)
+	}
+	if r := call(t, s, "tx", []string{txHash, "alice.near"}); r.Get("error.cause.name").String() != "TIMEOUT_ERROR" {
+		t.Errorf("pending transaction should time out: %s", r.Raw)
+	}
+
+	block := s.ProduceBlock()
+	r = call(t, s, "tx", []string{txHash, "alice.near"})
+	if r.Get("result.transaction_outcome.block_hash").String() != block.Hash ||
+		!r.Get("result.status.SuccessValue").Exists() ||
+		r.Get("result.transaction.actions.0.Transfer.deposit").String() != "1000" {
+		t.Fatalf("wrong outcome: %s", r.Raw)
+	}
+	if amount, ok := s.Balance(implicitID); !ok || amount.YoctoString() != "1000" {
+		t.Errorf("implicit account not created: %v", amount)
+	}
+	if s.AccessKey(implicitID, otherPub) == nil {
+		t.Error("implicit account should have its full access key")
+	}
+	if s.AccessKey("alice.near", pub).Nonce != 1 {
+		t.Error("nonce not updated")
+	}
+
+	r = call(t, s, "EXPERIMENTAL_tx_status", map[string]interface{}{"tx_hash": txHash, "sender_account_id": "alice.near", "wait_until": "FINAL"})
+	if r.Get("error.cause.name").String() != "TIMEOUT_ERROR" {
+		t.Errorf("transaction should not be final yet: %s", r.Raw)
+	}
+	s.ProduceBlocks(2)
+	r = call(t, s, "EXPERIMENTAL_tx_status", map[string]interface{}{"tx_hash": txHash, "sender_account_id": "alice.near", "wait_until": "FINAL"})
+	if r.Get("result.final_execution_status").String() != "FINAL" {
+		t.Errorf("transaction should be final: %s", r.Raw)
+	}
+
+	//replayed nonce
+	r = call(t, s, "broadcast_tx_commit", []string{signTransfer(t, s, privateKey, pub, "alice.near", 1, implicitID, 1000)})
+	if r.Get("error.cause.name").String() != "INVALID_TRANSACTION" ||
+		!r.Get("error.data.TxExecutionError.InvalidTxError.InvalidNonce").Exists() {
+		t.Errorf("replayed nonce should be rejected: %s", r.Raw)
+	}
+
+	//signed by a key the account does not have
+	otherKey, _ := testKey(t, 2)
+	r = call(t, s, "broadcast_tx_commit", []string{signTransfer(t, s, otherKey, pub, "alice.near", 2, implicitID, 1000)})
+	if r.Get("error.data.TxExecutionError.InvalidTxError").String() != "InvalidSignature" {
+		t.Errorf("bad signature should be rejected: %s", r.Raw)
+	}
+
+	//transfer to a missing named account fails after the fee is paid
+	r = call(t, s, "broadcast_tx_commit", []string{signTransfer(t, s, privateKey, pub, "alice.near", 2, "bob.near", 1000)})
+	if !r.Get("result.status.Failure.ActionError.kind.AccountDoesNotExist").Exists() {
+		t.Errorf("transfer to a missing account should fail: %s", r.Raw)
+	}
+	if r := call(t, s, "query", map[string]interface{}{"request_type": "view_account", "finality": "final", "account_id": "bob.near"}); r.Get("error.cause.name").String() != "UNKNOWN_ACCOUNT" {
+		t.Errorf("wrong error: %s", r.Raw)
+	}
+
+	s.FailNext("gas_price", Failure{HTTPStatus: http.StatusTooManyRequests}, Failure{Cause: "INTERNAL_ERROR"})
+	if resp, err := http.Post(s.URL, "application/json", bytes.NewReader([]byte(`{"jsonrpc":"2.0","id":"1","method":"gas_price","params":[null]}`))); err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("scripted 429 not returned: %v", err)
+	}
+	if r := call(t, s, "gas_price", []interface{}{nil}); r.Get("error.name").String() != "INTERNAL_ERROR" {
+		t.Errorf("scripted error not returned: %s", r.Raw)
+	}
+	if r := call(t, s, "gas_price", []interface{}{nil}); r.Get("result.gas_price").String() != s.GasPrice.String() || s.Calls("gas_price") != 3 {
+		t.Errorf("wrong gas price: %s", r.Raw)
+	}
+}
+
+func TestServer_ForkRequeues(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	privateKey, pub := testKey(t, 1)
+	balance, _ := nearTransaction.ParseNEAR("10")
+	s.AddAccount("alice.near", balance, pub)
+	s.AddAccount("bob.near", nearTransaction.YoctoAmount{})
+
+	s.ProduceBlock()
+	r := call(t, s, "broadcast_tx_commit", []string{signTransfer(t, s, privateKey, pub, "alice.near", 1, "bob.near", 5)})
+	txHash := r.Get("result.transaction.hash").String()
+	if txHash == "" {
+		t.Fatalf("broadcast failed: %s", r.Raw)
+	}
+
+	if err := s.Fork(2); err != nil {
+		t.Fatal(err)
+	}
+	if amount, _ := s.Balance("bob.near"); !amount.IsZero() || s.Transaction(txHash) != nil || s.Pending() != 1 {
+		t.Fatalf("fork should undo the transfer and requeue it: %v", amount)
+	}
+	s.ProduceBlock()
+	if amount, _ := s.Balance("bob.near"); amount.YoctoString() != "5" || s.Transaction(txHash).BlockHeight != 3 {
+		t.Errorf("requeued transfer not included: %v", amount)
+	}
+}
@@ -1,9 +1,14 @@
 package openwtester
 
 import (
+	"flag"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/blocktree/near-adapter/neartest"
+
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openw"
 	"github.com/blocktree/openwallet/v2/openwallet"
@@ -16,6 +21,49 @@ var (
 	dbFileName     = "blockchain-NEAR.db"
 )
 
+//默认只运行离线测试，-integration 时运行依赖 conf/NEAR.ini 节点和本地钱包数据的测试
+var integration = flag.Bool("integration", false, "run the tests against conf/NEAR.ini and the local wallets")
+
+func skipUnlessIntegration(t *testing.T) {
+	t.Helper()
+	if !*integration {
+		t.Skip("needs a live node and local wallets, run with -integration")
+	}
+}
+
+//testNewWalletManager 连接模拟节点的钱包管理，钱包和配置文件都在临时目录
+func testNewWalletManager(t *testing.T) (*openw.WalletManager, *neartest.Server) {
+	t.Helper()
+	node := neartest.NewServer()
+	t.Cleanup(node.Close)
+
+	dir, err := ioutil.TempDir("", "openwtester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	confDir := filepath.Join(dir, "conf")
+	if err := os.MkdirAll(confDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ini := "nodeAPI = " + node.URL + "\nchainID = neartest\ndataDir = " + filepath.Join(dir, "data") + "\n"
+	if err := ioutil.WriteFile(filepath.Join(confDir, "NEAR.ini"), []byte(ini), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tc := openw.NewConfig()
+	tc.ConfigDir = confDir
+	tc.KeyDir = filepath.Join(dir, "key")
+	tc.DBPath = filepath.Join(dir, "db")
+	tc.BackupDir = filepath.Join(dir, "backup")
+	tc.EnableBlockScan = false
+	tc.SupportAssets = []string{"NEAR"}
+	tm := openw.NewWalletManager(tc)
+	t.Cleanup(func() { tm.CloseDB(testApp) })
+	return tm, node
+}
+
 func testInitWalletManager() *openw.WalletManager {
 	log.SetLogFuncCall(true)
 	tc := openw.NewConfig()
@@ -30,6 +78,7 @@ func testInitWalletManager() *openw.WalletManager {
 }
 
 func TestWalletManager_CreateWallet(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	w := &openwallet.Wallet{Alias: "HELLO NEAR", IsTrust: true, Password: "12345678"}
 	nw, key, err := tm.CreateWallet(testApp, w)
@@ -44,6 +93,7 @@ func TestWalletManager_CreateWallet(t *testing.T) {
 }
 
 func TestWalletManager_GetWalletInfo(t *testing.T) {
+	skipUnlessIntegration(t)
 
 	tm := testInitWalletManager()
 
@@ -56,6 +106,7 @@ func TestWalletManager_GetWalletInfo(t *testing.T) {
 }
 
 func TestWalletManager_GetWalletList(t *testing.T) {
+	skipUnlessIntegration(t)
 
 	tm := testInitWalletManager()
 
@@ -73,6 +124,7 @@ func TestWalletManager_GetWalletList(t *testing.T) {
 }
 
 func TestWalletManager_CreateAssetsAccount(t *testing.T) {
+	skipUnlessIntegration(t)
 
 	tm := testInitWalletManager()
 
@@ -91,6 +143,7 @@ func TestWalletManager_CreateAssetsAccount(t *testing.T) {
 }
 
 func TestWalletManager_GetAssetsAccountList(t *testing.T) {
+	skipUnlessIntegration(t)
 
 	tm := testInitWalletManager()
 
@@ -110,6 +163,7 @@ func TestWalletManager_GetAssetsAccountList(t *testing.T) {
 }
 
 func TestWalletManager_CreateAddress(t *testing.T) {
+	skipUnlessIntegration(t)
 
 	tm := testInitWalletManager()
 
@@ -127,6 +181,7 @@ func TestWalletManager_CreateAddress(t *testing.T) {
 }
 
 func TestWalletManager_GetAddressList(t *testing.T) {
+	skipUnlessIntegration(t)
 
 	tm := testInitWalletManager()
 
@@ -60,6 +60,7 @@ func (sub *subscriberSingle) BlockExtractSmartContractDataNotify(sourceKey strin
 
 
 func TestSubscribeAddress(t *testing.T) {
+	skipUnlessIntegration(t)
 
 	var (
 		endRunning = make(chan bool, 1)
@@ -26,6 +26,7 @@ import (
 )
 
 func TestWalletManager_GetTransactions(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	list, err := tm.GetTransactions(testApp, 0, -1, "Received", false)
 	if err != nil {
@@ -39,6 +40,7 @@ func TestWalletManager_GetTransactions(t *testing.T) {
 }
 
 func TestWalletManager_GetTxUnspent(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	list, err := tm.GetTxUnspent(testApp, 0, -1, "Received", false)
 	if err != nil {
@@ -52,6 +54,7 @@ func TestWalletManager_GetTxUnspent(t *testing.T) {
 }
 
 func TestWalletManager_GetTxSpent(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	list, err := tm.GetTxSpent(testApp, 0, -1, "Received", false)
 	if err != nil {
@@ -65,6 +68,7 @@ func TestWalletManager_GetTxSpent(t *testing.T) {
 }
 
 func TestWalletManager_ExtractUTXO(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	unspent, err := tm.GetTxUnspent(testApp, 0, -1, "Received", false)
 	if err != nil {
@@ -84,6 +88,7 @@ func TestWalletManager_ExtractUTXO(t *testing.T) {
 }
 
 func TestWalletManager_GetTransactionByWxID(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	wxID := openwallet.GenTransactionWxID(&openwallet.Transaction{
 		TxID: "bfa6febb33c8ddde9f7f7b4d93043956cce7e0f4e95da259a78dc9068d178fee",
@@ -104,6 +109,7 @@ func TestWalletManager_GetTransactionByWxID(t *testing.T) {
 }
 
 func TestWalletManager_GetAssetsAccountBalance(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	walletID := "WGqq1apvBWXGsxnYtLr5JbeAWcfxUc96VS"
 	accountID := "CSHjefYb4BePiovVq9Kjv9ewkh7iQgWHHP4EqqMtaUDw"
@@ -117,6 +123,7 @@ func TestWalletManager_GetAssetsAccountBalance(t *testing.T) {
 }
 
 func TestWalletManager_GetAssetsAccountTokenBalance(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	walletID := "WEqcj8FDLvf3uAS44ChEutM6oUbmgN23bf"
 	accountID := "GVK6daCGmqKHfe2zEbpixarAJ9HEqawyAm9jFvmqU59Q"
@@ -138,6 +145,7 @@ func TestWalletManager_GetAssetsAccountTokenBalance(t *testing.T) {
 }
 
 func TestWalletManager_GetEstimateFeeRate(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	coin := openwallet.Coin{
 		Symbol: "N",
@@ -151,6 +159,7 @@ func TestWalletManager_GetEstimateFeeRate(t *testing.T) {
 }
 
 func TestGetAddressBalance(t *testing.T) {
+	skipUnlessIntegration(t)
 	symbol := "N"
 	assetsMgr, err := openw.GetAssetsAdapter(symbol)
 	if err != nil {
@@ -18,6 +18,9 @@ package openwtester
 import (
 	"testing"
 
+	"github.com/blocktree/near-adapter/nearKey"
+	"github.com/blocktree/near-adapter/nearTransaction"
+
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openw"
 	"github.com/blocktree/openwallet/v2/openwallet"
@@ -130,6 +133,7 @@ account : 9KKHEYZMFQJivQKkwCRTzPuQxUK2Arp71HRVP6zxK7Sj
 */
 
 func TestTransfer(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	walletID := "WKfekxS7RSAU1pqb6u79HpWoYwkJvm7emx"
 	accountID := "Gryk5QZjnkiZsYqGneL9bJFzPC1Cw5NBfkBzeVKmfff9"
@@ -184,7 +188,52 @@ func TestTransfer(t *testing.T) {
 
 }
 
+func TestTransfer_FakeNode(t *testing.T) {
+	tm, node := testNewWalletManager(t)
+
+	w, _, err := tm.CreateWallet(testApp, &openwallet.Wallet{Alias: "HELLO NEAR", IsTrust: true, Password: "12345678"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, address, err := tm.CreateAssetsAccount(testApp, w.WalletID, "12345678",
+		&openwallet.AssetsAccount{Alias: "NEAR", WalletID: w.WalletID, Required: 1, Symbol: "NEAR", IsTrust: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//地址为隐式账户，充值后才能转出
+	publicKey, err := nearKey.NewPublicKey(address.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funds, _ := nearTransaction.ParseNEAR("10")
+	node.AddAccount(address.Address, funds, publicKey)
+	node.AddAccount("bob.near", nearTransaction.YoctoAmount{})
+	node.ProduceBlocks(2)
+
+	rawTx, err := testCreateTransactionStep(tm, w.WalletID, account.AccountID, "bob.near", "1.5", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testSignTransactionStep(tm, rawTx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testVerifyTransactionStep(tm, rawTx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testSubmitTransactionStep(tm, rawTx); err != nil {
+		t.Fatal(err)
+	}
+
+	node.ProduceBlocks(2)
+	received, _ := node.Balance("bob.near")
+	if expect, _ := nearTransaction.ParseNEAR("1.5"); received.Cmp(expect) != 0 {
+		t.Errorf("bob.near received %s, expect 1.5 NEAR", received.YoctoString())
+	}
+}
+
 func TestSummary(t *testing.T) {
+	skipUnlessIntegration(t)
 	tm := testInitWalletManager()
 	walletID := "WJX9kac46kUuaWS6cHhknUmYg33QgAXsQ9"
 	accountID := "2xh2GfXd674Er2Xi77Kgry2XPC4cP4PESZQ73JWz8V9X"